@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // @Summary 获得表格数据
@@ -388,6 +389,129 @@ func GetWorkTableData(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// 里程统计的时间粒度与对应的 DATE_FORMAT 格式
+var mileagePeriodFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%x-W%v",
+	"month": "%Y-%m",
+}
+
+// 里程统计的分组方式与对应的 work_table 列
+var mileageGroupColumns = map[string]string{
+	"car":    "car_id",
+	"driver": "driver_id",
+}
+
+// @Summary 获取班次里程与行驶时间汇总
+// @Description 按日、周或月，以车辆或驾驶员分组汇总已结束班次的里程、行驶时间与怠速时间
+// @Tags admins
+// @Produce  json
+// @Param period query string false "统计粒度：day、week、month，默认 day"
+// @Param group  query string false "分组方式：car、driver，默认 car"
+// @Param id     query string false "只统计指定车牌号或驾驶员编号"
+// @Param from   query string false "开始日期（含），格式 2006-01-02"
+// @Param to     query string false "结束日期（含），格式 2006-01-02"
+// @Success 200 {object} MileageResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /work_table/mileage [get]
+func GetMileageStats(w http.ResponseWriter, r *http.Request) {
+	// 单个统计周期内一辆车或一名驾驶员的汇总
+	type MileageStat struct {
+		Period        string  `json:"period"`         // 统计周期，例如 2024-05-01、2024-W18、2024-05
+		ID            string  `json:"id"`             // 车牌号或驾驶员编号
+		Shifts        int     `json:"shifts"`         // 班次数
+		DistanceKm    float64 `json:"distance_km"`    // 行驶里程（公里）
+		MovingSeconds int     `json:"moving_seconds"` // 行驶时间（秒）
+		IdleSeconds   int     `json:"idle_seconds"`   // 怠速时间（秒）
+	}
+
+	type MileageResponse struct {
+		Period string        `json:"period"` // 统计粒度
+		Group  string        `json:"group"`  // 分组方式
+		Data   []MileageStat `json:"data"`   // 汇总结果
+	}
+
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "day"
+	}
+	group := query.Get("group")
+	if group == "" {
+		group = "car"
+	}
+	format, ok := mileagePeriodFormats[period]
+	if !ok {
+		http.Error(w, "period 只能是 day、week 或 month", http.StatusBadRequest)
+		return
+	}
+	column, ok := mileageGroupColumns[group]
+	if !ok {
+		http.Error(w, "group 只能是 car 或 driver", http.StatusBadRequest)
+		return
+	}
+
+	// 统计周期与分组列均来自白名单，可以直接拼入 SQL
+	sqlS := "SELECT DATE_FORMAT(work_stime, '" + format + "') AS period_key, " + column + " AS group_key, COUNT(*), " +
+		"SUM(work_mileage), SUM(work_moving_time), SUM(work_idle_time) FROM work_table WHERE work_etime IS NOT NULL"
+	var args []interface{}
+	if id := query.Get("id"); id != "" {
+		sqlS += " AND " + column + " = ?"
+		args = append(args, id)
+	}
+	if from := query.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			http.Error(w, "from 日期格式错误，应为 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		sqlS += " AND work_stime >= ?"
+		args = append(args, day.Format("2006-01-02 15:04:05"))
+	}
+	if to := query.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			http.Error(w, "to 日期格式错误，应为 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		sqlS += " AND work_stime < ?"
+		args = append(args, day.AddDate(0, 0, 1).Format("2006-01-02 15:04:05"))
+	}
+	sqlS += " GROUP BY period_key, group_key ORDER BY period_key DESC, group_key"
+
+	// 不带筛选条件时 SQL 中没有占位符，关闭相应的警告
+	config.AllowWarning = false
+	result, err := db.ExecuteSQL(config.RoleDriver, sqlS, args...)
+	config.AllowWarning = true
+	if err != nil {
+		exception.PrintError(GetMileageStats, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		http.Error(w, "数据库返回结果格式错误", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	stats := []MileageStat{}
+	for rows.Next() {
+		var stat MileageStat
+		if err := rows.Scan(&stat.Period, &stat.ID, &stat.Shifts, &stat.DistanceKm, &stat.MovingSeconds, &stat.IdleSeconds); err != nil {
+			exception.PrintError(GetMileageStats, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats = append(stats, stat)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(MileageResponse{Period: period, Group: group, Data: stats}); err != nil {
+		exception.PrintError(GetMileageStats, err)
+	}
+}
+
 func GiveDriverInfo(w http.ResponseWriter, r *http.Request) {
 	// 提供html
 	// 关于司机的名字，性别，电话，评星，注意动态生成评星
@@ -472,3 +596,108 @@ func GiveDriverInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// @Summary 获取 incident_table 表格数据
+// @Description 获取 GPS 模块记录的事件（如偏离路线），按开始时间倒序
+// @Tags admins
+// @Produce  json
+// @Param type      query string false "事件类型，如 route_deviation、overspeed"
+// @Param keyword   query string false "搜索关键字（可搜索 driver_id, car_id）"
+// @Param page      query int    false "当前页码，默认 1"
+// @Param size      query int    false "每页条数，默认 10"
+// @Success 200 {object} IncidentResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/incident_table [get]
+func GetIncidentTableData(w http.ResponseWriter, r *http.Request) {
+	type Incident struct {
+		IncidentID    int     `json:"incident_id"`
+		IncidentType  string  `json:"incident_type"`
+		DriverID      string  `json:"driver_id"`
+		CarID         string  `json:"car_id"`
+		RouteID       int     `json:"route_id"`
+		Latitude      float64 `json:"latitude"`
+		Longitude     float64 `json:"longitude"`
+		IncidentValue float64 `json:"incident_value"`
+		IncidentStime string  `json:"incident_stime"`
+		IncidentEtime string  `json:"incident_etime"` // 事件仍在持续时为空
+		IncidentNote  string  `json:"incident_note"`
+	}
+
+	type IncidentResponse struct {
+		Data  []Incident `json:"data"`
+		Total int        `json:"total"`
+		Page  int        `json:"page"`
+		Size  int        `json:"size"`
+	}
+
+	// 获取查询参数
+	incidentType := r.URL.Query().Get("type")
+	keyword := r.URL.Query().Get("keyword")
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size < 1 {
+		size = 10
+	}
+
+	config.AllowWarning = false
+	sqlS := `SELECT incident_id, incident_type, driver_id, car_id, route_id, latitude, longitude, incident_value, incident_stime, incident_etime, incident_note FROM incident_table ORDER BY incident_stime DESC`
+	result, err := db.ExecuteSQL(config.RoleDriver, sqlS)
+	config.AllowWarning = true
+	if err != nil {
+		exception.PrintError(GetIncidentTableData, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows := result.(*sql.Rows)
+	defer rows.Close()
+
+	var incidents []Incident
+	for rows.Next() {
+		var incident Incident
+		etime := sql.NullString{}
+		if err := rows.Scan(&incident.IncidentID, &incident.IncidentType, &incident.DriverID, &incident.CarID,
+			&incident.RouteID, &incident.Latitude, &incident.Longitude, &incident.IncidentValue,
+			&incident.IncidentStime, &etime, &incident.IncidentNote); err != nil {
+			exception.PrintError(GetIncidentTableData, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if etime.Valid {
+			incident.IncidentEtime = etime.String
+		}
+		// 过滤类型与关键字
+		if incidentType != "" && incident.IncidentType != incidentType {
+			continue
+		}
+		if keyword != "" && !strings.Contains(incident.DriverID, keyword) && !strings.Contains(incident.CarID, keyword) {
+			continue
+		}
+		incidents = append(incidents, incident)
+	}
+
+	// 分页
+	total := len(incidents)
+	start := (page - 1) * size
+	end := start + size
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+
+	response := IncidentResponse{
+		Data:  incidents[start:end],
+		Total: total,
+		Page:  page,
+		Size:  size,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		exception.PrintError(GetIncidentTableData, err)
+	}
+}
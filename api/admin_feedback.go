@@ -29,6 +29,20 @@ type Feedback struct {
 // 对司机的投诉信息，是一个string(司机id) -》 []string的映射
 var ComplaintToDriver map[string][]string
 
+// DriverMessenger 按驾驶员编号推送消息，驾驶员未连接时消息离线保存，重新连接后补发
+// 由 main 设置为 WebSocket API，未设置时投诉只保存在 ComplaintToDriver 中
+var DriverMessenger interface {
+	SendMessageByID(ID string, message []byte)
+}
+
+// DriverComplaint 推送给驾驶员的投诉消息
+type DriverComplaint struct {
+	Type      string `json:"type"` // 固定为 "complaint"
+	DriverID  string `json:"driver_id"`
+	Complaint string `json:"complaint"`
+	Time      string `json:"time"`
+}
+
 // GetComplaintCorrespondingToDriver 用来获取司机的投诉信息
 // 接收前端发送的driver_id
 // 返回一个response结构体
@@ -72,6 +86,19 @@ func temporarySaveMessagesToDrivers(driverID string, complaintContent string) {
 	} else {
 		ComplaintToDriver[driverID] = append(ComplaintToDriver[driverID], complaintContent)
 	}
+
+	// 同时通过 WebSocket 推送给驾驶员
+	if DriverMessenger != nil {
+		message, err := json.Marshal(DriverComplaint{
+			Type:      "complaint",
+			DriverID:  driverID,
+			Complaint: complaintContent,
+			Time:      time.Now().Format("2006-01-02 15:04:05"),
+		})
+		if err == nil {
+			DriverMessenger.SendMessageByID(driverID, message)
+		}
+	}
 }
 
 // GetFeedBack 用来返回所有的反馈信息
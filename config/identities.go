@@ -62,14 +62,179 @@ type Jwt struct {
 }
 
 type Config struct {
-	Database DatabaseConfig `yaml:"database_connection"`
-	Server   Server         `yaml:"server"`
-	DBNames  DatabaseNames  `yaml:"database_names"`
-	Jwt      Jwt            `yaml:"jwt"`
-	Other    Other          `yaml:"other"`
+	Database  DatabaseConfig  `yaml:"database_connection"`
+	Server    Server          `yaml:"server"`
+	DBNames   DatabaseNames   `yaml:"database_names"`
+	Jwt       Jwt             `yaml:"jwt"`
+	Other     Other           `yaml:"other"`
+	GPS       GPSConfig       `yaml:"gps"`
+	GTFS      GTFSConfig      `yaml:"gtfs"`
+	Simulator SimulatorConfig `yaml:"simulator"`
+	WebSocket WebSocketConfig `yaml:"websocket"`
+}
+
+// WebSocketConfig WebSocket 服务相关配置
+type WebSocketConfig struct {
+	AllowedOrigins      []string `yaml:"allowed_origins"`       // 同源页面之外允许的跨域来源，* 表示允许所有来源
+	SendQueueSize       int      `yaml:"send_queue_size"`       // 每个连接的发送队列长度，队列满时断开该连接
+	WriteTimeoutSeconds int      `yaml:"write_timeout_seconds"` // 单条消息的写超时（秒）
+	PingIntervalSeconds int      `yaml:"ping_interval_seconds"` // 向客户端发送 ping 的间隔（秒）
+	PongTimeoutSeconds  int      `yaml:"pong_timeout_seconds"`  // 超过该时间未收到 pong 或任何消息即断开（秒）
+	MaxMessageBytes     int64    `yaml:"max_message_bytes"`     // 单条客户端消息的最大字节数，超过时断开
+	AckTimeoutSeconds   int      `yaml:"ack_timeout_seconds"`   // 需要确认的消息多久未收到 ack 后重发（秒）
+	MaxRetries          int      `yaml:"max_retries"`           // 最多重发次数
+	CallTTLSeconds      int      `yaml:"call_ttl_seconds"`      // 乘客呼叫及其送达状态的保留时间（秒）
+	OfflineTTLSeconds   int      `yaml:"offline_ttl_seconds"`   // 发给未连接的驾驶员或车辆的离线消息保留时间（秒）
+	OfflineQueueSize    int      `yaml:"offline_queue_size"`    // 每个驾驶员或车辆最多保留的离线消息数
 }
 
 type Other struct {
 	ExpirationRideCoupon int    `yaml:"expiration_ride_coupon"`
 	ApiKey               string `yaml:"api_key"`
 }
+
+// GPSConfig GPS 模块相关配置
+type GPSConfig struct {
+	ETA        ETAConfig        `yaml:"eta"`
+	Trajectory TrajectoryConfig `yaml:"trajectory"`
+	Geofence   GeofenceConfig   `yaml:"geofence"`
+	Deviation  DeviationConfig  `yaml:"deviation"`
+	Presence   PresenceConfig   `yaml:"presence"`
+	Filter     FilterConfig     `yaml:"filter"`
+	Speed      SpeedConfig      `yaml:"speed"`
+	Mileage    MileageConfig    `yaml:"mileage"`
+	Headway    HeadwayConfig    `yaml:"headway"`
+	Occupancy  OccupancyConfig  `yaml:"occupancy"`
+	Store      StoreConfig      `yaml:"store"`
+}
+
+// ETAConfig 到站时间预测配置，未填写（为 0）时由 gps 模块使用默认值
+type ETAConfig struct {
+	DefaultSpeedKmh float64 `yaml:"default_speed_kmh"` // 尚未观测到车速时使用的默认车速（km/h）
+	StopSnapMeters  float64 `yaml:"stop_snap_meters"`  // 站点距路线多少米以内视为该路线上的站点
+	SmoothingFactor float64 `yaml:"smoothing_factor"`  // 观测车速的指数平滑系数（0~1）
+}
+
+// TrajectoryConfig 班次轨迹记录配置，未填写（为 0）时由 gps 模块使用默认值
+type TrajectoryConfig struct {
+	MinIntervalSeconds   int     `yaml:"min_interval_seconds"`   // 两个记录点之间的最短间隔（秒）
+	MaxIntervalSeconds   int     `yaml:"max_interval_seconds"`   // 车辆静止时也至少每隔多久记录一个点（秒）
+	MinDistanceMeters    float64 `yaml:"min_distance_meters"`    // 移动超过多少米才记录新点
+	FlushIntervalSeconds int     `yaml:"flush_interval_seconds"` // 轨迹写入 work_table 的周期（秒）
+}
+
+// GeofenceConfig 站点电子围栏配置，未填写（为 0）时由 gps 模块使用默认值
+type GeofenceConfig struct {
+	RadiusMeters     float64                    `yaml:"radius_meters"`     // 默认围栏半径（米），进入该半径视为到站
+	HysteresisMeters float64                    `yaml:"hysteresis_meters"` // 默认回差（米），离开 半径+回差 才视为离站
+	Sites            map[int]GeofenceSiteConfig `yaml:"sites"`             // 按站点编号单独配置
+}
+
+// GeofenceSiteConfig 单个站点的围栏配置，为 0 的字段使用默认值
+type GeofenceSiteConfig struct {
+	RadiusMeters     float64 `yaml:"radius_meters"`
+	HysteresisMeters float64 `yaml:"hysteresis_meters"`
+}
+
+// DeviationConfig 偏离路线检测配置，未填写（为 0）时由 gps 模块使用默认值
+type DeviationConfig struct {
+	MaxOffsetMeters    float64 `yaml:"max_offset_meters"`    // 距路线超过多少米视为偏离
+	MinDurationSeconds int     `yaml:"min_duration_seconds"` // 持续偏离多少秒才告警
+}
+
+// PresenceConfig 驾驶员在线状态配置，未填写（为 0）时由 gps 模块使用默认值
+type PresenceConfig struct {
+	StaleAfterSeconds  int    `yaml:"stale_after_seconds"`  // 多少秒未上报位置标记为 stale
+	ExpireAfterSeconds int    `yaml:"expire_after_seconds"` // 多少秒未上报位置视为失联
+	ExpireAction       string `yaml:"expire_action"`        // 失联后的处理：flag（标记为 expired 继续广播）或 evict（移除）
+}
+
+// FilterConfig GPS 定位过滤配置，未填写（为 0）时由 gps 模块使用默认值
+type FilterConfig struct {
+	MinLatitude    float64 `yaml:"min_latitude"` // 校园范围（经纬度四个值都为 0 时不检查范围）
+	MaxLatitude    float64 `yaml:"max_latitude"`
+	MinLongitude   float64 `yaml:"min_longitude"`
+	MaxLongitude   float64 `yaml:"max_longitude"`
+	MaxSpeedKmh    float64 `yaml:"max_speed_kmh"`   // 相邻两次定位推算出的速度超过该值视为离群点
+	SmoothingAlpha float64 `yaml:"smoothing_alpha"` // 指数平滑系数（0~1），越大越接近原始定位，1 表示不平滑
+}
+
+// SpeedConfig 车速计算与超速检测配置，未填写（为 0）时由 gps 模块使用默认值
+// 同一位置命中多个限速时取最低值；都未命中时使用默认限速
+type SpeedConfig struct {
+	DefaultLimitKmh    float64              `yaml:"default_limit_kmh"`    // 默认限速（km/h）
+	MinDurationSeconds int                  `yaml:"min_duration_seconds"` // 持续超速多少秒才告警
+	SmoothingFactor    float64              `yaml:"smoothing_factor"`     // 平滑车速的指数平滑系数（0~1）
+	Segments           []SpeedSegmentConfig `yaml:"segments"`             // 按线路路段限速
+	Zones              []SpeedZoneConfig    `yaml:"zones"`                // 按区域限速
+}
+
+type MileageConfig struct {
+	MovingSpeedKmh float64 `yaml:"moving_speed_kmh"` // 两次定位间的平均车速不低于该值时计为行驶，否则计为怠速
+	MaxGapSeconds  int     `yaml:"max_gap_seconds"`  // 两次定位间隔超过该值时不计入行驶或怠速时间
+}
+
+type HeadwayConfig struct {
+	TargetSeconds  int         `yaml:"target_seconds"`   // 默认目标发车间隔（秒）
+	RouteTargets   map[int]int `yaml:"route_targets"`    // 按线路编号单独配置目标间隔（秒）
+	BunchingRatio  float64     `yaml:"bunching_ratio"`   // 间隔低于 目标×该比例 视为串车
+	GapRatio       float64     `yaml:"gap_ratio"`        // 间隔高于 目标×该比例 视为大间隔
+	MaxHoldSeconds int         `yaml:"max_hold_seconds"` // 建议驻站等待的最长时间（秒）
+}
+
+type OccupancyConfig struct {
+	DefaultCapacity int            `yaml:"default_capacity"` // 默认车辆载客量
+	Capacities      map[string]int `yaml:"capacities"`       // 按车牌号单独配置载客量
+}
+
+type StoreConfig struct {
+	Backend         string `yaml:"backend"`          // 驾驶员状态存储：memory（仅内存）或 db（定期快照到数据库）
+	SnapshotSeconds int    `yaml:"snapshot_seconds"` // 快照间隔（秒）
+}
+
+// SpeedSegmentConfig 线路上两个站点之间路段的限速，两个站点都为 0 时表示整条线路
+type SpeedSegmentConfig struct {
+	RouteID    int     `yaml:"route_id"`
+	FromSiteID int     `yaml:"from_site_id"`
+	ToSiteID   int     `yaml:"to_site_id"`
+	LimitKmh   float64 `yaml:"limit_kmh"`
+}
+
+// SpeedZoneConfig 以某点为圆心的圆形区域限速，例如校门、教学楼附近
+type SpeedZoneConfig struct {
+	Name         string  `yaml:"name"`
+	Latitude     float64 `yaml:"latitude"`
+	Longitude    float64 `yaml:"longitude"`
+	RadiusMeters float64 `yaml:"radius_meters"`
+	LimitKmh     float64 `yaml:"limit_kmh"`
+}
+
+// GTFSConfig GTFS 数据导出配置，未填写时由 gtfs 模块使用默认值
+// 系统中没有时刻表数据，班次按运营时间与发车间隔生成
+type GTFSConfig struct {
+	AgencyName     string   `yaml:"agency_name"`     // 运营机构名称
+	AgencyURL      string   `yaml:"agency_url"`      // 运营机构网址
+	Timezone       string   `yaml:"timezone"`        // 时区，例如 Asia/Shanghai
+	Lang           string   `yaml:"lang"`            // 语言，例如 zh
+	StartDate      string   `yaml:"start_date"`      // 服务开始日期 YYYYMMDD，为空时为导出当天
+	EndDate        string   `yaml:"end_date"`        // 服务结束日期 YYYYMMDD，为空时为开始日期后一年
+	ServiceDays    []string `yaml:"service_days"`    // 运营日，例如 monday、saturday，为空时每天运营
+	ServiceStart   string   `yaml:"service_start"`   // 首班发车时间 HH:MM:SS
+	ServiceEnd     string   `yaml:"service_end"`     // 末班发车时间 HH:MM:SS
+	HeadwayMinutes int      `yaml:"headway_minutes"` // 发车间隔（分钟）
+	SpeedKmh       float64  `yaml:"speed_kmh"`       // 计算站间行驶时间使用的车速（km/h）
+	DwellSeconds   int      `yaml:"dwell_seconds"`   // 每站停靠时间（秒）
+}
+
+// SimulatorConfig 车队模拟器配置，未填写（为 0）时由 simulator 模块使用默认值
+type SimulatorConfig struct {
+	Drivers      int     `yaml:"drivers"`       // 模拟的驾驶员数量，命令行参数 -simulate 优先
+	Seed         int64   `yaml:"seed"`          // 随机种子，相同种子的运行结果一致，命令行参数 -sim-seed 优先
+	RouteIDs     []int   `yaml:"route_ids"`     // 参与模拟的线路，为空时使用全部线路
+	SpeedKmh     float64 `yaml:"speed_kmh"`     // 平均车速（km/h）
+	SpeedJitter  float64 `yaml:"speed_jitter"`  // 每辆车车速的随机浮动比例（0~1）
+	DwellSeconds int     `yaml:"dwell_seconds"` // 每站平均停靠时间（秒）
+	TickSeconds  float64 `yaml:"tick_seconds"`  // 上报位置的间隔（秒）
+	NoiseMeters  float64 `yaml:"noise_meters"`  // 定位的随机误差（米）
+	MaxBoarding  int     `yaml:"max_boarding"`  // 每站最多上车人数
+}
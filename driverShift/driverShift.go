@@ -49,9 +49,9 @@ type CommentResponse struct {
 
 // 路径记录结构体
 type RouteRecord struct {
-	Time string `json:"time"`  // 时间戳
-	GPSX int    `json:"gps_x"` // GPS X 坐標
-	GPSY int    `json:"gps_y"` // GPS Y 坐標
+	Time string  `json:"time"`  // 时间戳
+	GPSX float64 `json:"gps_x"` // GPS X 坐標（经度）
+	GPSY float64 `json:"gps_y"` // GPS Y 坐標（纬度）
 }
 
 // var module := gps.NewGPSModule()
@@ -85,20 +85,40 @@ func updateDriverStatus(driverID string, status int) error {
 	return nil
 }
 
-func createWorkTable(driverID string, carID string, routeID int) error {
+// 创建工作表记录，返回班次开始时间 work_stime
+func createWorkTable(driverID string, carID string, routeID int) (string, error) {
 	timeNow := time.Now().Format("2006-01-02 15:04:05")
 	sql := "INSERT INTO work_table (work_stime,driver_id,route_id,car_id) VALUES (?,?,?,?)"
 	_, err := db.ExecuteSQL(config.RoleDriver, sql, timeNow, driverID, routeID, carID)
 	if err != nil {
-		return fmt.Errorf("创建工作表失败: %w", err)
+		return "", fmt.Errorf("创建工作表失败: %w", err)
+	}
+	return timeNow, nil
+}
+
+// 删除上班失败时已创建的工作表记录
+func deleteWorkTable(driverID string, shiftStart string) {
+	sql := "DELETE FROM work_table WHERE work_etime IS NULL AND driver_id = ? AND work_stime = ?"
+	if _, err := db.ExecuteSQL(config.RoleDriver, sql, driverID, shiftStart); err != nil {
+		log.Printf("删除驾驶员 %s 的工作表记录失败: %v", driverID, err)
+	}
+}
+
+// 沿用未结束的班次时更新其线路与车辆，使下班时能按车牌号结束该班次
+func resumeWorkTable(driverID string, shiftStart string, carID string, routeID int) error {
+	sql := "UPDATE work_table SET route_id = ?, car_id = ? WHERE work_etime IS NULL AND driver_id = ? AND work_stime = ?"
+	_, err := db.ExecuteSQL(config.RoleDriver, sql, routeID, carID, driverID, shiftStart)
+	if err != nil {
+		return fmt.Errorf("更新工作表失败: %w", err)
 	}
 	return nil
 }
 
-func modifyWorkTable(driverID string, carID string) error {
+// 结束工作表记录，同时写入本班次的里程、行驶时间与怠速时间（统计列见 migrations/002_work_table_stats.sql）
+func modifyWorkTable(driverID string, carID string, stats gps.ShiftStats) error {
 	timeNow := time.Now().Format("2006-01-02 15:04:05")
-	sql := "UPDATE work_table SET work_etime = ? WHERE work_etime IS NULL AND driver_id = ? AND car_id = ?  "
-	_, err := db.ExecuteSQL(config.RoleDriver, sql, timeNow, driverID, carID)
+	sql := "UPDATE work_table SET work_etime = ?, work_mileage = ?, work_moving_time = ?, work_idle_time = ? WHERE work_etime IS NULL AND driver_id = ? AND car_id = ?  "
+	_, err := db.ExecuteSQL(config.RoleDriver, sql, timeNow, stats.DistanceKm, stats.MovingSeconds, stats.IdleSeconds, driverID, carID)
 	if err != nil {
 		return fmt.Errorf("更新工作表失败: %w", err)
 	}
@@ -199,18 +219,32 @@ func HandleShiftStart(w http.ResponseWriter, r *http.Request, gps_api *gps.GPSAP
 		return
 	}
 
-	if err := createWorkTable(shift.DriverID, shift.VehicleNo, shift.RouteID); err != nil {
+	// 服务重启后驾驶员已按未结束的班次恢复，客户端再次上班时沿用该班次，不再新建工作表记录
+	if shiftStart, resumed := gps_api.ResumeShift(shift.DriverID, shift.VehicleNo, shift.RouteID); resumed {
+		if err := resumeWorkTable(shift.DriverID, shiftStart, shift.VehicleNo, shift.RouteID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "更新工作表失败")
+			return
+		}
+		respondWithSuccess(w, "上班信息处理成功")
+		return
+	}
+
+	shiftStart, err := createWorkTable(shift.DriverID, shift.VehicleNo, shift.RouteID)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "创建工作表失败")
 		return
 	}
 
 	// 创建驾驶员对象
 	log.Printf("driverid = %s\n", shift.DriverID)
-	_, err = gps_api.CreateDriver(shift.DriverID) // 初始纬度和经度为 0
+	_, err = gps_api.CreateDriver(shift.DriverID, shift.RouteID) // 初始纬度和经度为 0，线路用于到站预测
 	if err != nil {
+		deleteWorkTable(shift.DriverID, shiftStart)
 		respondWithError(w, http.StatusInternalServerError, "创建驾驶员失败")
 		return
 	}
+	// 开始记录本班次轨迹
+	gps_api.StartTrack(shift.DriverID, shift.VehicleNo, shiftStart)
 
 	respondWithSuccess(w, "上班信息处理成功")
 }
@@ -249,7 +283,12 @@ func HandleShiftEnd(w http.ResponseWriter, r *http.Request, gps_api *gps.GPSAPI)
 		respondWithError(w, http.StatusInternalServerError, "司机下班状态更新失败")
 		return
 	}
-	if err := modifyWorkTable(shift.DriverID, shift.VehicleNo); err != nil {
+	// 在删除驾驶员对象之前取出本班次的里程统计
+	stats, ok := gps_api.ShiftStats(shift.DriverID)
+	if !ok {
+		log.Printf("驾驶员 %s 本班次没有有效定位，里程记为 0", shift.DriverID)
+	}
+	if err := modifyWorkTable(shift.DriverID, shift.VehicleNo, stats); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "工作表下班状态更新失败")
 		return
 	}
@@ -425,3 +464,77 @@ func GetComments(w http.ResponseWriter, r *http.Request) {
 	response := CommentResponse{Comments: comments}
 	respondWithSuccess(w, response)
 }
+
+// GetShiftTrack 获取一个班次的完整轨迹：班次进行中时返回内存中的最新轨迹，否则读取 work_table.record_route
+func GetShiftTrack(w http.ResponseWriter, r *http.Request, gps_api *gps.GPSAPI) {
+	log.Println("GetShiftTrack 被触发")
+	setCORSHeaders(w, "POST, OPTIONS")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "仅支持 POST 请求")
+		return
+	}
+
+	var shift WorkShift
+	err := json.NewDecoder(r.Body).Decode(&shift)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "请求数据解析失败")
+		return
+	}
+	if shift.DriverID == "" || shift.ShiftStart == "" {
+		respondWithError(w, http.StatusBadRequest, "缺少必要字段")
+		return
+	}
+
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT work_stime, work_etime, driver_id, route_id, car_id, record_route FROM work_table WHERE driver_id = ? AND work_stime = ?",
+		shift.DriverID, shift.ShiftStart)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "查询班次信息失败")
+		return
+	}
+
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "数据库返回结果格式错误")
+		return
+	}
+	defer rows.Close()
+
+	var track WorkShift
+	if rows.Next() {
+		var workEtime, recordRoute sql.NullString
+		err := rows.Scan(&track.ShiftStart, &workEtime, &track.DriverID, &track.RouteID, &track.VehicleNo, &recordRoute)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "解析班次信息失败")
+			return
+		}
+		track.ShiftEnd = workEtime.String
+		if recordRoute.Valid && recordRoute.String != "" {
+			if err := json.Unmarshal([]byte(recordRoute.String), &track.RouteRecord); err != nil {
+				log.Printf("解析轨迹记录失败: %v", err)
+			}
+		}
+	} else {
+		respondWithError(w, http.StatusNotFound, "未找到该班次信息")
+		return
+	}
+
+	// 班次尚未结束时，内存中的轨迹比数据库中的更新
+	if points, ok := gps_api.GetTrack(track.DriverID, track.ShiftStart); ok {
+		track.RouteRecord = make([]RouteRecord, 0, len(points))
+		for _, p := range points {
+			track.RouteRecord = append(track.RouteRecord, RouteRecord{Time: p.Time, GPSX: p.GPSX, GPSY: p.GPSY})
+		}
+	}
+	if track.RouteRecord == nil {
+		track.RouteRecord = []RouteRecord{}
+	}
+
+	respondWithSuccess(w, track)
+}
@@ -0,0 +1,103 @@
+package geodata
+
+import (
+	"login/websocket"
+	"reflect"
+	"testing"
+)
+
+func testDataset() *Dataset {
+	return &Dataset{
+		Routes: []websocket.Route{
+			{ID: 1, Path: [][]float64{{121.4, 31.2}, {121.41, 31.2}, {121.41, 31.21}, {121.4, 31.2}}},
+			{ID: 12, Path: [][]float64{{121.405, 31.201}, {121.4123456789, 31.2087654321}}},
+		},
+		Sites: []websocket.Site{
+			{ID: 3, Name: "图书馆", Location: websocket.Location{Longitude: 121.401, Latitude: 31.202}, SitePassenger: 5, IsUsed: 1, Note: "北门"},
+			{ID: 4, Name: "体育馆", Location: websocket.Location{Longitude: 121.409, Latitude: 31.207}, IsUsed: 0},
+		},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, format := range []string{"geojson", "KML", "gpx"} {
+		t.Run(format, func(t *testing.T) {
+			codec, err := CodecFor(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := testDataset()
+			data, err := codec.Encode(want)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			got, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("decode: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := CodecFor("shp"); err == nil {
+		t.Error("unsupported format accepted")
+	}
+}
+
+func TestCodecDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		data       string
+		wantRoutes []websocket.Route
+		wantSites  []websocket.Site
+		wantErr    bool
+	}{
+		{name: "geojson defaults", format: "geojson",
+			data: `{"type":"FeatureCollection","features":[
+				{"type":"Feature","geometry":{"type":"LineString","coordinates":[[121.4,31.2],[121.41,31.2]]},"properties":{"route_id":"5"}},
+				{"type":"Feature","geometry":{"type":"Point","coordinates":[121.4,31.2]},"properties":{"site_id":7,"name":"食堂"}}]}`,
+			wantRoutes: []websocket.Route{{ID: 5, Path: [][]float64{{121.4, 31.2}, {121.41, 31.2}}}},
+			wantSites:  []websocket.Site{{ID: 7, Name: "食堂", Location: websocket.Location{Longitude: 121.4, Latitude: 31.2}, IsUsed: 1}}},
+		{name: "geojson polygon", format: "geojson",
+			data:    `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Polygon","coordinates":[]}}]}`,
+			wantErr: true},
+		{name: "geojson without collection", format: "geojson", data: `{"type":"Feature"}`, wantErr: true},
+		{name: "kml folder and route number from name", format: "kml",
+			data: `<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder>
+				<Placemark><name>2号线</name><LineString><coordinates>121.4,31.2,0 121.41,31.2,0</coordinates></LineString></Placemark>
+				<Placemark><name> 食堂 </name><Point><coordinates>121.4,31.2</coordinates></Point></Placemark>
+				</Folder></Document></kml>`,
+			wantRoutes: []websocket.Route{{ID: 2, Path: [][]float64{{121.4, 31.2}, {121.41, 31.2}}}},
+			wantSites:  []websocket.Site{{Name: "食堂", Location: websocket.Location{Longitude: 121.4, Latitude: 31.2}, IsUsed: 1}}},
+		{name: "kml bad coordinate", format: "kml",
+			data:    `<kml><Document><Placemark><name>1</name><LineString><coordinates>121.4 31.2</coordinates></LineString></Placemark></Document></kml>`,
+			wantErr: true},
+		{name: "gpx track segments", format: "gpx",
+			data: `<gpx version="1.1"><trk><name>环线 3</name>
+				<trkseg><trkpt lat="31.2" lon="121.4"/></trkseg><trkseg><trkpt lat="31.21" lon="121.41"/></trkseg>
+				</trk></gpx>`,
+			wantRoutes: []websocket.Route{{ID: 3, Path: [][]float64{{121.4, 31.2}, {121.41, 31.21}}}}},
+		{name: "gpx invalid xml", format: "gpx", data: `<gpx>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, _ := CodecFor(tt.format)
+			d, err := codec.Decode([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %+v, want an error", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(d.Routes, tt.wantRoutes) || !reflect.DeepEqual(d.Sites, tt.wantSites) {
+				t.Errorf("decoded routes=%+v sites=%+v, want routes=%+v sites=%+v", d.Routes, d.Sites, tt.wantRoutes, tt.wantSites)
+			}
+		})
+	}
+}
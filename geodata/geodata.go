@@ -0,0 +1,197 @@
+package geodata
+
+import (
+	"errors"
+	"fmt"
+	"login/config"
+	"login/websocket"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 线路两端距离在该值以内视为闭合（环线），与 GPS 模块判断环线的标准一致
+const closedToleranceMeters = 30.0
+
+// 名称中的数字，文件中没有线路编号时用作线路编号
+var nameNumber = regexp.MustCompile(`\d+`)
+
+// 线路形状要求
+const (
+	ShapeAny    = ""       // 不检查
+	ShapeClosed = "closed" // 必须首尾相接，导入时首尾坐标会对齐
+	ShapeOpen   = "open"   // 首尾不能相接
+)
+
+// Dataset 导入或导出的线路与站点
+type Dataset struct {
+	Routes []websocket.Route
+	Sites  []websocket.Site
+}
+
+// Codec 一种地理数据格式的编码与解码
+type Codec interface {
+	Encode(d *Dataset) ([]byte, error)
+	Decode(data []byte) (*Dataset, error)
+	ContentType() string
+	Extension() string
+}
+
+// codecs 支持的格式
+var codecs = map[string]Codec{
+	"geojson": geoJSONCodec{},
+	"kml":     kmlCodec{},
+	"gpx":     gpxCodec{},
+}
+
+// CodecFor 根据格式名称获取编码器
+func CodecFor(format string) (Codec, error) {
+	codec, ok := codecs[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q, expected geojson, kml or gpx", format)
+	}
+	return codec, nil
+}
+
+// Load 读取当前全部线路与站点，按编号排序
+func Load() (*Dataset, error) {
+	routes, err := websocket.QueryRoutes()
+	if err != nil {
+		return nil, err
+	}
+	sites, err := websocket.QuerySites()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	sort.Slice(sites, func(i, j int) bool { return sites[i].ID < sites[j].ID })
+	return &Dataset{Routes: routes, Sites: sites}, nil
+}
+
+// Save 写入线路文件与站点表
+func Save(d *Dataset) error {
+	for _, route := range d.Routes {
+		if err := websocket.SaveRoute(route); err != nil {
+			return err
+		}
+	}
+	return websocket.SaveSites(d.Sites)
+}
+
+// Validate 检查坐标顺序与范围、线路点数以及线路形状，并清理连续重复的点
+// shape 为 ShapeClosed 时将基本闭合的线路首尾对齐
+func Validate(d *Dataset, shape string) error {
+	var errs []error
+
+	seenRoutes := make(map[int]bool)
+	for i := range d.Routes {
+		route := &d.Routes[i]
+		if route.ID <= 0 {
+			errs = append(errs, fmt.Errorf("route #%d: missing route id", i+1))
+			continue
+		}
+		if seenRoutes[route.ID] {
+			errs = append(errs, fmt.Errorf("route %d: duplicated route id", route.ID))
+		}
+		seenRoutes[route.ID] = true
+
+		var path [][]float64
+		pointErrs := len(errs)
+		for j, pt := range route.Path {
+			if len(pt) < 2 {
+				errs = append(errs, fmt.Errorf("route %d point %d: expected [longitude, latitude]", route.ID, j+1))
+				continue
+			}
+			if err := checkCoordinate(pt[0], pt[1]); err != nil {
+				errs = append(errs, fmt.Errorf("route %d point %d: %v", route.ID, j+1, err))
+				continue
+			}
+			if n := len(path); n > 0 && path[n-1][0] == pt[0] && path[n-1][1] == pt[1] {
+				continue
+			}
+			path = append(path, []float64{pt[0], pt[1]})
+		}
+		if len(errs) > pointErrs {
+			continue
+		}
+		if len(path) < 2 {
+			errs = append(errs, fmt.Errorf("route %d: a route needs at least two distinct points", route.ID))
+			continue
+		}
+
+		gap := distance(path[0], path[len(path)-1])
+		switch shape {
+		case ShapeClosed:
+			if gap > closedToleranceMeters {
+				errs = append(errs, fmt.Errorf("route %d: expected a closed line but the ends are %.0f m apart", route.ID, gap))
+			} else if gap > 0 {
+				path[len(path)-1] = []float64{path[0][0], path[0][1]}
+			}
+		case ShapeOpen:
+			if gap <= closedToleranceMeters {
+				errs = append(errs, fmt.Errorf("route %d: expected an open line but the ends meet", route.ID))
+			}
+		case ShapeAny:
+		default:
+			return fmt.Errorf("unknown shape %q, expected closed or open", shape)
+		}
+		route.Path = path
+	}
+
+	seenSites := make(map[int]bool)
+	for i, site := range d.Sites {
+		if site.ID <= 0 {
+			errs = append(errs, fmt.Errorf("site #%d (%s): missing site id", i+1, site.Name))
+			continue
+		}
+		if seenSites[site.ID] {
+			errs = append(errs, fmt.Errorf("site %d: duplicated site id", site.ID))
+		}
+		seenSites[site.ID] = true
+		if err := checkCoordinate(site.Location.Longitude, site.Location.Latitude); err != nil {
+			errs = append(errs, fmt.Errorf("site %d: %v", site.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkCoordinate 检查经纬度的范围，并识别经纬度写反的情况
+// 配置了 gps.filter 校园范围时，还要求坐标位于范围内
+func checkCoordinate(lng, lat float64) error {
+	if math.IsNaN(lng) || math.IsNaN(lat) {
+		return errors.New("coordinate is not a number")
+	}
+	inRange := func(lng, lat float64) bool { return math.Abs(lng) <= 180 && math.Abs(lat) <= 90 }
+	inCampus := func(lng, lat float64) bool {
+		c := config.AppConfig.GPS.Filter
+		if c.MinLatitude == 0 && c.MaxLatitude == 0 && c.MinLongitude == 0 && c.MaxLongitude == 0 {
+			return true
+		}
+		return lat >= c.MinLatitude && lat <= c.MaxLatitude && lng >= c.MinLongitude && lng <= c.MaxLongitude
+	}
+
+	if inRange(lng, lat) && inCampus(lng, lat) {
+		return nil
+	}
+	if inRange(lat, lng) && inCampus(lat, lng) {
+		return fmt.Errorf("(%f, %f) looks like latitude, longitude; coordinates must be longitude, latitude", lng, lat)
+	}
+	if !inRange(lng, lat) {
+		return fmt.Errorf("(%f, %f) is not a valid longitude, latitude", lng, lat)
+	}
+	return fmt.Errorf("(%f, %f) is outside the campus bounding box", lng, lat)
+}
+
+// distance 计算两个 [经度, 纬度] 点之间的球面距离（米）
+func distance(a, b []float64) float64 {
+	const earthRadius = 6371000.0
+	lat1 := a[1] * math.Pi / 180
+	lat2 := b[1] * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b[0] - a[0]) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,140 @@
+package geodata
+
+import (
+	"encoding/json"
+	"io"
+	"login/log_service"
+	"net/http"
+	"strings"
+)
+
+// 导入文件的大小上限
+const maxImportBytes = 10 << 20
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Routes []int `json:"routes"` // 导入的线路编号
+	Sites  []int `json:"sites"`  // 导入的站点编号
+	Saved  bool  `json:"saved"`  // dry_run 时为 false
+}
+
+// RegisterRoutes 注册 HTTP 路由
+func RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/geo/export", HandleExport)
+	mux.HandleFunc("/admin/geo/import", HandleImport)
+}
+
+// filterLayer 按 layer 参数只保留线路或站点，为空时保留全部
+func filterLayer(d *Dataset, layer string) bool {
+	switch layer {
+	case "":
+	case "routes":
+		d.Sites = nil
+	case "sites":
+		d.Routes = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// HandleExport 导出线路与站点
+// 参数：format（geojson、kml、gpx）、layer（routes、sites，可选）
+func HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	codec, err := CodecFor(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := Load()
+	if err != nil {
+		log_service.GeodataLogger.Printf("导出时读取线路与站点失败：%v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !filterLayer(d, r.URL.Query().Get("layer")) {
+		http.Error(w, "Invalid layer, expected routes or sites", http.StatusBadRequest)
+		return
+	}
+	data, err := codec.Encode(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="campus.`+codec.Extension()+`"`)
+	w.Write(data)
+}
+
+// HandleImport 导入线路与站点，全部通过校验后才会写入
+// 参数：format（geojson、kml、gpx）、layer（routes、sites，可选）、shape（closed、open，可选）、dry_run（为 true 时只校验）
+// 请求体为文件内容，或 multipart 表单中的 file 字段
+func HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	codec, err := CodecFor(query.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = io.LimitReader(file, maxImportBytes)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	d, err := codec.Decode(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !filterLayer(d, query.Get("layer")) {
+		http.Error(w, "Invalid layer, expected routes or sites", http.StatusBadRequest)
+		return
+	}
+	if err := Validate(d, query.Get("shape")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := ImportResult{Routes: []int{}, Sites: []int{}}
+	for _, route := range d.Routes {
+		result.Routes = append(result.Routes, route.ID)
+	}
+	for _, site := range d.Sites {
+		result.Sites = append(result.Sites, site.ID)
+	}
+	if query.Get("dry_run") != "true" {
+		if err := Save(d); err != nil {
+			log_service.GeodataLogger.Printf("导入线路与站点失败：%v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Saved = true
+		log_service.GeodataLogger.Printf("从 %s 文件导入了 %d 条线路、%d 个站点\n", codec.Extension(), len(d.Routes), len(d.Sites))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
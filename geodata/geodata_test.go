@@ -0,0 +1,81 @@
+package geodata
+
+import (
+	"login/config"
+	"login/websocket"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	saved := config.AppConfig.GPS.Filter
+	t.Cleanup(func() { config.AppConfig.GPS.Filter = saved })
+
+	// 约 0.0001 度（11 米）以内的首尾视为闭合
+	loop := [][]float64{{121.4, 31.2}, {121.41, 31.2}, {121.41, 31.21}, {121.4, 31.2001}}
+	line := [][]float64{{121.4, 31.2}, {121.41, 31.2}, {121.41, 31.21}}
+	campus := config.FilterConfig{MinLatitude: 31, MaxLatitude: 32, MinLongitude: 121, MaxLongitude: 122}
+
+	tests := []struct {
+		name     string
+		routes   []websocket.Route
+		sites    []websocket.Site
+		shape    string
+		filter   config.FilterConfig
+		wantErr  string // 为空表示应通过校验
+		wantPath [][]float64
+	}{
+		{name: "duplicate points are dropped",
+			routes:   []websocket.Route{{ID: 1, Path: [][]float64{{121.4, 31.2}, {121.4, 31.2}, {121.41, 31.2}}}},
+			wantPath: [][]float64{{121.4, 31.2}, {121.41, 31.2}}},
+		{name: "closed line is snapped", routes: []websocket.Route{{ID: 1, Path: loop}}, shape: ShapeClosed,
+			wantPath: [][]float64{{121.4, 31.2}, {121.41, 31.2}, {121.41, 31.21}, {121.4, 31.2}}},
+		{name: "open line", routes: []websocket.Route{{ID: 1, Path: line}}, shape: ShapeOpen, wantPath: line},
+		{name: "inside campus", routes: []websocket.Route{{ID: 1, Path: line}}, filter: campus, wantPath: line},
+		{name: "missing route id", routes: []websocket.Route{{Path: line}}, wantErr: "missing route id"},
+		{name: "duplicated route id", routes: []websocket.Route{{ID: 1, Path: line}, {ID: 1, Path: line}},
+			wantErr: "duplicated route id"},
+		{name: "short point", routes: []websocket.Route{{ID: 1, Path: [][]float64{{121.4}, {121.41, 31.2}}}},
+			wantErr: "expected [longitude, latitude]"},
+		{name: "swapped coordinates", routes: []websocket.Route{{ID: 1, Path: [][]float64{{31.2, 121.4}, {31.21, 121.4}}}},
+			wantErr: "looks like latitude, longitude"},
+		{name: "out of range", routes: []websocket.Route{{ID: 1, Path: [][]float64{{200, 100}, {121.4, 31.2}}}},
+			wantErr: "not a valid longitude, latitude"},
+		{name: "outside campus", routes: []websocket.Route{{ID: 1, Path: [][]float64{{120, 30}, {121.4, 31.2}}}},
+			filter: campus, wantErr: "outside the campus bounding box"},
+		{name: "single distinct point", routes: []websocket.Route{{ID: 1, Path: [][]float64{{121.4, 31.2}, {121.4, 31.2}}}},
+			wantErr: "at least two distinct points"},
+		{name: "open line where closed expected", routes: []websocket.Route{{ID: 1, Path: line}}, shape: ShapeClosed,
+			wantErr: "expected a closed line"},
+		{name: "closed line where open expected", routes: []websocket.Route{{ID: 1, Path: loop}}, shape: ShapeOpen,
+			wantErr: "expected an open line"},
+		{name: "unknown shape", routes: []websocket.Route{{ID: 1, Path: line}}, shape: "round", wantErr: "unknown shape"},
+		{name: "valid sites", sites: []websocket.Site{{ID: 1, Location: websocket.Location{Longitude: 121.4, Latitude: 31.2}}}},
+		{name: "missing site id", sites: []websocket.Site{{Name: "图书馆", Location: websocket.Location{Longitude: 121.4, Latitude: 31.2}}},
+			wantErr: "site #1 (图书馆): missing site id"},
+		{name: "duplicated site id", sites: []websocket.Site{
+			{ID: 2, Location: websocket.Location{Longitude: 121.4, Latitude: 31.2}},
+			{ID: 2, Location: websocket.Location{Longitude: 121.41, Latitude: 31.2}},
+		}, wantErr: "site 2: duplicated site id"},
+		{name: "swapped site", sites: []websocket.Site{{ID: 3, Location: websocket.Location{Longitude: 31.2, Latitude: 121.4}}},
+			wantErr: "site 3: (31.200000, 121.400000) looks like latitude, longitude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig.GPS.Filter = tt.filter
+			d := &Dataset{Routes: tt.routes, Sites: tt.sites}
+			err := Validate(d, tt.shape)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantPath != nil && !reflect.DeepEqual(d.Routes[0].Path, tt.wantPath) {
+				t.Errorf("path = %v, want %v", d.Routes[0].Path, tt.wantPath)
+			}
+		})
+	}
+}
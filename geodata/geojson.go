@@ -0,0 +1,122 @@
+package geodata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login/websocket"
+)
+
+// GeoJSON 要素集合，坐标顺序为 [经度, 纬度]
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Geometry   geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type geoJSONCodec struct{}
+
+func (geoJSONCodec) ContentType() string { return "application/geo+json" }
+func (geoJSONCodec) Extension() string   { return "geojson" }
+
+// Encode 线路导出为 LineString，站点导出为 Point
+func (geoJSONCodec) Encode(d *Dataset) ([]byte, error) {
+	fc := featureCollection{Type: "FeatureCollection", Features: []feature{}}
+	for _, route := range d.Routes {
+		coordinates, _ := json.Marshal(route.Path)
+		fc.Features = append(fc.Features, feature{
+			Type:       "Feature",
+			Geometry:   geometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]interface{}{"kind": "route", "route_id": route.ID},
+		})
+	}
+	for _, site := range d.Sites {
+		coordinates, _ := json.Marshal([]float64{site.Location.Longitude, site.Location.Latitude})
+		fc.Features = append(fc.Features, feature{
+			Type:     "Feature",
+			Geometry: geometry{Type: "Point", Coordinates: coordinates},
+			Properties: map[string]interface{}{
+				"kind":           "site",
+				"site_id":        site.ID,
+				"name":           site.Name,
+				"site_passenger": site.SitePassenger,
+				"is_used":        site.IsUsed,
+				"site_note":      site.Note,
+			},
+		})
+	}
+	return json.MarshalIndent(fc, "", "  ")
+}
+
+// Decode 读取 LineString（线路）与 Point（站点）要素，其他几何类型视为错误
+func (geoJSONCodec) Decode(data []byte) (*Dataset, error) {
+	var fc featureCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, errors.New("GeoJSON must be a FeatureCollection")
+	}
+
+	d := &Dataset{}
+	for i, f := range fc.Features {
+		switch f.Geometry.Type {
+		case "LineString":
+			var path [][]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &path); err != nil {
+				return nil, fmt.Errorf("feature %d: invalid LineString coordinates: %v", i+1, err)
+			}
+			d.Routes = append(d.Routes, websocket.Route{ID: intProperty(f.Properties, "route_id"), Path: path})
+		case "Point":
+			var point []float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &point); err != nil || len(point) < 2 {
+				return nil, fmt.Errorf("feature %d: invalid Point coordinates", i+1)
+			}
+			d.Sites = append(d.Sites, websocket.Site{
+				ID:            intProperty(f.Properties, "site_id"),
+				Name:          stringProperty(f.Properties, "name"),
+				Location:      websocket.Location{Longitude: point[0], Latitude: point[1]},
+				SitePassenger: intProperty(f.Properties, "site_passenger"),
+				IsUsed:        intPropertyOr(f.Properties, "is_used", 1),
+				Note:          stringProperty(f.Properties, "site_note"),
+			})
+		default:
+			return nil, fmt.Errorf("feature %d: unsupported geometry %q, expected LineString or Point", i+1, f.Geometry.Type)
+		}
+	}
+	return d, nil
+}
+
+func intProperty(properties map[string]interface{}, key string) int {
+	return intPropertyOr(properties, key, 0)
+}
+
+func intPropertyOr(properties map[string]interface{}, key string, fallback int) int {
+	switch v := properties[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		var n int
+		if _, err := fmt.Sscanf(v, "%d", &n); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func stringProperty(properties map[string]interface{}, key string) string {
+	if v, ok := properties[key].(string); ok {
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package geodata
+
+import (
+	"encoding/xml"
+	"fmt"
+	"login/websocket"
+	"strconv"
+	"strings"
+)
+
+// GPX 1.1：线路导出为 rte（编号保存在 number 中），站点导出为 wpt（编号保存在 extensions 中）
+// 导入时同时接受 rte 与 trk
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Routes    []gpxRoute    `xml:"rte"`
+	Tracks    []gpxTrack    `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type gpxWaypoint struct {
+	gpxPoint
+	Name       string        `xml:"name"`
+	Desc       string        `xml:"desc,omitempty"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+type gpxExtensions struct {
+	SiteID        int  `xml:"site_id,omitempty"`
+	SitePassenger int  `xml:"site_passenger,omitempty"`
+	IsUsed        *int `xml:"is_used"`
+}
+
+type gpxRoute struct {
+	Name   string     `xml:"name,omitempty"`
+	Number int        `xml:"number,omitempty"`
+	Points []gpxPoint `xml:"rtept"`
+}
+
+type gpxTrack struct {
+	Name     string `xml:"name,omitempty"`
+	Number   int    `xml:"number,omitempty"`
+	Segments []struct {
+		Points []gpxPoint `xml:"trkpt"`
+	} `xml:"trkseg"`
+}
+
+type gpxCodec struct{}
+
+func (gpxCodec) ContentType() string { return "application/gpx+xml" }
+func (gpxCodec) Extension() string   { return "gpx" }
+
+func (gpxCodec) Encode(d *Dataset) ([]byte, error) {
+	doc := gpxDocument{Version: "1.1", Creator: "campus bus", Xmlns: "http://www.topografix.com/GPX/1/1"}
+	for _, site := range d.Sites {
+		isUsed := site.IsUsed
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+			gpxPoint:   gpxPoint{Lat: site.Location.Latitude, Lon: site.Location.Longitude},
+			Name:       site.Name,
+			Desc:       site.Note,
+			Extensions: gpxExtensions{SiteID: site.ID, SitePassenger: site.SitePassenger, IsUsed: &isUsed},
+		})
+	}
+	for _, route := range d.Routes {
+		r := gpxRoute{Name: fmt.Sprintf("route %d", route.ID), Number: route.ID}
+		for _, pt := range route.Path {
+			r.Points = append(r.Points, gpxPoint{Lat: pt[1], Lon: pt[0]})
+		}
+		doc.Routes = append(doc.Routes, r)
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func (gpxCodec) Decode(data []byte) (*Dataset, error) {
+	var doc gpxDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %v", err)
+	}
+
+	d := &Dataset{}
+	for _, wpt := range doc.Waypoints {
+		isUsed := 1
+		if wpt.Extensions.IsUsed != nil {
+			isUsed = *wpt.Extensions.IsUsed
+		}
+		d.Sites = append(d.Sites, websocket.Site{
+			ID:            wpt.Extensions.SiteID,
+			Name:          strings.TrimSpace(wpt.Name),
+			Location:      websocket.Location{Latitude: wpt.Lat, Longitude: wpt.Lon},
+			SitePassenger: wpt.Extensions.SitePassenger,
+			IsUsed:        isUsed,
+			Note:          strings.TrimSpace(wpt.Desc),
+		})
+	}
+	for _, rte := range doc.Routes {
+		d.Routes = append(d.Routes, websocket.Route{ID: gpxRouteID(rte.Number, rte.Name), Path: gpxPath(rte.Points)})
+	}
+	for _, trk := range doc.Tracks {
+		var points []gpxPoint
+		for _, segment := range trk.Segments {
+			points = append(points, segment.Points...)
+		}
+		d.Routes = append(d.Routes, websocket.Route{ID: gpxRouteID(trk.Number, trk.Name), Path: gpxPath(points)})
+	}
+	return d, nil
+}
+
+// gpxRouteID 优先使用 number，没有时取名称中的数字
+func gpxRouteID(number int, name string) int {
+	if number > 0 {
+		return number
+	}
+	id, _ := strconv.Atoi(nameNumber.FindString(name))
+	return id
+}
+
+// gpxPath GPX 的点以属性给出纬度与经度，转换为 [经度, 纬度]
+func gpxPath(points []gpxPoint) [][]float64 {
+	path := make([][]float64, 0, len(points))
+	for _, pt := range points {
+		path = append(path, []float64{pt.Lon, pt.Lat})
+	}
+	return path
+}
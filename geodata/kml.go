@@ -0,0 +1,159 @@
+package geodata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"login/websocket"
+	"strconv"
+	"strings"
+)
+
+// KML 中的 Placemark，LineString 为线路，Point 为站点，编号等属性保存在 ExtendedData 中
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	LineString  *kmlCoord `xml:"LineString"`
+	Point       *kmlCoord `xml:"Point"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlCoord struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Xmlns      string         `xml:"xmlns,attr"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlCodec struct{}
+
+func (kmlCodec) ContentType() string { return "application/vnd.google-earth.kml+xml" }
+func (kmlCodec) Extension() string   { return "kml" }
+
+func (kmlCodec) Encode(d *Dataset) ([]byte, error) {
+	doc := kmlDocument{Xmlns: "http://www.opengis.net/kml/2.2", Name: "campus bus"}
+	for _, route := range d.Routes {
+		coordinates := make([]string, 0, len(route.Path))
+		for _, pt := range route.Path {
+			coordinates = append(coordinates, formatLngLat(pt[0], pt[1]))
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:       fmt.Sprintf("route %d", route.ID),
+			Data:       []kmlData{{Name: "route_id", Value: strconv.Itoa(route.ID)}},
+			LineString: &kmlCoord{Coordinates: strings.Join(coordinates, " ")},
+		})
+	}
+	for _, site := range d.Sites {
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:        site.Name,
+			Description: site.Note,
+			Data: []kmlData{
+				{Name: "site_id", Value: strconv.Itoa(site.ID)},
+				{Name: "site_passenger", Value: strconv.Itoa(site.SitePassenger)},
+				{Name: "is_used", Value: strconv.Itoa(site.IsUsed)},
+			},
+			Point: &kmlCoord{Coordinates: formatLngLat(site.Location.Longitude, site.Location.Latitude)},
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Decode 读取文档中任意层级（包括 Folder 内）的 Placemark
+func (kmlCodec) Decode(data []byte) (*Dataset, error) {
+	d := &Dataset{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+
+		var pm kmlPlacemark
+		if err := decoder.DecodeElement(&pm, &start); err != nil {
+			return nil, fmt.Errorf("invalid KML placemark: %v", err)
+		}
+		values := make(map[string]string)
+		for _, item := range pm.Data {
+			values[item.Name] = strings.TrimSpace(item.Value)
+		}
+
+		switch {
+		case pm.LineString != nil:
+			path, err := parseKMLCoordinates(pm.LineString.Coordinates)
+			if err != nil {
+				return nil, fmt.Errorf("placemark %q: %v", pm.Name, err)
+			}
+			id, _ := strconv.Atoi(values["route_id"])
+			if id == 0 {
+				id, _ = strconv.Atoi(nameNumber.FindString(pm.Name))
+			}
+			d.Routes = append(d.Routes, websocket.Route{ID: id, Path: path})
+		case pm.Point != nil:
+			points, err := parseKMLCoordinates(pm.Point.Coordinates)
+			if err != nil || len(points) != 1 {
+				return nil, fmt.Errorf("placemark %q: invalid Point coordinates", pm.Name)
+			}
+			id, _ := strconv.Atoi(values["site_id"])
+			passenger, _ := strconv.Atoi(values["site_passenger"])
+			isUsed, err := strconv.Atoi(values["is_used"])
+			if err != nil {
+				isUsed = 1
+			}
+			d.Sites = append(d.Sites, websocket.Site{
+				ID:            id,
+				Name:          strings.TrimSpace(pm.Name),
+				Location:      websocket.Location{Longitude: points[0][0], Latitude: points[0][1]},
+				SitePassenger: passenger,
+				IsUsed:        isUsed,
+				Note:          strings.TrimSpace(pm.Description),
+			})
+		default:
+			return nil, fmt.Errorf("placemark %q: unsupported geometry, expected LineString or Point", pm.Name)
+		}
+	}
+	return d, nil
+}
+
+// parseKMLCoordinates 解析 "经度,纬度[,高度] ..." 格式的坐标
+func parseKMLCoordinates(s string) ([][]float64, error) {
+	var path [][]float64
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid coordinate %q", tuple)
+		}
+		lng, err1 := strconv.ParseFloat(parts[0], 64)
+		lat, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", tuple)
+		}
+		path = append(path, []float64{lng, lat})
+	}
+	return path, nil
+}
+
+func formatLngLat(lng, lat float64) string {
+	return strconv.FormatFloat(lng, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+}
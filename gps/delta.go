@@ -0,0 +1,101 @@
+package gps
+
+import (
+	"encoding/json"
+	"login/websocket"
+)
+
+// DriverDelta 推送给已订阅客户端的驾驶员位置消息
+// Full 为 true 时 Drivers 为订阅范围内的完整快照，否则只包含上次推送后有变化的驾驶员
+type DriverDelta struct {
+	Type    string    `json:"type"`    // 固定为 "driver_gps_delta"
+	Full    bool      `json:"full"`    // 是否为完整快照
+	Drivers []*Driver `json:"drivers"` // 位置或状态有变化的驾驶员
+	Removed []string  `json:"removed"` // 已下线或不再符合订阅条件的驾驶员 ID
+}
+
+// driverChanged 判断驾驶员相对上次广播是否有需要推送的变化
+func driverChanged(previous, current Driver) bool {
+	return previous.Location != current.Location ||
+		previous.Status != current.Status ||
+		previous.Car_ID != current.Car_ID ||
+		previous.RouteID != current.RouteID ||
+		previous.SmoothedSpeed != current.SmoothedSpeed ||
+		previous.Heading != current.Heading ||
+		previous.Occupancy != current.Occupancy
+}
+
+// diffDrivers 与上次广播的状态比较，返回有变化的驾驶员和已下线的驾驶员 ID，并记录本次状态
+// 只在广播协程中调用
+func (g *GPSModule) diffDrivers(drivers []*Driver) (changed []*Driver, removed []string) {
+	current := make(map[string]Driver, len(drivers))
+	for _, driver := range drivers {
+		current[driver.ID] = *driver
+		if previous, exists := g.lastBroadcast[driver.ID]; !exists || driverChanged(previous, *driver) {
+			changed = append(changed, driver)
+		}
+	}
+	for id := range g.lastBroadcast {
+		if _, exists := current[id]; !exists {
+			removed = append(removed, id)
+		}
+	}
+	g.lastBroadcast = current
+	return changed, removed
+}
+
+// buildDelta 针对一个订阅生成增量消息，没有相关变化时返回 nil
+// 变化后不再符合订阅条件（换线路或换车）的驾驶员与已下线的驾驶员一样，只要之前推送过就放入 removed
+func buildDelta(sub *websocket.GPSSubscription, changed []*Driver, removed []string) []byte {
+	delta := DriverDelta{Type: "driver_gps_delta", Drivers: make([]*Driver, 0), Removed: make([]string, 0)}
+	sub.WithSent(func(sent map[string]bool) {
+		for _, driver := range changed {
+			if sub.Matches(driver.RouteID, driver.Car_ID) {
+				delta.Drivers = append(delta.Drivers, driver)
+				sent[driver.ID] = true
+			} else if sent[driver.ID] {
+				delta.Removed = append(delta.Removed, driver.ID)
+				delete(sent, driver.ID)
+			}
+		}
+		for _, id := range removed {
+			if sent[id] {
+				delta.Removed = append(delta.Removed, id)
+				delete(sent, id)
+			}
+		}
+	})
+	if len(delta.Drivers) == 0 && len(delta.Removed) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// DriverSnapshot 生成订阅范围内所有驾驶员的完整快照，客户端订阅时调用
+func (g *GPSModule) DriverSnapshot(sub *websocket.GPSSubscription) []byte {
+	snapshot := DriverDelta{Type: "driver_gps_delta", Full: true, Drivers: make([]*Driver, 0), Removed: make([]string, 0)}
+	drivers := g.GetAllDrivers()
+	sub.WithSent(func(sent map[string]bool) {
+		// 完整快照替换客户端已有的全部驾驶员
+		for id := range sent {
+			delete(sent, id)
+		}
+		for _, driver := range drivers {
+			if sub.Matches(driver.RouteID, driver.Car_ID) {
+				snapshot.Drivers = append(snapshot.Drivers, driver)
+				sent[driver.ID] = true
+			}
+		}
+	})
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil
+	}
+	return data
+}
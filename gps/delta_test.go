@@ -0,0 +1,78 @@
+package gps
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"login/log_service"
+	"login/websocket"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 测试不写 application.log
+	log_service.GPSLogger = log.New(io.Discard, "", 0)
+	log_service.WebSocketLogger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// decodeDelta 解析 buildDelta 的结果，返回推送的驾驶员 ID 与移除的 ID
+func decodeDelta(t *testing.T, data []byte) (drivers, removed []string) {
+	t.Helper()
+	if data == nil {
+		return nil, nil
+	}
+	var delta DriverDelta
+	if err := json.Unmarshal(data, &delta); err != nil {
+		t.Fatalf("bad delta %s: %v", data, err)
+	}
+	if delta.Type != "driver_gps_delta" || delta.Full {
+		t.Errorf("delta header = %q full=%v", delta.Type, delta.Full)
+	}
+	for _, d := range delta.Drivers {
+		drivers = append(drivers, d.ID)
+	}
+	if len(delta.Removed) > 0 {
+		removed = delta.Removed
+	}
+	return drivers, removed
+}
+
+func TestBuildDelta(t *testing.T) {
+	sub := &websocket.GPSSubscription{Routes: map[int]bool{1: true}, Cars: map[string]bool{"沪B2": true}}
+	onRoute := &Driver{ID: "d1", Car_ID: "沪A1", RouteID: 1}
+	byCar := &Driver{ID: "d2", Car_ID: "沪B2", RouteID: 2}
+	other := &Driver{ID: "d3", Car_ID: "沪C3", RouteID: 3}
+
+	steps := []struct {
+		name        string
+		changed     []*Driver
+		removed     []string
+		wantDrivers []string
+		wantRemoved []string
+	}{
+		{"matching drivers are sent", []*Driver{onRoute, byCar, other}, nil, []string{"d1", "d2"}, nil},
+		{"no relevant change", []*Driver{other}, []string{"d3"}, nil, nil},
+		{"driver leaves the subscription", []*Driver{{ID: "d1", Car_ID: "沪A1", RouteID: 3}}, nil, nil, []string{"d1"}},
+		{"left driver is not removed twice", []*Driver{{ID: "d1", Car_ID: "沪A1", RouteID: 3}}, []string{"d1"}, nil, nil},
+		{"driver goes offline", nil, []string{"d2"}, nil, []string{"d2"}},
+		{"driver comes back", []*Driver{onRoute}, nil, []string{"d1"}, nil},
+	}
+	for _, step := range steps {
+		drivers, removed := decodeDelta(t, buildDelta(sub, step.changed, step.removed))
+		if !reflect.DeepEqual(drivers, step.wantDrivers) || !reflect.DeepEqual(removed, step.wantRemoved) {
+			t.Errorf("%s: drivers=%v removed=%v, want drivers=%v removed=%v",
+				step.name, drivers, removed, step.wantDrivers, step.wantRemoved)
+		}
+	}
+}
+
+func TestBuildDeltaEmptySubscriptionMatchesAll(t *testing.T) {
+	sub := &websocket.GPSSubscription{}
+	drivers, removed := decodeDelta(t, buildDelta(sub, []*Driver{{ID: "d1", RouteID: 7}, {ID: "d2"}}, []string{"unknown"}))
+	if !reflect.DeepEqual(drivers, []string{"d1", "d2"}) || len(removed) != 0 {
+		t.Errorf("drivers=%v removed=%v, want all drivers and no removals", drivers, removed)
+	}
+}
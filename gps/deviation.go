@@ -0,0 +1,162 @@
+package gps
+
+import (
+	"login/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// 偏离路线告警类型
+const (
+	AlertRouteDeviation        = "route_deviation"
+	AlertRouteDeviationCleared = "route_deviation_cleared"
+)
+
+// DeviationAlert 偏离路线告警，推送给管理员客户端
+type DeviationAlert struct {
+	Type         string   `json:"type"`              // route_deviation 或 route_deviation_cleared
+	DriverID     string   `json:"driver_id"`         // 驾驶员编号
+	CarID        string   `json:"car_id"`            // 车牌号
+	RouteID      int      `json:"route_id"`          // 线路编号
+	Location     Location `json:"location"`          // 当前位置
+	OffsetMeters float64  `json:"offset_meters"`     // 当前距路线的距离（米）
+	MaxOffset    float64  `json:"max_offset_meters"` // 本次偏离的最大距离（米）
+	Since        string   `json:"since"`             // 开始偏离的时间
+	Time         string   `json:"time"`              // 告警时间
+	IncidentID   int64    `json:"incident_id"`       // 对应 incident_table 中的记录
+
+	started time.Time // 开始偏离的时间，作为事件记录的开始时间
+}
+
+// deviationState 单个驾驶员的偏离状态
+type deviationState struct {
+	offSince   time.Time // 开始偏离的时间，零值表示当前在路线上
+	maxOffset  float64   // 本次偏离的最大距离
+	alerted    bool      // 是否已经告警
+	incidentID int64
+	current    DeviationAlert // 告警后的最新状态，供 Active 使用
+}
+
+// DeviationDetector 将驾驶员位置与所分配线路的折线比较，持续偏离时产生告警
+type DeviationDetector struct {
+	mu     sync.Mutex
+	routes *routeCache
+	states map[string]*deviationState
+}
+
+// NewDeviationDetector 创建偏离路线检测器
+func NewDeviationDetector(routes *routeCache) *DeviationDetector {
+	return &DeviationDetector{
+		routes: routes,
+		states: make(map[string]*deviationState),
+	}
+}
+
+// deviationThresholds 返回偏离距离阈值与持续时间阈值
+func deviationThresholds() (float64, time.Duration) {
+	c := config.AppConfig.GPS.Deviation
+	maxOffset := c.MaxOffsetMeters
+	if maxOffset <= 0 {
+		maxOffset = 50
+	}
+	minDuration := c.MinDurationSeconds
+	if minDuration <= 0 {
+		minDuration = 30
+	}
+	return maxOffset, time.Duration(minDuration) * time.Second
+}
+
+// Update 根据驾驶员的最新位置更新偏离状态，返回本次产生的告警
+func (d *DeviationDetector) Update(driver Driver, now time.Time) []DeviationAlert {
+	if driver.RouteID == 0 {
+		return nil
+	}
+	geometry := d.routes.route(driver.RouteID)
+	if geometry == nil {
+		return nil
+	}
+	_, offset := geometry.Line.project(driver.Location)
+	maxOffset, minDuration := deviationThresholds()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, exists := d.states[driver.ID]
+	if !exists {
+		state = &deviationState{}
+		d.states[driver.ID] = state
+	}
+
+	newAlert := func(alertType string) DeviationAlert {
+		return DeviationAlert{
+			Type:         alertType,
+			DriverID:     driver.ID,
+			CarID:        driver.Car_ID,
+			RouteID:      driver.RouteID,
+			Location:     driver.Location,
+			OffsetMeters: math.Round(offset),
+			MaxOffset:    math.Round(state.maxOffset),
+			Since:        state.offSince.Format("2006-01-02 15:04:05"),
+			Time:         now.Format("2006-01-02 15:04:05"),
+			IncidentID:   state.incidentID,
+			started:      state.offSince,
+		}
+	}
+
+	if offset <= maxOffset {
+		// 回到路线上
+		var alerts []DeviationAlert
+		if state.alerted {
+			alerts = append(alerts, newAlert(AlertRouteDeviationCleared))
+		}
+		*state = deviationState{}
+		return alerts
+	}
+
+	if state.offSince.IsZero() {
+		state.offSince = now
+	}
+	state.maxOffset = math.Max(state.maxOffset, offset)
+	if state.alerted {
+		state.current = newAlert(AlertRouteDeviation)
+		return nil
+	}
+	if now.Sub(state.offSince) < minDuration {
+		return nil
+	}
+	state.alerted = true
+	state.current = newAlert(AlertRouteDeviation)
+	return []DeviationAlert{state.current}
+}
+
+// Active 获取当前仍在偏离路线的告警
+func (d *DeviationDetector) Active() []DeviationAlert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	alerts := make([]DeviationAlert, 0)
+	for _, state := range d.states {
+		if state.alerted {
+			alerts = append(alerts, state.current)
+		}
+	}
+	return alerts
+}
+
+// SetIncident 关联本次偏离对应的事件记录编号
+func (d *DeviationDetector) SetIncident(driverID string, incidentID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if state, exists := d.states[driverID]; exists {
+		state.incidentID = incidentID
+		state.current.IncidentID = incidentID
+	}
+}
+
+// Remove 移除驾驶员的偏离状态（下班时调用）
+func (d *DeviationDetector) Remove(driverID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.states, driverID)
+}
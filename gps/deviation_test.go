@@ -0,0 +1,85 @@
+package gps
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviationDetectorUpdate(t *testing.T) {
+	detector := NewDeviationDetector(testRouteCache())
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	// 路线沿赤道向东，纬度每 0.001 度约 111 米；默认偏离 50 米、持续 30 秒后告警
+	onRoute := Location{Latitude: 0.0001, Longitude: 0.02}
+	offRoute := Location{Latitude: 0.001, Longitude: 0.02}
+	update := func(loc Location, seconds int) []DeviationAlert {
+		return detector.Update(Driver{ID: "d1", Car_ID: "沪A1", RouteID: 1, Location: loc}, start.Add(time.Duration(seconds)*time.Second))
+	}
+
+	steps := []struct {
+		name     string
+		loc      Location
+		seconds  int
+		wantType string // 为空表示不应产生告警
+	}{
+		{"on route", onRoute, 0, ""},
+		{"starts deviating", offRoute, 10, ""},
+		{"not long enough", offRoute, 39, ""},
+		{"deviation confirmed", offRoute, 40, AlertRouteDeviation},
+		{"alerted only once", offRoute, 60, ""},
+		{"back on route", onRoute, 70, AlertRouteDeviationCleared},
+		{"stays on route", onRoute, 80, ""},
+	}
+	for _, step := range steps {
+		alerts := update(step.loc, step.seconds)
+		if step.wantType == "" {
+			if len(alerts) != 0 {
+				t.Fatalf("%s: unexpected alerts %+v", step.name, alerts)
+			}
+			continue
+		}
+		if len(alerts) != 1 || alerts[0].Type != step.wantType {
+			t.Fatalf("%s: alerts = %+v, want one %s", step.name, alerts, step.wantType)
+		}
+		alert := alerts[0]
+		// 事件从开始偏离时算起，而不是确认告警的时间
+		if alert.Since != "2024-01-01 08:00:10" || !alert.started.Equal(start.Add(10*time.Second)) {
+			t.Errorf("%s: since = %s started = %v, want the first off-route fix", step.name, alert.Since, alert.started)
+		}
+		if alert.MaxOffset < 100 || alert.MaxOffset > 120 || alert.RouteID != 1 || alert.CarID != "沪A1" {
+			t.Errorf("%s: alert = %+v", step.name, alert)
+		}
+	}
+}
+
+func TestDeviationDetectorActiveAndIncident(t *testing.T) {
+	detector := NewDeviationDetector(testRouteCache())
+	start := time.Now()
+	offRoute := Location{Latitude: 0.001, Longitude: 0.02}
+	detector.Update(Driver{ID: "d1", RouteID: 1, Location: offRoute}, start)
+	detector.Update(Driver{ID: "d1", RouteID: 1, Location: offRoute}, start.Add(time.Minute))
+	detector.SetIncident("d1", 42)
+
+	active := detector.Active()
+	if len(active) != 1 || active[0].DriverID != "d1" || active[0].IncidentID != 42 {
+		t.Fatalf("active = %+v, want d1 with incident 42", active)
+	}
+	cleared := detector.Update(Driver{ID: "d1", RouteID: 1, Location: Location{Longitude: 0.02}}, start.Add(2*time.Minute))
+	if len(cleared) != 1 || cleared[0].IncidentID != 42 {
+		t.Errorf("cleared = %+v, want incident 42 to be closed", cleared)
+	}
+	if active := detector.Active(); len(active) != 0 {
+		t.Errorf("active after clearing = %+v", active)
+	}
+}
+
+func TestDeviationDetectorIgnoresUnknownRoutes(t *testing.T) {
+	detector := NewDeviationDetector(testRouteCache())
+	far := Location{Latitude: 1, Longitude: 1}
+	for _, routeID := range []int{0, 99} {
+		for i := 0; i < 3; i++ {
+			if alerts := detector.Update(Driver{ID: "d1", RouteID: routeID, Location: far}, time.Now().Add(time.Duration(i)*time.Minute)); len(alerts) != 0 {
+				t.Errorf("route %d: alerts = %+v", routeID, alerts)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package gps
+
+import (
+	"login/config"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 车辆距路线超过该距离时认为无法吸附到路线上，不参与到站预测
+const etaMaxSnapOffset = 150.0
+
+// SiteETA 某辆车到达某个站点的预测
+type SiteETA struct {
+	SiteID     int     `json:"site_id"`     // 站点编号
+	SiteName   string  `json:"site_name"`   // 站点名称
+	DriverID   string  `json:"driver_id"`   // 驾驶员编号
+	CarID      string  `json:"car_id"`      // 车牌号
+	RouteID    int     `json:"route_id"`    // 线路编号
+	Distance   float64 `json:"distance"`    // 沿线剩余距离（米）
+	ETASeconds int     `json:"eta_seconds"` // 预计还需多少秒到达
+	ArriveAt   string  `json:"arrive_at"`   // 预计到达时间
+}
+
+// ETAMessage 通过 WebSocket 推送的到站预测消息
+type ETAMessage struct {
+	Type string    `json:"type"` // 固定为 "eta"
+	ETAs []SiteETA `json:"etas"`
+}
+
+// driverProgress 驾驶员在路线上的行驶进度
+type driverProgress struct {
+	DriverID string
+	CarID    string
+	RouteID  int
+	Along    float64   // 当前沿线距离（米）
+	At       time.Time // 最近一次吸附成功的时间
+	Speed    float64   // 平滑后的沿线速度（米/秒），0 表示尚未观测到
+}
+
+// ETAEngine 将驾驶员吸附到路线折线上，并根据观测速度预测到达各站点的时间
+type ETAEngine struct {
+	mu       sync.Mutex
+	routes   *routeCache
+	progress map[string]*driverProgress
+}
+
+// NewETAEngine 创建到站预测引擎
+func NewETAEngine(routes *routeCache) *ETAEngine {
+	return &ETAEngine{
+		routes:   routes,
+		progress: make(map[string]*driverProgress),
+	}
+}
+
+// defaultSpeed 尚未观测到车速时使用的默认速度（米/秒）
+func defaultSpeed() float64 {
+	if v := config.AppConfig.GPS.ETA.DefaultSpeedKmh; v > 0 {
+		return v / 3.6
+	}
+	return 15 / 3.6
+}
+
+// smoothingFactor 观测速度的指数平滑系数
+func smoothingFactor() float64 {
+	if v := config.AppConfig.GPS.ETA.SmoothingFactor; v > 0 && v <= 1 {
+		return v
+	}
+	return 0.3
+}
+
+// Update 根据驾驶员的最新位置更新其在路线上的进度
+func (e *ETAEngine) Update(driver Driver, now time.Time) {
+	if driver.RouteID == 0 {
+		return
+	}
+	geometry := e.routes.route(driver.RouteID)
+	if geometry == nil {
+		return
+	}
+	along, offset := geometry.Line.project(driver.Location)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if offset > etaMaxSnapOffset {
+		// 偏离路线太远，保留之前的进度但不再更新
+		return
+	}
+
+	p, exists := e.progress[driver.ID]
+	if !exists || p.RouteID != driver.RouteID {
+		e.progress[driver.ID] = &driverProgress{
+			DriverID: driver.ID,
+			CarID:    driver.Car_ID,
+			RouteID:  driver.RouteID,
+			Along:    along,
+			At:       now,
+		}
+		return
+	}
+
+	dt := now.Sub(p.At).Seconds()
+	if dt > 0 {
+		delta := along - p.Along
+		// 环线经过起点时沿线距离会回绕
+		if length := geometry.Line.length(); geometry.Line.closed() && delta < -length/2 {
+			delta += length
+		}
+		// 只使用向前行驶的观测值，倒退多为 GPS 抖动
+		if delta >= 0 {
+			observed := delta / dt
+			if p.Speed == 0 {
+				p.Speed = observed
+			} else {
+				alpha := smoothingFactor()
+				p.Speed = alpha*observed + (1-alpha)*p.Speed
+			}
+		}
+	}
+	p.CarID = driver.Car_ID
+	p.Along = along
+	p.At = now
+}
+
+// Remove 移除驾驶员的行驶进度（下班时调用）
+func (e *ETAEngine) Remove(driverID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.progress, driverID)
+}
+
+// snapshot 复制所有驾驶员的行驶进度
+func (e *ETAEngine) snapshot() []driverProgress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	snapshot := make([]driverProgress, 0, len(e.progress))
+	for _, p := range e.progress {
+		snapshot = append(snapshot, *p)
+	}
+	return snapshot
+}
+
+// Predict 预测所有在线车辆到达其路线上各站点的时间，按站点编号和到达时间排序
+func (e *ETAEngine) Predict(now time.Time) []SiteETA {
+	etas := make([]SiteETA, 0)
+	for _, p := range e.snapshot() {
+		geometry := e.routes.route(p.RouteID)
+		if geometry == nil {
+			continue
+		}
+		speed := p.Speed
+		if speed < 0.5 {
+			// 车辆停靠或尚无观测时使用默认速度，避免预测时间无穷大
+			speed = defaultSpeed()
+		}
+		length := geometry.Line.length()
+		closed := geometry.Line.closed()
+
+		for _, stop := range geometry.Stops {
+			dist := stop.Along - p.Along
+			if dist < 0 {
+				if !closed {
+					continue // 非环线已经驶过的站点
+				}
+				dist += length
+			}
+			// 预测时间从最近一次定位时刻算起
+			seconds := dist/speed - now.Sub(p.At).Seconds()
+			seconds = math.Max(0, seconds)
+			etas = append(etas, SiteETA{
+				SiteID:     stop.Site.ID,
+				SiteName:   stop.Site.Name,
+				DriverID:   p.DriverID,
+				CarID:      p.CarID,
+				RouteID:    p.RouteID,
+				Distance:   math.Round(dist),
+				ETASeconds: int(math.Round(seconds)),
+				ArriveAt:   now.Add(time.Duration(seconds) * time.Second).Format("2006-01-02 15:04:05"),
+			})
+		}
+	}
+
+	sort.Slice(etas, func(i, j int) bool {
+		if etas[i].SiteID != etas[j].SiteID {
+			return etas[i].SiteID < etas[j].SiteID
+		}
+		return etas[i].ETASeconds < etas[j].ETASeconds
+	})
+	return etas
+}
+
+// PredictSite 预测到达指定站点的所有车辆，最先到达的排在最前
+func (e *ETAEngine) PredictSite(siteID int, now time.Time) []SiteETA {
+	etas := make([]SiteETA, 0)
+	for _, eta := range e.Predict(now) {
+		if eta.SiteID == siteID {
+			etas = append(etas, eta)
+		}
+	}
+	return etas
+}
@@ -0,0 +1,114 @@
+package gps
+
+import (
+	"login/config"
+	"login/websocket"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestETAEngineUpdate(t *testing.T) {
+	saved := config.AppConfig.GPS.ETA
+	config.AppConfig.GPS.ETA = config.ETAConfig{}
+	t.Cleanup(func() { config.AppConfig.GPS.ETA = saved })
+
+	cache := testRouteCache()
+	line := cache.routes[1].Line
+	engine := NewETAEngine(cache)
+	start := time.Now()
+	at := func(lon float64) Location { return Location{Longitude: lon} }
+	along := func(lon float64) float64 { a, _ := line.project(at(lon)); return a }
+	update := func(lon float64, seconds int) {
+		engine.Update(Driver{ID: "d1", Car_ID: "沪A1", RouteID: 1, Location: at(lon)}, start.Add(time.Duration(seconds)*time.Second))
+	}
+
+	engine.Update(Driver{ID: "d0", Location: at(0.01)}, start)                             // 没有线路
+	engine.Update(Driver{ID: "d2", RouteID: 2, Location: at(0.01)}, start)                 // 线路没有几何
+	engine.Update(Driver{ID: "d3", RouteID: 1, Location: Location{Latitude: 0.01}}, start) // 距路线约 1 公里
+	if progress := engine.snapshot(); len(progress) != 0 {
+		t.Fatalf("progress = %+v, want none", progress)
+	}
+
+	update(0.01, 0)
+	update(0.02, 100)
+	first := (along(0.02) - along(0.01)) / 100
+	update(0.01, 150) // 倒退视为抖动，不更新速度
+	update(0.02, 200)
+	want := 0.3*(along(0.02)-along(0.01))/50 + 0.7*first
+
+	progress := engine.snapshot()
+	if len(progress) != 1 {
+		t.Fatalf("progress = %+v, want one driver", progress)
+	}
+	if p := progress[0]; p.DriverID != "d1" || p.CarID != "沪A1" || math.Abs(p.Speed-want) > 1e-9 || p.Along != along(0.02) {
+		t.Errorf("progress = %+v, want speed %.3f at %.0f m", p, want, along(0.02))
+	}
+
+	engine.Remove("d1")
+	if progress := engine.snapshot(); len(progress) != 0 {
+		t.Errorf("progress after Remove = %+v", progress)
+	}
+}
+
+func TestETAEnginePredict(t *testing.T) {
+	saved := config.AppConfig.GPS.ETA
+	config.AppConfig.GPS.ETA = config.ETAConfig{DefaultSpeedKmh: 36}
+	t.Cleanup(func() { config.AppConfig.GPS.ETA = saved })
+
+	engine := NewETAEngine(testRouteCache())
+	now := time.Now()
+	engine.progress = map[string]*driverProgress{
+		"moving":  {DriverID: "moving", CarID: "沪A1", RouteID: 1, Along: 1000, At: now.Add(-10 * time.Second), Speed: 20},
+		"stopped": {DriverID: "stopped", CarID: "沪A2", RouteID: 1, Along: 3000, At: now, Speed: 0.2},
+		"passed":  {DriverID: "passed", CarID: "沪A3", RouteID: 1, Along: 4500, At: now, Speed: 10},
+		"late":    {DriverID: "late", CarID: "沪A4", RouteID: 1, Along: 3900, At: now.Add(-time.Minute), Speed: 10},
+	}
+
+	tests := []struct {
+		driverID string
+		distance float64
+		seconds  int
+	}{
+		{"late", 100, 0},       // 预测时间已过，不为负数
+		{"stopped", 1000, 100}, // 停靠时使用默认速度 10 米/秒
+		{"moving", 3000, 140},  // 从最近一次定位算起已经过去 10 秒
+	}
+	etas := engine.PredictSite(7, now)
+	if len(etas) != len(tests) {
+		t.Fatalf("etas = %+v, want %d (the passed stop is skipped)", etas, len(tests))
+	}
+	for i, tt := range tests {
+		eta := etas[i]
+		if eta.DriverID != tt.driverID || eta.Distance != tt.distance || eta.ETASeconds != tt.seconds ||
+			eta.SiteID != 7 || eta.SiteName != "中山路" || eta.RouteID != 1 {
+			t.Errorf("etas[%d] = %+v, want %s %.0f m in %d s", i, eta, tt.driverID, tt.distance, tt.seconds)
+		}
+	}
+	if etas := engine.PredictSite(8, now); len(etas) != 0 {
+		t.Errorf("unknown site etas = %+v", etas)
+	}
+}
+
+func TestETAEnginePredictClosedLoop(t *testing.T) {
+	line := newPolyline([][]float64{{0, 0}, {0.05, 0}, {0.05, 0.05}, {0, 0.05}, {0, 0}})
+	cache := &routeCache{
+		routes: map[int]*routeGeometry{
+			1: {ID: 1, Line: line, Stops: []routeStop{{Site: websocket.Site{ID: 7}, Along: 1000}}},
+		},
+		loadedAt: time.Now(),
+		version:  websocket.GeodataVersion(),
+	}
+	engine := NewETAEngine(cache)
+	now := time.Now()
+	engine.progress = map[string]*driverProgress{
+		"d1": {DriverID: "d1", RouteID: 1, Along: 20000, At: now, Speed: 10},
+	}
+
+	// 环线上已经驶过的站点在下一圈到达
+	etas := engine.Predict(now)
+	want := math.Round(1000 + line.length() - 20000)
+	if len(etas) != 1 || etas[0].Distance != want {
+		t.Errorf("etas = %+v, want one eta %.0f m ahead", etas, want)
+	}
+}
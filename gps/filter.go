@@ -0,0 +1,199 @@
+package gps
+
+import (
+	"errors"
+	"fmt"
+	"login/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrSampleRejected 定位点被过滤管道拒绝
+var ErrSampleRejected = errors.New("gps sample rejected")
+
+// GPSSample 进入过滤管道的一次定位
+type GPSSample struct {
+	DriverID string
+	Location Location
+	Time     time.Time
+}
+
+// LocationFilter 过滤管道中的一个阶段
+// Filter 返回处理后的定位；返回错误（包装 ErrSampleRejected）表示丢弃该定位
+// Reset 清除某个驾驶员的状态（下班时调用）
+type LocationFilter interface {
+	Filter(sample GPSSample) (GPSSample, error)
+	Reset(driverID string)
+}
+
+// FilterPipeline 依次执行多个过滤阶段，在更新模块状态之前处理定位
+type FilterPipeline struct {
+	mu      sync.Mutex
+	filters []LocationFilter
+}
+
+// NewFilterPipeline 创建过滤管道
+func NewFilterPipeline(filters ...LocationFilter) *FilterPipeline {
+	return &FilterPipeline{filters: filters}
+}
+
+// newDefaultFilterPipeline 按配置创建默认管道：范围检查 -> 速度离群剔除 -> 指数平滑
+func newDefaultFilterPipeline() *FilterPipeline {
+	c := config.AppConfig.GPS.Filter
+	return NewFilterPipeline(
+		NewBoundsFilter(c.MinLatitude, c.MaxLatitude, c.MinLongitude, c.MaxLongitude),
+		NewSpeedOutlierFilter(c.MaxSpeedKmh),
+		NewExponentialSmoother(c.SmoothingAlpha),
+	)
+}
+
+// Use 在管道末尾追加一个过滤阶段
+func (p *FilterPipeline) Use(filter LocationFilter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filters = append(p.filters, filter)
+}
+
+// Apply 依次执行所有过滤阶段
+func (p *FilterPipeline) Apply(sample GPSSample) (GPSSample, error) {
+	p.mu.Lock()
+	filters := p.filters
+	p.mu.Unlock()
+
+	for _, filter := range filters {
+		var err error
+		sample, err = filter.Filter(sample)
+		if err != nil {
+			return sample, err
+		}
+	}
+	return sample, nil
+}
+
+// Reset 清除所有阶段中某个驾驶员的状态
+func (p *FilterPipeline) Reset(driverID string) {
+	p.mu.Lock()
+	filters := p.filters
+	p.mu.Unlock()
+
+	for _, filter := range filters {
+		filter.Reset(driverID)
+	}
+}
+
+// BoundsFilter 拒绝无效坐标（包括 0,0）以及校园范围以外的定位
+type BoundsFilter struct {
+	minLat, maxLat, minLng, maxLng float64
+}
+
+// NewBoundsFilter 创建范围检查，四个值都为 0 时只检查坐标是否有效
+func NewBoundsFilter(minLat, maxLat, minLng, maxLng float64) *BoundsFilter {
+	return &BoundsFilter{minLat: minLat, maxLat: maxLat, minLng: minLng, maxLng: maxLng}
+}
+
+func (f *BoundsFilter) Filter(sample GPSSample) (GPSSample, error) {
+	lat, lng := sample.Location.Latitude, sample.Location.Longitude
+	if math.IsNaN(lat) || math.IsNaN(lng) || math.Abs(lat) > 90 || math.Abs(lng) > 180 || (lat == 0 && lng == 0) {
+		return sample, fmt.Errorf("%w: invalid coordinate (%f, %f)", ErrSampleRejected, lat, lng)
+	}
+	if f.minLat == 0 && f.maxLat == 0 && f.minLng == 0 && f.maxLng == 0 {
+		return sample, nil
+	}
+	if lat < f.minLat || lat > f.maxLat || lng < f.minLng || lng > f.maxLng {
+		return sample, fmt.Errorf("%w: (%f, %f) is outside the campus bounding box", ErrSampleRejected, lat, lng)
+	}
+	return sample, nil
+}
+
+func (f *BoundsFilter) Reset(driverID string) {}
+
+// 连续被判为离群点的次数达到该值后，认为车辆确实已在新位置，重新以新位置为基准
+const maxConsecutiveOutliers = 5
+
+// SpeedOutlierFilter 根据相邻两次定位推算速度，超过上限的定位视为漂移并丢弃
+type SpeedOutlierFilter struct {
+	mu       sync.Mutex
+	maxSpeed float64 // 米/秒
+	last     map[string]GPSSample
+	outliers map[string]int
+}
+
+// NewSpeedOutlierFilter 创建速度离群剔除，maxSpeedKmh 为 0 时默认 80 km/h
+func NewSpeedOutlierFilter(maxSpeedKmh float64) *SpeedOutlierFilter {
+	if maxSpeedKmh <= 0 {
+		maxSpeedKmh = 80
+	}
+	return &SpeedOutlierFilter{
+		maxSpeed: maxSpeedKmh / 3.6,
+		last:     make(map[string]GPSSample),
+		outliers: make(map[string]int),
+	}
+}
+
+func (f *SpeedOutlierFilter) Filter(sample GPSSample) (GPSSample, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last, exists := f.last[sample.DriverID]
+	if exists {
+		dt := sample.Time.Sub(last.Time).Seconds()
+		speed := math.Inf(1)
+		if dt > 0 {
+			speed = haversine(last.Location, sample.Location) / dt
+		}
+		if speed > f.maxSpeed && f.outliers[sample.DriverID] < maxConsecutiveOutliers {
+			f.outliers[sample.DriverID]++
+			return sample, fmt.Errorf("%w: implied speed %.1f km/h exceeds %.1f km/h", ErrSampleRejected, speed*3.6, f.maxSpeed*3.6)
+		}
+	}
+	f.last[sample.DriverID] = sample
+	f.outliers[sample.DriverID] = 0
+	return sample, nil
+}
+
+func (f *SpeedOutlierFilter) Reset(driverID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.last, driverID)
+	delete(f.outliers, driverID)
+}
+
+// 超过该时长没有定位时，平滑器不再沿用旧位置
+const smootherResetGap = 30 * time.Second
+
+// ExponentialSmoother 对定位做指数平滑，抑制小幅抖动
+type ExponentialSmoother struct {
+	mu       sync.Mutex
+	alpha    float64
+	smoothed map[string]GPSSample
+}
+
+// NewExponentialSmoother 创建指数平滑，alpha 不在 (0, 1] 内时默认 0.6
+func NewExponentialSmoother(alpha float64) *ExponentialSmoother {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.6
+	}
+	return &ExponentialSmoother{alpha: alpha, smoothed: make(map[string]GPSSample)}
+}
+
+func (f *ExponentialSmoother) Filter(sample GPSSample) (GPSSample, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous, exists := f.smoothed[sample.DriverID]
+	if exists && sample.Time.Sub(previous.Time) <= smootherResetGap {
+		sample.Location = Location{
+			Latitude:  f.alpha*sample.Location.Latitude + (1-f.alpha)*previous.Location.Latitude,
+			Longitude: f.alpha*sample.Location.Longitude + (1-f.alpha)*previous.Location.Longitude,
+		}
+	}
+	f.smoothed[sample.DriverID] = sample
+	return sample, nil
+}
+
+func (f *ExponentialSmoother) Reset(driverID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.smoothed, driverID)
+}
@@ -0,0 +1,151 @@
+package gps
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBoundsFilter(t *testing.T) {
+	campus := NewBoundsFilter(31, 32, 121, 122)
+	anywhere := NewBoundsFilter(0, 0, 0, 0)
+	tests := []struct {
+		name    string
+		filter  *BoundsFilter
+		loc     Location
+		wantErr bool
+	}{
+		{"inside campus", campus, Location{Latitude: 31.2, Longitude: 121.4}, false},
+		{"outside campus", campus, Location{Latitude: 30.2, Longitude: 121.4}, true},
+		{"no bounds", anywhere, Location{Latitude: 40, Longitude: 116}, false},
+		{"null island", anywhere, Location{}, true},
+		{"latitude out of range", anywhere, Location{Latitude: 121.4, Longitude: 31.2}, true},
+		{"longitude out of range", anywhere, Location{Latitude: 31.2, Longitude: 181}, true},
+		{"not a number", anywhere, Location{Latitude: math.NaN(), Longitude: 121.4}, true},
+	}
+	for _, tt := range tests {
+		_, err := tt.filter.Filter(GPSSample{DriverID: "d1", Location: tt.loc})
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrSampleRejected) {
+			t.Errorf("%s: error %v does not wrap ErrSampleRejected", tt.name, err)
+		}
+	}
+}
+
+func TestSpeedOutlierFilter(t *testing.T) {
+	filter := NewSpeedOutlierFilter(0) // 默认 80 km/h
+	start := time.Now()
+	origin := Location{Latitude: 31.2, Longitude: 121.4}
+	// 沿经线每 0.001 度约 111 米
+	sample := func(steps float64, seconds int) GPSSample {
+		return GPSSample{
+			DriverID: "d1",
+			Location: Location{Latitude: origin.Latitude + 0.001*steps, Longitude: origin.Longitude},
+			Time:     start.Add(time.Duration(seconds) * time.Second),
+		}
+	}
+
+	steps := []struct {
+		name     string
+		sample   GPSSample
+		rejected bool
+	}{
+		{"first fix", sample(0, 0), false},
+		{"about 40 km/h", sample(1, 10), false},
+		{"jump of 1 km in 10 s", sample(10, 20), true},
+		{"same time as the last fix", sample(1, 10), true},
+		{"back on track", sample(2, 30), false},
+	}
+	for _, step := range steps {
+		_, err := filter.Filter(step.sample)
+		if step.rejected != errors.Is(err, ErrSampleRejected) {
+			t.Errorf("%s: error = %v, want rejected %v", step.name, err, step.rejected)
+		}
+	}
+
+	// 连续多次离群后以新位置为基准
+	for i := 0; i < maxConsecutiveOutliers; i++ {
+		if _, err := filter.Filter(sample(50, 31+i)); err == nil {
+			t.Fatalf("outlier %d accepted", i+1)
+		}
+	}
+	if _, err := filter.Filter(sample(50, 40)); err != nil {
+		t.Errorf("sample after %d outliers rejected: %v", maxConsecutiveOutliers, err)
+	}
+
+	filter.Reset("d1")
+	if _, err := filter.Filter(sample(0, 41)); err != nil {
+		t.Errorf("first fix after Reset rejected: %v", err)
+	}
+}
+
+func TestExponentialSmoother(t *testing.T) {
+	smoother := NewExponentialSmoother(0.5)
+	start := time.Now()
+	filter := func(lat float64, seconds int) float64 {
+		out, err := smoother.Filter(GPSSample{DriverID: "d1", Location: Location{Latitude: lat, Longitude: 121.4}, Time: start.Add(time.Duration(seconds) * time.Second)})
+		if err != nil {
+			t.Fatalf("smoother rejected a sample: %v", err)
+		}
+		return out.Location.Latitude
+	}
+
+	tests := []struct {
+		name    string
+		lat     float64
+		seconds int
+		want    float64
+	}{
+		{"first fix is kept", 31.2, 0, 31.2},
+		{"halfway to the new fix", 31.4, 5, 31.3},
+		{"smoothed again", 31.4, 10, 31.35},
+		{"long gap starts over", 31.0, 60, 31.0},
+	}
+	for _, tt := range tests {
+		if got := filter(tt.lat, tt.seconds); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: latitude = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	smoother.Reset("d1")
+	if got := filter(31.8, 61); got != 31.8 {
+		t.Errorf("latitude after Reset = %v, want 31.8", got)
+	}
+	if s := NewExponentialSmoother(1.5); s.alpha != 0.6 {
+		t.Errorf("alpha out of range = %v, want default 0.6", s.alpha)
+	}
+}
+
+// rejectAll 拒绝所有定位的过滤阶段
+type rejectAll struct{ resets []string }
+
+func (f *rejectAll) Filter(sample GPSSample) (GPSSample, error) { return sample, ErrSampleRejected }
+func (f *rejectAll) Reset(driverID string)                      { f.resets = append(f.resets, driverID) }
+
+func TestFilterPipeline(t *testing.T) {
+	smoother := NewExponentialSmoother(0.5)
+	pipeline := NewFilterPipeline(NewBoundsFilter(0, 0, 0, 0), smoother)
+
+	if _, err := pipeline.Apply(GPSSample{DriverID: "d1"}); !errors.Is(err, ErrSampleRejected) {
+		t.Errorf("invalid coordinate passed the pipeline: %v", err)
+	}
+	if _, exists := smoother.smoothed["d1"]; exists {
+		t.Error("later stages ran after a rejection")
+	}
+
+	reject := &rejectAll{}
+	pipeline.Use(reject)
+	if _, err := pipeline.Apply(GPSSample{DriverID: "d1", Location: Location{Latitude: 31.2, Longitude: 121.4}}); err == nil {
+		t.Error("custom stage was not applied")
+	}
+	pipeline.Reset("d1")
+	if len(reject.resets) != 1 || reject.resets[0] != "d1" {
+		t.Errorf("custom stage resets = %v", reject.resets)
+	}
+	if _, exists := smoother.smoothed["d1"]; exists {
+		t.Error("smoother state kept after Reset")
+	}
+}
@@ -0,0 +1,105 @@
+package gps
+
+import "math"
+
+// 地球平均半径（米）
+const earthRadius = 6371000.0
+
+// haversine 计算两个经纬度点之间的球面距离（米）
+func haversine(a, b Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// bearing 计算从 a 指向 b 的方位角（度），正北为 0，顺时针增加
+func bearing(a, b Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// polyline 路线折线，预先计算每个顶点沿线的累计距离
+type polyline struct {
+	points  []Location
+	cumDist []float64 // cumDist[i] 为起点到第 i 个顶点的沿线距离（米）
+}
+
+// newPolyline 由路线文件中的 [[lng, lat], ...] 坐标构造折线
+func newPolyline(path [][]float64) *polyline {
+	p := &polyline{}
+	for _, pt := range path {
+		if len(pt) < 2 {
+			continue
+		}
+		loc := Location{Latitude: pt[1], Longitude: pt[0]}
+		dist := 0.0
+		if n := len(p.points); n > 0 {
+			dist = p.cumDist[n-1] + haversine(p.points[n-1], loc)
+		}
+		p.points = append(p.points, loc)
+		p.cumDist = append(p.cumDist, dist)
+	}
+	return p
+}
+
+// length 折线总长度（米）
+func (p *polyline) length() float64 {
+	if len(p.cumDist) == 0 {
+		return 0
+	}
+	return p.cumDist[len(p.cumDist)-1]
+}
+
+// closed 判断路线首尾是否相接（环线）
+func (p *polyline) closed() bool {
+	if len(p.points) < 3 {
+		return false
+	}
+	return haversine(p.points[0], p.points[len(p.points)-1]) < 30
+}
+
+// project 将一个位置投影到折线上
+//
+// Returns:
+//   - along: 投影点距折线起点的沿线距离（米）
+//   - offset: 位置到折线的垂直距离（米）
+func (p *polyline) project(loc Location) (along float64, offset float64) {
+	if len(p.points) == 0 {
+		return 0, math.Inf(1)
+	}
+	if len(p.points) == 1 {
+		return 0, haversine(p.points[0], loc)
+	}
+
+	offset = math.Inf(1)
+	for i := 0; i < len(p.points)-1; i++ {
+		a, b := p.points[i], p.points[i+1]
+		// 在线段附近使用等距圆柱投影，将经纬度换算为以 a 为原点的平面坐标（米）
+		cosLat := math.Cos(a.Latitude * math.Pi / 180)
+		bx := (b.Longitude - a.Longitude) * math.Pi / 180 * earthRadius * cosLat
+		by := (b.Latitude - a.Latitude) * math.Pi / 180 * earthRadius
+		px := (loc.Longitude - a.Longitude) * math.Pi / 180 * earthRadius * cosLat
+		py := (loc.Latitude - a.Latitude) * math.Pi / 180 * earthRadius
+
+		t := 0.0
+		if segLen2 := bx*bx + by*by; segLen2 > 0 {
+			t = math.Max(0, math.Min(1, (px*bx+py*by)/segLen2))
+		}
+		dx, dy := px-t*bx, py-t*by
+		d := math.Sqrt(dx*dx + dy*dy)
+		if d < offset {
+			offset = d
+			along = p.cumDist[i] + t*(p.cumDist[i+1]-p.cumDist[i])
+		}
+	}
+	return along, offset
+}
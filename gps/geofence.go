@@ -0,0 +1,149 @@
+package gps
+
+import (
+	"login/config"
+	"login/websocket"
+	"math"
+	"sync"
+	"time"
+)
+
+// 围栏事件类型
+const (
+	EventArrivedAtSite = "arrived_at_site"
+	EventDepartedSite  = "departed_site"
+)
+
+// GeofenceEvent 车辆进入或离开站点围栏时产生的事件
+type GeofenceEvent struct {
+	Type         string `json:"type"`                    // arrived_at_site 或 departed_site
+	DriverID     string `json:"driver_id"`               // 驾驶员编号
+	CarID        string `json:"car_id"`                  // 车牌号
+	RouteID      int    `json:"route_id"`                // 线路编号
+	SiteID       int    `json:"site_id"`                 // 站点编号
+	SiteName     string `json:"site_name"`               // 站点名称
+	Time         string `json:"time"`                    // 事件发生时间
+	DwellSeconds int    `json:"dwell_seconds,omitempty"` // 停站时长（仅离站事件）
+}
+
+// siteVisit 驾驶员当前所在的站点
+type siteVisit struct {
+	Site      websocket.Site
+	EnteredAt time.Time
+}
+
+// GeofenceEngine 根据驾驶员位置判断其到站与离站
+type GeofenceEngine struct {
+	mu     sync.Mutex
+	routes *routeCache
+	visits map[string]*siteVisit     // 驾驶员 ID -> 当前所在站点，不在任何站点时不存在
+	last   map[string]websocket.Site // 驾驶员 ID -> 最近一次到达的站点，离站后仍保留
+}
+
+// NewGeofenceEngine 创建站点围栏引擎
+func NewGeofenceEngine(routes *routeCache) *GeofenceEngine {
+	return &GeofenceEngine{
+		routes: routes,
+		visits: make(map[string]*siteVisit),
+		last:   make(map[string]websocket.Site),
+	}
+}
+
+// SiteRadius 返回指定站点的围栏半径（米），车辆距站点不超过该距离视为已到站
+func SiteRadius(siteID int) float64 {
+	radius, _ := siteFence(siteID)
+	return radius
+}
+
+// siteFence 返回指定站点的围栏半径与回差
+func siteFence(siteID int) (radius float64, hysteresis float64) {
+	c := config.AppConfig.GPS.Geofence
+	radius, hysteresis = c.RadiusMeters, c.HysteresisMeters
+	if site, ok := c.Sites[siteID]; ok {
+		if site.RadiusMeters > 0 {
+			radius = site.RadiusMeters
+		}
+		if site.HysteresisMeters > 0 {
+			hysteresis = site.HysteresisMeters
+		}
+	}
+	if radius <= 0 {
+		radius = 30
+	}
+	if hysteresis < 0 {
+		hysteresis = 0
+	}
+	return radius, hysteresis
+}
+
+func siteLocation(site websocket.Site) Location {
+	return Location{Latitude: site.Location.Latitude, Longitude: site.Location.Longitude}
+}
+
+// Update 根据驾驶员的最新位置更新围栏状态，返回本次产生的事件
+func (e *GeofenceEngine) Update(driver Driver, now time.Time) []GeofenceEvent {
+	sites := e.routes.allSites()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	newEvent := func(eventType string, site websocket.Site) GeofenceEvent {
+		return GeofenceEvent{
+			Type:     eventType,
+			DriverID: driver.ID,
+			CarID:    driver.Car_ID,
+			RouteID:  driver.RouteID,
+			SiteID:   site.ID,
+			SiteName: site.Name,
+			Time:     now.Format("2006-01-02 15:04:05"),
+		}
+	}
+
+	var events []GeofenceEvent
+
+	// 1. 已在站点内：超出 半径+回差 才算离站，避免在围栏边缘反复触发
+	if visit, exists := e.visits[driver.ID]; exists {
+		radius, hysteresis := siteFence(visit.Site.ID)
+		if haversine(siteLocation(visit.Site), driver.Location) <= radius+hysteresis {
+			return nil
+		}
+		event := newEvent(EventDepartedSite, visit.Site)
+		event.DwellSeconds = int(now.Sub(visit.EnteredAt).Seconds())
+		events = append(events, event)
+		delete(e.visits, driver.ID)
+	}
+
+	// 2. 不在站点内：进入最近的一个站点围栏即为到站
+	nearest := -1
+	nearestDist := math.Inf(1)
+	for i, site := range sites {
+		dist := haversine(siteLocation(site), driver.Location)
+		radius, _ := siteFence(site.ID)
+		if dist <= radius && dist < nearestDist {
+			nearest, nearestDist = i, dist
+		}
+	}
+	if nearest >= 0 {
+		e.visits[driver.ID] = &siteVisit{Site: sites[nearest], EnteredAt: now}
+		e.last[driver.ID] = sites[nearest]
+		events = append(events, newEvent(EventArrivedAtSite, sites[nearest]))
+	}
+
+	return events
+}
+
+// Remove 移除驾驶员的围栏状态（下班时调用）
+func (e *GeofenceEngine) Remove(driverID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.visits, driverID)
+	delete(e.last, driverID)
+}
+
+// LastSite 获取驾驶员最近一次到达的站点
+func (e *GeofenceEngine) LastSite(driverID string) (websocket.Site, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	site, exists := e.last[driverID]
+	return site, exists
+}
@@ -0,0 +1,101 @@
+package gps
+
+import (
+	"login/config"
+	"login/websocket"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSiteRadius(t *testing.T) {
+	saved := config.AppConfig.GPS.Geofence
+	t.Cleanup(func() { config.AppConfig.GPS.Geofence = saved })
+
+	config.AppConfig.GPS.Geofence = config.GeofenceConfig{}
+	if r := SiteRadius(1); r != 30 {
+		t.Errorf("default radius = %v, want 30", r)
+	}
+	config.AppConfig.GPS.Geofence = config.GeofenceConfig{
+		RadiusMeters:     40,
+		HysteresisMeters: -5,
+		Sites:            map[int]config.GeofenceSiteConfig{2: {RadiusMeters: 80}, 3: {HysteresisMeters: 15}},
+	}
+	tests := []struct {
+		siteID         int
+		radius, margin float64
+	}{
+		{1, 40, 0}, // 负的回差按 0 处理
+		{2, 80, 0},
+		{3, 40, 15},
+	}
+	for _, tt := range tests {
+		if radius, margin := siteFence(tt.siteID); radius != tt.radius || margin != tt.margin {
+			t.Errorf("site %d fence = %v, %v, want %v, %v", tt.siteID, radius, margin, tt.radius, tt.margin)
+		}
+	}
+}
+
+func TestGeofenceEngineUpdate(t *testing.T) {
+	saved := config.AppConfig.GPS.Geofence
+	config.AppConfig.GPS.Geofence = config.GeofenceConfig{
+		RadiusMeters:     30,
+		HysteresisMeters: 10,
+		Sites:            map[int]config.GeofenceSiteConfig{2: {RadiusMeters: 60}},
+	}
+	t.Cleanup(func() { config.AppConfig.GPS.Geofence = saved })
+
+	// 站点都在赤道上，经度每 0.0001 度约 11 米
+	site := func(id int, name string, lon float64) websocket.Site {
+		return websocket.Site{ID: id, Name: name, Location: websocket.Location{Longitude: lon}}
+	}
+	library, gym, canteen := site(1, "图书馆", 0), site(2, "体育馆", 0.01), site(3, "食堂", 0.0105)
+	engine := NewGeofenceEngine(&routeCache{
+		sites:    []websocket.Site{library, gym, canteen},
+		loadedAt: time.Now(),
+		version:  websocket.GeodataVersion(),
+	})
+	start := time.Now()
+
+	type event struct {
+		Type   string
+		SiteID int
+		Dwell  int
+	}
+	steps := []struct {
+		name    string
+		lon     float64
+		seconds int
+		want    []event
+	}{
+		{"outside every fence", -0.0005, 0, nil},
+		{"enters the library", 0.0002, 10, []event{{EventArrivedAtSite, 1, 0}}},
+		{"inside the hysteresis margin", 0.00032, 20, nil},
+		{"leaves the library", 0.0004, 40, []event{{EventDepartedSite, 1, 30}}},
+		{"inside the larger gym fence", 0.0095, 100, []event{{EventArrivedAtSite, 2, 0}}},
+		{"jumps straight to the canteen", 0.0115, 130, []event{{EventDepartedSite, 2, 30}}},
+		{"nearest of two overlapping fences", 0.0104, 160, []event{{EventArrivedAtSite, 3, 0}}},
+		{"moves from one stop to another", 0, 200, []event{{EventDepartedSite, 3, 40}, {EventArrivedAtSite, 1, 0}}},
+	}
+	for _, step := range steps {
+		driver := Driver{ID: "d1", Car_ID: "沪A1", RouteID: 5, Location: Location{Longitude: step.lon}}
+		var got []event
+		for _, e := range engine.Update(driver, start.Add(time.Duration(step.seconds)*time.Second)) {
+			if e.DriverID != "d1" || e.CarID != "沪A1" || e.RouteID != 5 || e.SiteName == "" {
+				t.Errorf("%s: event = %+v", step.name, e)
+			}
+			got = append(got, event{e.Type, e.SiteID, e.DwellSeconds})
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: events = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	if last, ok := engine.LastSite("d1"); !ok || last.ID != 1 {
+		t.Errorf("last site = %+v, %v, want the library", last, ok)
+	}
+	engine.Remove("d1")
+	if _, ok := engine.LastSite("d1"); ok {
+		t.Error("last site kept after Remove")
+	}
+}
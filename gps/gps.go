@@ -3,17 +3,29 @@ package gps
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"login/log_service" // 引入日志模块
 	"login/websocket"   // 引入 WebSocket API 模块
+	"sort"
 	"sync"
 	"time"
 )
 
 type Driver struct {
-	Type     string   `json:"type"`     // 消息类型
-	ID       string   `json:"id"`       // 驾驶员唯一标识
-	Location Location `json:"location"` // 地理位置（例如GPS定位）
-	Car_ID   string   `json:"car_id"`
+	Type          string    `json:"type"`     // 消息类型
+	ID            string    `json:"id"`       // 驾驶员唯一标识
+	Location      Location  `json:"location"` // 地理位置（例如GPS定位）
+	Car_ID        string    `json:"car_id"`
+	RouteID       int       `json:"route_id"`       // 当前班次的线路编号
+	Status        string    `json:"status"`         // 在线状态：active / stale / expired
+	LastUpdate    string    `json:"last_update"`    // 最近一次上报位置的时间
+	Speed         float64   `json:"speed"`          // 瞬时车速（km/h）
+	SmoothedSpeed float64   `json:"smoothed_speed"` // 平滑车速（km/h）
+	Heading       float64   `json:"heading"`        // 行驶方向（度），正北为 0，顺时针增加
+	Occupancy     int       `json:"occupancy"`      // 当前载客量
+	Capacity      int       `json:"capacity"`       // 车辆载客上限
+	lastSeen      time.Time // 最近一次上报位置（或上班）的时间，用于判断是否静默
+	locatedAt     time.Time // 最近一次被接受的定位时间，用于计算车速
 }
 
 // 地理位置结构体
@@ -28,6 +40,18 @@ type GPSModule struct {
 	passengers      map[string]*Passenger
 	passengersMutex sync.Mutex
 	webSocketAPI    *websocket.WebSocketAPI // WebSocket API 实例
+	routes          *routeCache             // 路线几何与站点缓存
+	eta             *ETAEngine              // 到站时间预测
+	recorder        *TrajectoryRecorder     // 班次轨迹记录
+	geofence        *GeofenceEngine         // 站点到站/离站判断
+	deviation       *DeviationDetector      // 偏离路线检测
+	overspeed       *OverspeedDetector      // 超速检测
+	mileage         *MileageTracker         // 班次里程与行驶/怠速时间统计
+	headway         *HeadwayMonitor         // 同线路车辆间隔监控
+	occupancy       *OccupancyTracker       // 车辆实时载客量
+	store           DriverStore             // 驾驶员状态快照，用于重启后恢复
+	filters         *FilterPipeline         // 定位过滤管道
+	lastBroadcast   map[string]Driver       // 上次广播时的驾驶员状态，用于计算增量，仅由广播协程访问
 }
 
 // Passenger 代表乘客的基本信息
@@ -37,15 +61,38 @@ type Passenger struct {
 
 // NewGPSModule 创建一个 GPSModule 实例
 func NewGPSModule(webSocketAPI *websocket.WebSocketAPI) *GPSModule {
+	routes := newRouteCache()
 	return &GPSModule{
-		drivers:      make(map[string]*Driver),
-		passengers:   make(map[string]*Passenger),
-		webSocketAPI: webSocketAPI,
+		drivers:       make(map[string]*Driver),
+		passengers:    make(map[string]*Passenger),
+		webSocketAPI:  webSocketAPI,
+		routes:        routes,
+		eta:           NewETAEngine(routes),
+		recorder:      NewTrajectoryRecorder(),
+		geofence:      NewGeofenceEngine(routes),
+		deviation:     NewDeviationDetector(routes),
+		overspeed:     NewOverspeedDetector(routes),
+		mileage:       NewMileageTracker(),
+		headway:       NewHeadwayMonitor(routes),
+		occupancy:     NewOccupancyTracker(),
+		store:         newDriverStore(),
+		filters:       newDefaultFilterPipeline(),
+		lastBroadcast: make(map[string]Driver),
 	}
 }
 
-// CreateDriver 创建一个新的驾驶员对象
-func (g *GPSModule) CreateDriver(id string) (*Driver, error) {
+// SetDriverStore 替换驾驶员状态存储，需在 StartBroadcast 之前调用
+func (g *GPSModule) SetDriverStore(store DriverStore) {
+	g.store = store
+}
+
+// UseFilter 在定位过滤管道末尾追加一个自定义过滤阶段
+func (g *GPSModule) UseFilter(filter LocationFilter) {
+	g.filters.Use(filter)
+}
+
+// CreateDriver 创建一个新的驾驶员对象，routeID 为当前班次的线路编号，用于到站预测
+func (g *GPSModule) CreateDriver(id string, routeID int) (*Driver, error) {
 	if id == "" {
 		log_service.GPSLogger.Println("尝试创建驾驶员失败：ID不能为空")
 		return nil, errors.New("driver ID cannot be empty")
@@ -59,9 +106,9 @@ func (g *GPSModule) CreateDriver(id string) (*Driver, error) {
 		return nil, errors.New("driver already exists")
 	}
 
-	driver := &Driver{Type: "driver_gps", ID: id}
+	driver := &Driver{Type: "driver_gps", ID: id, RouteID: routeID, Status: DriverStatusActive, lastSeen: time.Now()}
 	g.drivers[id] = driver
-	log_service.GPSLogger.Printf("成功创建驾驶员：%s\n", id)
+	log_service.GPSLogger.Printf("成功创建驾驶员：%s，线路：%d\n", id, routeID)
 	return driver, nil
 }
 
@@ -73,70 +120,415 @@ func (g *GPSModule) DeleteDriver(id string) error {
 	}
 
 	g.driversMutex.Lock()
-	defer g.driversMutex.Unlock()
-
-	if _, exists := g.drivers[id]; !exists {
+	driver, exists := g.drivers[id]
+	if !exists {
+		g.driversMutex.Unlock()
 		log_service.GPSLogger.Printf("删除驾驶员失败：ID %s 不存在\n", id)
 		return errors.New("driver not found")
 	}
-
+	carID := driver.Car_ID
 	delete(g.drivers, id)
+	g.driversMutex.Unlock()
+
+	if carID != "" {
+		// 下班时车上乘客清零，避免漏报的下车人数累积到下一个班次；数据库写入在锁外进行，不阻塞位置更新与广播
+		g.occupancy.Reset(carID)
+		updateCarPassenger(carID, 0)
+	}
+	g.eta.Remove(id)
+	g.recorder.Stop(id)
+	g.geofence.Remove(id)
+	g.deviation.Remove(id)
+	g.overspeed.Remove(id)
+	g.mileage.Remove(id)
+	g.filters.Reset(id)
+	if err := g.store.Delete(id); err != nil {
+		log_service.GPSLogger.Printf("删除驾驶员 %s 的状态快照失败：%v\n", id, err)
+	}
 	log_service.GPSLogger.Printf("成功删除驾驶员：%s\n", id)
 	return nil
 }
 
-// 定时广播驾驶员位置信息
+// ResumeShift 服务重启后恢复的驾驶员再次上班时沿用已恢复的班次，线路与车辆以本次上班为准
+// 返回该班次的开始时间；驾驶员不存在或没有正在记录的班次时返回 false
+func (g *GPSModule) ResumeShift(id, carID string, routeID int) (string, bool) {
+	shiftStart := g.recorder.ShiftStart(id)
+	if shiftStart == "" {
+		return "", false
+	}
+
+	g.driversMutex.Lock()
+	defer g.driversMutex.Unlock()
+
+	driver, exists := g.drivers[id]
+	if !exists {
+		return "", false
+	}
+	driver.RouteID = routeID
+	driver.Car_ID = carID
+	driver.Capacity = VehicleCapacity(carID)
+	log_service.GPSLogger.Printf("驾驶员 %s 沿用班次 %s，线路 %d，车牌 %s\n", id, shiftStart, routeID, carID)
+	return shiftStart, true
+}
+
+// 定时广播驾驶员位置信息，同时启动轨迹的定期落库
 func (g *GPSModule) StartBroadcast() {
+	g.recorder.StartFlushLoop()
+	g.startSnapshotLoop()
+
 	go func() { // 使用 goroutine 实现异步广播
 		ticker := time.NewTicker(2 * time.Second) // 每两秒触发
 		defer ticker.Stop()
 
 		for range ticker.C {
+			g.sweepStaleDrivers(time.Now())
 			g.broadcastDriverLocations()
+			g.broadcastETAs()
+			g.checkHeadways(time.Now())
 		}
 	}()
 	log_service.GPSLogger.Println("开始广播驾驶员位置信息")
 }
 
-// 广播所有驾驶员的位置信息
+// 广播驾驶员的位置信息：未订阅的客户端收到所有驾驶员，已订阅的客户端只收到订阅范围内有变化的驾驶员
 func (g *GPSModule) broadcastDriverLocations() {
-	// g.driversMutex.Lock()
+	drivers := g.GetAllDrivers()
+	changed, removed := g.diffDrivers(drivers)
+
+	var driverData []byte
+	if len(drivers) > 0 {
+		// 序列化驾驶员位置信息
+		data, err := json.Marshal(drivers)
+		if err == nil {
+			driverData = data
+		}
+	}
+	if driverData == nil && len(changed) == 0 && len(removed) == 0 {
+		return // 如果没有驾驶员也没有变化，不广播
+	}
+
+	g.webSocketAPI.BroadcastGPS(driverData, func(sub *websocket.GPSSubscription) []byte {
+		return buildDelta(sub, changed, removed)
+	})
+
+	// 订阅了线路主题（route:{id}）或车辆主题（car:{id}）的客户端另外收到其中有变化的驾驶员
+	for _, driver := range changed {
+		data, err := json.Marshal(driver)
+		if err != nil {
+			continue
+		}
+		if driver.RouteID != 0 {
+			g.webSocketAPI.Publish(websocket.RouteTopic(driver.RouteID), data)
+		}
+		if driver.Car_ID != "" {
+			g.webSocketAPI.Publish(websocket.CarTopic(driver.Car_ID), data)
+		}
+	}
+}
 
-	if len(g.drivers) == 0 {
-		return // 如果没有驾驶员，不广播
+// 广播所有站点的到站预测
+func (g *GPSModule) broadcastETAs() {
+	etas := g.eta.Predict(time.Now())
+	if len(etas) == 0 {
+		return
 	}
 
-	// 序列化驾驶员位置信息
-	driverData, err := json.Marshal(g.GetAllDrivers())
-	// g.driversMutex.Unlock()
+	etaData, err := json.Marshal(ETAMessage{Type: "eta", ETAs: etas})
 	if err != nil {
-		return // 如果序列化失败，直接跳过
+		return
 	}
 
-	// 广播消息到所有客户端
-
-	g.webSocketAPI.SendMessage(driverData, "")
+	g.webSocketAPI.SendMessage(etaData, "")
 
+	// 订阅了站点主题（site:{id}）的客户端另外收到只包含该站点的预测，消息带 topic 字段以区别于全部站点的预测
+	bySite := make(map[int][]SiteETA)
+	for _, eta := range etas {
+		bySite[eta.SiteID] = append(bySite[eta.SiteID], eta)
+	}
+	for siteID, siteETAs := range bySite {
+		siteData, err := json.Marshal(ETAMessage{Type: "eta", ETAs: siteETAs})
+		if err != nil {
+			continue
+		}
+		g.webSocketAPI.Publish(websocket.SiteTopic(siteID), siteData)
+	}
 }
 
 // UpdateDriverLocation 更新驾驶员的位置信息
 func (g *GPSModule) UpdateDriverLocation(id string, latitude, longitude float64, car_id string) error {
 	g.driversMutex.Lock()
-	defer g.driversMutex.Unlock()
+	_, exists := g.drivers[id]
+	g.driversMutex.Unlock()
+	if !exists {
+		log_service.GPSLogger.Printf("更新驾驶员位置失败：ID %s 不存在\n", id)
+		return errors.New("driver not found")
+	}
 
+	// 在锁外执行过滤管道，剔除无效点和漂移点并平滑抖动
+	now := time.Now()
+	sample, filterErr := g.filters.Apply(GPSSample{
+		DriverID: id,
+		Location: Location{Latitude: latitude, Longitude: longitude},
+		Time:     now,
+	})
+
+	g.driversMutex.Lock()
 	driver, exists := g.drivers[id]
 	if !exists {
+		g.driversMutex.Unlock()
 		log_service.GPSLogger.Printf("更新驾驶员位置失败：ID %s 不存在\n", id)
 		return errors.New("driver not found")
 	}
+	if filterErr != nil {
+		// 被丢弃的定位仍说明驾驶员在线，只刷新最近上报时间
+		driver.lastSeen = now
+		driver.Status = DriverStatusActive
+		g.driversMutex.Unlock()
+		log_service.GPSLogger.Printf("丢弃驾驶员 %s 的定位 (%f, %f)：%v\n", id, latitude, longitude, filterErr)
+		return fmt.Errorf("update driver %s: %w", id, filterErr)
+	}
 
-	driver.Location.Latitude = latitude
-	driver.Location.Longitude = longitude
+	updateMotion(driver, sample.Location, now)
+	driver.Location = sample.Location
+	driver.locatedAt = now
 	driver.Car_ID = car_id
-	log_service.GPSLogger.Printf("更新驾驶员 %s 和車牌 %s的位置为：(%f, %f)\n", id, car_id, latitude, longitude)
+	driver.Occupancy = g.occupancy.Count(car_id)
+	driver.Capacity = VehicleCapacity(car_id)
+	driver.lastSeen = now
+	driver.LastUpdate = now.Format("2006-01-02 15:04:05")
+	driver.Status = DriverStatusActive
+	snapshot := *driver
+	g.driversMutex.Unlock()
+
+	log_service.GPSLogger.Printf("更新驾驶员 %s 和車牌 %s的位置为：(%f, %f)\n", id, car_id, snapshot.Location.Latitude, snapshot.Location.Longitude)
+
+	// 在锁外更新依赖位置的各个组件
+	g.eta.Update(snapshot, now)
+	g.recorder.Record(snapshot, now)
+	g.mileage.Update(snapshot, now)
+	for _, event := range g.geofence.Update(snapshot, now) {
+		g.publishGeofenceEvent(event)
+	}
+	for _, alert := range g.deviation.Update(snapshot, now) {
+		g.publishDeviationAlert(alert, now)
+	}
+	for _, alert := range g.overspeed.Update(snapshot, now) {
+		g.publishOverspeedAlert(alert, now)
+	}
 	return nil
 }
 
+// checkHeadways 重新计算各线路的车辆间隔，将调度建议发送给对应驾驶员并抄送管理员
+func (g *GPSModule) checkHeadways(now time.Time) {
+	for _, action := range g.headway.Update(g.eta.snapshot(), now) {
+		if action.Action == HeadwayActionResume {
+			log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）在线路 %d 上的间隔已恢复正常\n", action.DriverID, action.CarID, action.RouteID)
+		} else {
+			log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）在线路 %d 上与前车 %s 间隔 %d 秒（目标 %d 秒），建议 %s\n",
+				action.DriverID, action.CarID, action.RouteID, action.LeaderID, action.HeadwaySeconds, action.TargetSeconds, action.Action)
+		}
+
+		actionData, err := json.Marshal(action)
+		if err != nil {
+			continue
+		}
+		// 建议只在当前有效，驾驶员未连接时不保存为离线消息，重新连接后由下一次状态变化重新下发
+		g.webSocketAPI.SendTransientByID(action.DriverID, actionData)
+		g.webSocketAPI.PublishOrSend(websocket.TopicAdminAlerts, actionData, websocket.ClientTypeAdmin)
+	}
+}
+
+// publishOverspeedAlert 记录超速事件并推送给管理员客户端（订阅了 admin:alerts 的管理员通过主题收到）
+func (g *GPSModule) publishOverspeedAlert(alert OverspeedAlert, now time.Time) {
+	if alert.Type == AlertOverspeed {
+		alert.IncidentID = recordIncident(Incident{
+			Type:      IncidentOverspeed,
+			DriverID:  alert.DriverID,
+			CarID:     alert.CarID,
+			RouteID:   alert.RouteID,
+			Location:  alert.Location,
+			Value:     alert.MaxSpeed,
+			StartTime: alert.started, // 检测需要持续一段时间，事件从开始超速时算起
+			Note:      fmt.Sprintf("限速 %.0f km/h（%s），超速开始于 %s", alert.LimitKmh, alert.LimitName, alert.Since),
+		})
+		g.overspeed.SetIncident(alert.DriverID, alert.IncidentID)
+		log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）超速：%.1f km/h，限速 %.0f km/h，自 %s 起\n",
+			alert.DriverID, alert.CarID, alert.SpeedKmh, alert.LimitKmh, alert.Since)
+	} else {
+		closeIncident(alert.IncidentID, alert.MaxSpeed, now)
+		log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）已恢复正常车速\n", alert.DriverID, alert.CarID)
+	}
+
+	alertData, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	g.webSocketAPI.PublishOrSend(websocket.TopicAdminAlerts, alertData, websocket.ClientTypeAdmin)
+}
+
+// publishDeviationAlert 记录偏离路线事件并推送给管理员客户端（订阅了 admin:alerts 的管理员通过主题收到）
+func (g *GPSModule) publishDeviationAlert(alert DeviationAlert, now time.Time) {
+	if alert.Type == AlertRouteDeviation {
+		alert.IncidentID = recordIncident(Incident{
+			Type:      IncidentRouteDeviation,
+			DriverID:  alert.DriverID,
+			CarID:     alert.CarID,
+			RouteID:   alert.RouteID,
+			Location:  alert.Location,
+			Value:     alert.MaxOffset,
+			StartTime: alert.started, // 检测需要持续一段时间，事件从开始偏离时算起
+			Note:      "偏离线路开始于 " + alert.Since,
+		})
+		g.deviation.SetIncident(alert.DriverID, alert.IncidentID)
+		log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）偏离线路 %d 达 %.0f 米，自 %s 起\n",
+			alert.DriverID, alert.CarID, alert.RouteID, alert.OffsetMeters, alert.Since)
+	} else {
+		closeIncident(alert.IncidentID, alert.MaxOffset, now)
+		log_service.GPSLogger.Printf("驾驶员 %s（车牌 %s）已回到线路 %d\n", alert.DriverID, alert.CarID, alert.RouteID)
+	}
+
+	alertData, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	g.webSocketAPI.PublishOrSend(websocket.TopicAdminAlerts, alertData, websocket.ClientTypeAdmin)
+}
+
+// publishGeofenceEvent 记录并推送到站/离站事件
+func (g *GPSModule) publishGeofenceEvent(event GeofenceEvent) {
+	if event.Type == EventDepartedSite {
+		log_service.GPSLogger.Printf("%s 驾驶员 %s（车牌 %s）离开站点 %d %s，停站 %d 秒\n",
+			event.Time, event.DriverID, event.CarID, event.SiteID, event.SiteName, event.DwellSeconds)
+	} else {
+		log_service.GPSLogger.Printf("%s 驾驶员 %s（车牌 %s）到达站点 %d %s\n",
+			event.Time, event.DriverID, event.CarID, event.SiteID, event.SiteName)
+	}
+
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	g.webSocketAPI.SendMessage(eventData, "")
+}
+
+// StartTrack 开始记录驾驶员本班次的轨迹，shiftStart 为 work_table.work_stime
+func (g *GPSModule) StartTrack(id, carID, shiftStart string) {
+	g.recorder.Start(id, carID, shiftStart)
+}
+
+// GetTrack 获取正在记录中的班次轨迹
+func (g *GPSModule) GetTrack(id, shiftStart string) ([]TrackPoint, bool) {
+	return g.recorder.Track(id, shiftStart)
+}
+
+// RouteShapes 获取全部路线的几何信息与站点
+func (g *GPSModule) RouteShapes() []RouteShape {
+	return g.routes.shapes()
+}
+
+// GetETAs 获取到站预测，siteID 为 0 时返回所有站点
+func (g *GPSModule) GetETAs(siteID int) []SiteETA {
+	if siteID == 0 {
+		return g.eta.Predict(time.Now())
+	}
+	return g.eta.PredictSite(siteID, time.Now())
+}
+
+// ActiveDeviations 获取当前仍在偏离路线的告警
+func (g *GPSModule) ActiveDeviations() []DeviationAlert {
+	return g.deviation.Active()
+}
+
+// ShiftStats 获取驾驶员当前班次累计的里程、行驶时间与怠速时间
+func (g *GPSModule) ShiftStats(id string) (ShiftStats, bool) {
+	return g.mileage.Stats(id)
+}
+
+// RecordPassengers 记录车辆的上下车人数并更新实时载客量，上车后超过载客上限时拒绝
+func (g *GPSModule) RecordPassengers(carID string, boarding, alighting int) (int, error) {
+	if carID == "" {
+		return 0, errors.New("car ID cannot be empty")
+	}
+
+	// 找到正在驾驶该车辆的驾驶员，用于确定线路与站点
+	g.driversMutex.Lock()
+	var driverID string
+	var routeID int
+	for _, driver := range g.drivers {
+		if driver.Car_ID == carID {
+			driverID, routeID = driver.ID, driver.RouteID
+			break
+		}
+	}
+	g.driversMutex.Unlock()
+
+	occupancy, err := g.occupancy.Apply(carID, boarding, alighting)
+	var capacityErr *websocket.CapacityError
+	if errors.As(err, &capacityErr) && alighting > 0 {
+		// 上车被拒绝，但下车人数已经计入载客量，仍然需要记录
+		boarding = 0
+	} else if err != nil {
+		return occupancy, err
+	}
+
+	if driverID != "" {
+		g.driversMutex.Lock()
+		if driver, exists := g.drivers[driverID]; exists {
+			driver.Occupancy = occupancy
+		}
+		g.driversMutex.Unlock()
+	}
+
+	site, _ := g.geofence.LastSite(driverID)
+	recordOccupancy(OccupancyRecord{
+		CarID:     carID,
+		DriverID:  driverID,
+		RouteID:   routeID,
+		SiteID:    site.ID,
+		Boarding:  boarding,
+		Alighting: alighting,
+		Occupancy: occupancy,
+		Capacity:  VehicleCapacity(carID),
+		Time:      time.Now(),
+	})
+	return occupancy, err
+}
+
+// Occupancies 获取所有车辆的实时载客量
+func (g *GPSModule) Occupancies() []VehicleOccupancy {
+	return g.occupancy.All()
+}
+
+// StopLoads 获取线路上各站点的上下车与载客统计，按站点在线路上的顺序排列
+func (g *GPSModule) StopLoads(routeID int, from, to string) ([]StopLoad, error) {
+	loads, err := queryStopLoads(routeID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make(map[int]int)
+	if geometry := g.routes.route(routeID); geometry != nil {
+		for i, stop := range geometry.Stops {
+			if _, exists := order[stop.Site.ID]; !exists {
+				order[stop.Site.ID] = i
+			}
+		}
+	}
+	rank := func(siteID int) int {
+		if i, exists := order[siteID]; exists {
+			return i
+		}
+		return len(order) + siteID // 不在线路上的站点排在最后
+	}
+	sort.Slice(loads, func(i, j int) bool { return rank(loads[i].SiteID) < rank(loads[j].SiteID) })
+	return loads, nil
+}
+
+// Headways 获取最近一次计算的各线路车辆间隔
+func (g *GPSModule) Headways() []RouteHeadway {
+	return g.headway.Current()
+}
+
 // GetAllDrivers 获取所有驾驶员的位置信息
 func (g *GPSModule) GetAllDrivers() []*Driver {
 	g.driversMutex.Lock()
@@ -144,7 +536,9 @@ func (g *GPSModule) GetAllDrivers() []*Driver {
 
 	drivers := make([]*Driver, 0, len(g.drivers))
 	for _, driver := range g.drivers {
-		drivers = append(drivers, driver)
+		// 返回副本，避免调用方在锁外读取时与位置更新竞争
+		copied := *driver
+		drivers = append(drivers, &copied)
 	}
 
 	return drivers
@@ -1,10 +1,13 @@
 package gps
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"login/websocket" // 引入 WebSocket API 模块
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // GPSAPI 提供对 GPS 模块的 HTTP 接口
@@ -25,6 +28,13 @@ func (api *GPSAPI) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/delete_driver", api.HandleDeleteDriver)
 	mux.HandleFunc("/create_passenger", api.HandleCreatePassenger)
 	mux.HandleFunc("/delete_passenger", api.HandleDeletePassenger)
+	mux.HandleFunc("/eta", api.HandleGetETA)
+	mux.HandleFunc("/admin/gps/drivers", api.HandleListDrivers)
+	mux.HandleFunc("/admin/gps/evict", api.HandleEvictDriver)
+	mux.HandleFunc("/admin/gps/replay", api.HandleReplay)
+	mux.HandleFunc("/admin/gps/headway", api.HandleGetHeadway)
+	mux.HandleFunc("/admin/gps/occupancy", api.HandleGetOccupancy)
+	mux.HandleFunc("/admin/gps/occupancy/profile", api.HandleGetStopLoads)
 }
 
 // HandleCreateDriver 处理创建驾驶员的请求
@@ -35,7 +45,8 @@ func (api *GPSAPI) HandleCreateDriver(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var requestData struct {
-		ID string `json:"id"`
+		ID      string `json:"id"`
+		RouteID int    `json:"route_id"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&requestData)
@@ -44,7 +55,7 @@ func (api *GPSAPI) HandleCreateDriver(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver, err := api.module.CreateDriver(requestData.ID) // 通过 GPSModule 调用创建方法
+	driver, err := api.module.CreateDriver(requestData.ID, requestData.RouteID) // 通过 GPSModule 调用创建方法
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -135,13 +146,182 @@ func (api *GPSAPI) HandleDeletePassenger(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte("Passenger deleted successfully"))
 }
 
+// HandleGetETA 处理到站预测查询请求，可通过 site_id 参数指定站点
+func (api *GPSAPI) HandleGetETA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	siteID := 0
+	if siteStr := r.URL.Query().Get("site_id"); siteStr != "" {
+		id, err := strconv.Atoi(siteStr)
+		if err != nil {
+			http.Error(w, "Invalid site_id", http.StatusBadRequest)
+			return
+		}
+		siteID = id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.module.GetETAs(siteID))
+}
+
+// HandleGetHeadway 查询各线路当前的车辆间隔，可通过 route_id 参数指定线路
+func (api *GPSAPI) HandleGetHeadway(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	routeID := 0
+	if routeStr := r.URL.Query().Get("route_id"); routeStr != "" {
+		id, err := strconv.Atoi(routeStr)
+		if err != nil {
+			http.Error(w, "Invalid route_id", http.StatusBadRequest)
+			return
+		}
+		routeID = id
+	}
+
+	headways := make([]RouteHeadway, 0)
+	for _, headway := range api.module.Headways() {
+		if routeID == 0 || headway.RouteID == routeID {
+			headways = append(headways, headway)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(headways)
+}
+
+// HandleGetOccupancy 查询所有车辆的实时载客量
+func (api *GPSAPI) HandleGetOccupancy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.module.Occupancies())
+}
+
+// HandleGetStopLoads 查询线路各站点的上下车与载客统计，参数 route_id 必填，start_time / end_time 可选
+func (api *GPSAPI) HandleGetStopLoads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	routeID, err := strconv.Atoi(query.Get("route_id"))
+	if err != nil || routeID <= 0 {
+		http.Error(w, "Invalid route_id", http.StatusBadRequest)
+		return
+	}
+	startTime, endTime := query.Get("start_time"), query.Get("end_time")
+	for _, value := range []string{startTime, endTime} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02 15:04:05", value); err != nil {
+			http.Error(w, "Invalid time, expected 2006-01-02 15:04:05", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loads, err := api.module.StopLoads(routeID, startTime, endTime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loads)
+}
+
+// HandleListDrivers 列出所有在线驾驶员及其状态，可通过 status 参数筛选（如 stale）
+func (api *GPSAPI) HandleListDrivers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	drivers := make([]*Driver, 0)
+	for _, driver := range api.module.GetAllDrivers() {
+		if status == "" || driver.Status == status {
+			drivers = append(drivers, driver)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drivers)
+}
+
+// HandleEvictDriver 管理员手动移除一个静默的驾驶员
+func (api *GPSAPI) HandleEvictDriver(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		ID string `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&requestData)
+	if err != nil || requestData.ID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = api.module.DeleteDriver(requestData.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Driver evicted successfully"))
+}
+
+// HandleReplay 获取驾驶员或车辆在时间窗口内的回放轨迹
+// 参数：driver_id 或 car_id（二选一）、from、to（格式 2006-01-02 15:04:05）、speed（回放倍速，默认 1）
+func (api *GPSAPI) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	speed := 1.0
+	if speedStr := query.Get("speed"); speedStr != "" {
+		value, err := strconv.ParseFloat(speedStr, 64)
+		if err != nil {
+			http.Error(w, "Invalid speed", http.StatusBadRequest)
+			return
+		}
+		speed = value
+	}
+
+	track, err := api.module.GetReplay(query.Get("driver_id"), query.Get("car_id"), query.Get("from"), query.Get("to"), speed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(track)
+}
+
 // CreateDriver 供内部模块调用来创建驾驶员
-func (api *GPSAPI) CreateDriver(ID string) (*Driver, error) {
+func (api *GPSAPI) CreateDriver(ID string, routeID int) (*Driver, error) {
 	if ID == "" {
 		return nil, fmt.Errorf("driver ID cannot be empty")
 	}
 	// 调用 GPSModule 中的方法来创建驾驶员
-	driver, err := api.module.CreateDriver(ID)
+	driver, err := api.module.CreateDriver(ID, routeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create driver: %v", err)
 	}
@@ -162,6 +342,76 @@ func (api *GPSAPI) DeleteDriver(ID string) error {
 	return nil
 }
 
+// ResumeShift 供内部模块调用来沿用服务重启后恢复的班次，返回班次开始时间
+func (api *GPSAPI) ResumeShift(ID, carID string, routeID int) (string, bool) {
+	if ID == "" {
+		return "", false
+	}
+	return api.module.ResumeShift(ID, carID, routeID)
+}
+
+// StartTrack 供内部模块调用来开始记录驾驶员的班次轨迹
+func (api *GPSAPI) StartTrack(ID, carID, shiftStart string) {
+	api.module.StartTrack(ID, carID, shiftStart)
+}
+
+// GetTrack 供内部模块调用来获取正在记录中的班次轨迹
+func (api *GPSAPI) GetTrack(ID, shiftStart string) ([]TrackPoint, bool) {
+	return api.module.GetTrack(ID, shiftStart)
+}
+
+// RouteShapes 获取全部路线的几何信息与站点
+func (api *GPSAPI) RouteShapes() []RouteShape {
+	return api.module.RouteShapes()
+}
+
+// GetAllDrivers 供内部模块调用来获取所有驾驶员的副本
+func (api *GPSAPI) GetAllDrivers() []*Driver {
+	return api.module.GetAllDrivers()
+}
+
+// GetETAs 供内部模块调用来获取到站预测，siteID 为 0 时返回所有站点
+func (api *GPSAPI) GetETAs(siteID int) []SiteETA {
+	return api.module.GetETAs(siteID)
+}
+
+// ActiveDeviations 供内部模块调用来获取当前仍在偏离路线的告警
+func (api *GPSAPI) ActiveDeviations() []DeviationAlert {
+	return api.module.ActiveDeviations()
+}
+
+// ShiftStats 供内部模块调用来获取驾驶员当前班次的里程与时间统计
+func (api *GPSAPI) ShiftStats(id string) (ShiftStats, bool) {
+	return api.module.ShiftStats(id)
+}
+
+// RecordPassengers 实现 websocket.PassengerCounter，记录上下车人数并返回实时载客量
+func (api *GPSAPI) RecordPassengers(carID string, boarding, alighting int) (int, error) {
+	return api.module.RecordPassengers(carID, boarding, alighting)
+}
+
+// Headways 供内部模块调用来获取各线路当前的车辆间隔
+func (api *GPSAPI) Headways() []RouteHeadway {
+	return api.module.Headways()
+}
+
+// DriverSnapshot 实现 websocket.DriverSnapshotProvider，客户端订阅时提供驾驶员快照
+func (api *GPSAPI) DriverSnapshot(sub *websocket.GPSSubscription) []byte {
+	return api.module.DriverSnapshot(sub)
+}
+
+// ConnectionClosed 实现 websocket.DisconnectListener，驾驶员连接断开时保存状态
+func (api *GPSAPI) ConnectionClosed(event websocket.DisconnectEvent) {
+	if event.Type == websocket.EventDriverDisconnected {
+		go api.module.driverDisconnected(event.DriverID)
+	}
+}
+
+// StreamReplay 实现 websocket.ReplayStreamer，通过 /ws 回放历史轨迹
+func (api *GPSAPI) StreamReplay(ctx context.Context, driverID, carID, startTime, endTime string, speed float64, send func([]byte) error) error {
+	return api.module.StreamReplay(ctx, driverID, carID, startTime, endTime, speed, send)
+}
+
 // CreatePassenger 内部调用的创建乘客方法
 func (api *GPSAPI) CreatePassenger(ID string) (*Passenger, error) {
 	if ID == "" {
@@ -204,6 +454,11 @@ func (api *GPSAPI) UpdateDriverLocation(id string, latitude, longitude float64,
 	return nil
 }
 
+// RestoreDrivers 根据未结束的班次恢复在班驾驶员，服务启动时调用
+func (api *GPSAPI) RestoreDrivers() (int, error) {
+	return api.module.RestoreDrivers()
+}
+
 // CreateDriver 供内部模块调用来创建驾驶员
 func (api *GPSAPI) StartBroadcast() {
 	api.module.StartBroadcast()
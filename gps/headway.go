@@ -0,0 +1,265 @@
+package gps
+
+import (
+	"login/config"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 相邻两车的间隔状态
+const (
+	HeadwayNormal   = "normal"   // 间隔正常
+	HeadwayBunching = "bunching" // 串车：与前车间隔过小
+	HeadwayGap      = "gap"      // 大间隔：与前车间隔过大
+)
+
+// 推送给驾驶员的调度建议
+const (
+	HeadwayActionHold     = "hold"      // 在下一站驻站等待，拉开与前车的距离
+	HeadwayActionSkipStop = "skip_stop" // 下一站只下不上，追赶前车
+	HeadwayActionResume   = "resume"    // 间隔已恢复正常，按正常方式运营
+)
+
+// HeadwaySpacing 同一线路上相邻两车（前车与后车）之间的间隔
+type HeadwaySpacing struct {
+	RouteID        int     `json:"route_id"`        // 线路编号
+	LeaderID       string  `json:"leader_id"`       // 前车驾驶员编号
+	LeaderCarID    string  `json:"leader_car_id"`   // 前车车牌号
+	FollowerID     string  `json:"follower_id"`     // 后车驾驶员编号
+	FollowerCarID  string  `json:"follower_car_id"` // 后车车牌号
+	SpacingMeters  float64 `json:"spacing_meters"`  // 沿线距离（米）
+	HeadwaySeconds int     `json:"headway_seconds"` // 按后车车速折算的时间间隔（秒）
+	TargetSeconds  int     `json:"target_seconds"`  // 目标间隔（秒）
+	Status         string  `json:"status"`          // normal、bunching 或 gap
+}
+
+// RouteHeadway 一条线路当前的间隔情况
+type RouteHeadway struct {
+	RouteID       int              `json:"route_id"`       // 线路编号
+	TargetSeconds int              `json:"target_seconds"` // 目标间隔（秒）
+	Buses         int              `json:"buses"`          // 参与计算的车辆数
+	Spacings      []HeadwaySpacing `json:"spacings"`       // 按后车沿线位置排序的相邻两车间隔
+}
+
+// HeadwayAction 调度建议，发送给后车驾驶员，同时抄送管理员客户端
+type HeadwayAction struct {
+	Type           string `json:"type"`            // 固定为 "headway_action"
+	Action         string `json:"action"`          // hold、skip_stop 或 resume
+	Status         string `json:"status"`          // 触发建议的间隔状态
+	DriverID       string `json:"driver_id"`       // 后车驾驶员编号
+	CarID          string `json:"car_id"`          // 后车车牌号
+	RouteID        int    `json:"route_id"`        // 线路编号
+	LeaderID       string `json:"leader_id"`       // 前车驾驶员编号
+	HeadwaySeconds int    `json:"headway_seconds"` // 当前与前车的间隔（秒）
+	TargetSeconds  int    `json:"target_seconds"`  // 目标间隔（秒）
+	HoldSeconds    int    `json:"hold_seconds"`    // 建议驻站等待的秒数，仅 hold 有效
+	SiteID         int    `json:"site_id"`         // 建议执行的站点（后车的下一站）
+	SiteName       string `json:"site_name"`       // 站点名称
+	Time           string `json:"time"`            // 建议生成时间
+}
+
+// headwayConfig 返回填充了默认值的间隔监控配置
+func headwayConfig() config.HeadwayConfig {
+	c := config.AppConfig.GPS.Headway
+	if c.TargetSeconds <= 0 {
+		c.TargetSeconds = 600
+	}
+	if c.BunchingRatio <= 0 || c.BunchingRatio >= 1 {
+		c.BunchingRatio = 0.5
+	}
+	if c.GapRatio <= 1 {
+		c.GapRatio = 1.5
+	}
+	if c.MaxHoldSeconds <= 0 {
+		c.MaxHoldSeconds = 180
+	}
+	return c
+}
+
+// headwayTarget 返回线路的目标间隔（秒）
+func headwayTarget(c config.HeadwayConfig, routeID int) int {
+	if target, ok := c.RouteTargets[routeID]; ok && target > 0 {
+		return target
+	}
+	return c.TargetSeconds
+}
+
+// HeadwayMonitor 根据到站预测引擎中的沿线进度计算同线路相邻车辆的间隔，识别串车与大间隔
+type HeadwayMonitor struct {
+	mu      sync.Mutex
+	routes  *routeCache
+	current []RouteHeadway
+	last    map[string]HeadwayAction // 后车驾驶员编号 -> 上次下发的建议
+}
+
+// NewHeadwayMonitor 创建间隔监控器
+func NewHeadwayMonitor(routes *routeCache) *HeadwayMonitor {
+	return &HeadwayMonitor{
+		routes:  routes,
+		current: make([]RouteHeadway, 0),
+		last:    make(map[string]HeadwayAction),
+	}
+}
+
+// Update 用最新的行驶进度重新计算各线路的间隔，返回间隔状态发生变化的后车对应的调度建议
+func (m *HeadwayMonitor) Update(progress []driverProgress, now time.Time) []HeadwayAction {
+	c := headwayConfig()
+	staleAfter := time.Duration(presenceConfig().StaleAfterSeconds) * time.Second
+
+	byRoute := make(map[int][]driverProgress)
+	for _, p := range progress {
+		// 长时间没有吸附到路线的车辆位置不可信，不参与计算
+		if now.Sub(p.At) > staleAfter {
+			continue
+		}
+		byRoute[p.RouteID] = append(byRoute[p.RouteID], p)
+	}
+
+	// 路线缓存过期时会重新加载，在持锁之前取得路线几何
+	routeIDs := make([]int, 0, len(byRoute))
+	geometries := make(map[int]*routeGeometry, len(byRoute))
+	for routeID := range byRoute {
+		if geometry := m.routes.route(routeID); geometry != nil {
+			routeIDs = append(routeIDs, routeID)
+			geometries[routeID] = geometry
+		}
+	}
+	sort.Ints(routeIDs)
+
+	headways := make([]RouteHeadway, 0, len(routeIDs))
+	var actions []HeadwayAction
+	seen := make(map[string]bool)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, routeID := range routeIDs {
+		geometry := geometries[routeID]
+		buses := byRoute[routeID]
+		sort.Slice(buses, func(i, j int) bool { return buses[i].Along < buses[j].Along })
+
+		target := headwayTarget(c, routeID)
+		headway := RouteHeadway{RouteID: routeID, TargetSeconds: target, Buses: len(buses), Spacings: make([]HeadwaySpacing, 0)}
+		length := geometry.Line.length()
+		closed := geometry.Line.closed()
+
+		for i, follower := range buses {
+			// 非环线上最前面的车没有前车；环线上最前面的车的前车是沿线位置最小的车
+			var leader driverProgress
+			var spacing float64
+			if i+1 < len(buses) {
+				leader = buses[i+1]
+				spacing = leader.Along - follower.Along
+			} else if closed && len(buses) > 1 {
+				leader = buses[0]
+				spacing = leader.Along + length - follower.Along
+			} else {
+				continue
+			}
+
+			speed := follower.Speed
+			if speed < 0.5 {
+				speed = defaultSpeed()
+			}
+			seconds := int(math.Round(spacing / speed))
+			status := HeadwayNormal
+			if float64(seconds) < float64(target)*c.BunchingRatio {
+				status = HeadwayBunching
+			} else if float64(seconds) > float64(target)*c.GapRatio {
+				status = HeadwayGap
+			}
+
+			headway.Spacings = append(headway.Spacings, HeadwaySpacing{
+				RouteID:        routeID,
+				LeaderID:       leader.DriverID,
+				LeaderCarID:    leader.CarID,
+				FollowerID:     follower.DriverID,
+				FollowerCarID:  follower.CarID,
+				SpacingMeters:  math.Round(spacing),
+				HeadwaySeconds: seconds,
+				TargetSeconds:  target,
+				Status:         status,
+			})
+			seen[follower.DriverID] = true
+
+			// 只在状态变化时下发建议，避免每次广播都打扰驾驶员
+			previous, exists := m.last[follower.DriverID]
+			if !exists {
+				previous.Status = HeadwayNormal
+			}
+			if status == previous.Status {
+				continue
+			}
+
+			action := HeadwayAction{
+				Type:           "headway_action",
+				Action:         HeadwayActionResume,
+				Status:         status,
+				DriverID:       follower.DriverID,
+				CarID:          follower.CarID,
+				RouteID:        routeID,
+				LeaderID:       leader.DriverID,
+				HeadwaySeconds: seconds,
+				TargetSeconds:  target,
+				Time:           now.Format("2006-01-02 15:04:05"),
+			}
+			switch status {
+			case HeadwayBunching:
+				action.Action = HeadwayActionHold
+				action.HoldSeconds = int(math.Min(float64(target-seconds), float64(c.MaxHoldSeconds)))
+			case HeadwayGap:
+				action.Action = HeadwayActionSkipStop
+			}
+			if stop := nextStop(geometry, follower.Along); stop != nil {
+				action.SiteID = stop.Site.ID
+				action.SiteName = stop.Site.Name
+			}
+			m.last[follower.DriverID] = action
+			actions = append(actions, action)
+		}
+		headways = append(headways, headway)
+	}
+
+	// 已下班、失联或成为线路头车的驾驶员不再有前车，撤销之前的建议并清除其状态
+	for driverID, previous := range m.last {
+		if seen[driverID] {
+			continue
+		}
+		if previous.Status != HeadwayNormal {
+			actions = append(actions, HeadwayAction{
+				Type:     "headway_action",
+				Action:   HeadwayActionResume,
+				Status:   HeadwayNormal,
+				DriverID: driverID,
+				CarID:    previous.CarID,
+				RouteID:  previous.RouteID,
+				Time:     now.Format("2006-01-02 15:04:05"),
+			})
+		}
+		delete(m.last, driverID)
+	}
+	m.current = headways
+	return actions
+}
+
+// nextStop 返回沿线位置之后的下一个站点，环线在末站之后回到首站
+func nextStop(geometry *routeGeometry, along float64) *routeStop {
+	for i := range geometry.Stops {
+		if geometry.Stops[i].Along > along {
+			return &geometry.Stops[i]
+		}
+	}
+	if geometry.Line.closed() && len(geometry.Stops) > 0 {
+		return &geometry.Stops[0]
+	}
+	return nil
+}
+
+// Current 获取最近一次计算的各线路间隔
+func (m *HeadwayMonitor) Current() []RouteHeadway {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RouteHeadway(nil), m.current...)
+}
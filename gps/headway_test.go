@@ -0,0 +1,104 @@
+package gps
+
+import (
+	"login/websocket"
+	"math"
+	"testing"
+	"time"
+)
+
+// testRouteCache 返回只包含一条直线路线（约 11 公里）的缓存，沿线 4000 米处有一个站点，不访问数据库
+func testRouteCache() *routeCache {
+	return &routeCache{
+		routes: map[int]*routeGeometry{
+			1: {
+				ID:    1,
+				Line:  newPolyline([][]float64{{0, 0}, {0.1, 0}}),
+				Stops: []routeStop{{Site: websocket.Site{ID: 7, Name: "中山路"}, Along: 4000}},
+			},
+		},
+		loadedAt: time.Now(),
+		version:  websocket.GeodataVersion(),
+	}
+}
+
+func TestHeadwayMonitorUpdate(t *testing.T) {
+	monitor := NewHeadwayMonitor(testRouteCache())
+	now := time.Now()
+	// 车速 10 米/秒，默认目标间隔 600 秒：间隔小于 3000 米为串车，大于 9000 米为大间隔
+	progress := func(followerAlong, leaderAlong float64, leaderAt time.Time) []driverProgress {
+		return []driverProgress{
+			{DriverID: "leader", CarID: "沪A1", RouteID: 1, Along: leaderAlong, At: leaderAt, Speed: 10},
+			{DriverID: "follower", CarID: "沪A2", RouteID: 1, Along: followerAlong, At: now, Speed: 10},
+			{DriverID: "elsewhere", CarID: "沪A3", RouteID: 2, Along: 100, At: now, Speed: 10}, // 没有几何的线路被忽略
+		}
+	}
+
+	if actions := monitor.Update(progress(0, 5000, now), now); len(actions) != 0 {
+		t.Fatalf("normal headway produced actions %+v", actions)
+	}
+	current := monitor.Current()
+	if len(current) != 1 || current[0].Buses != 2 || len(current[0].Spacings) != 1 {
+		t.Fatalf("current headways = %+v, want one route with one spacing", current)
+	}
+	if s := current[0].Spacings[0]; s.FollowerID != "follower" || s.LeaderID != "leader" || s.HeadwaySeconds != 500 || s.Status != HeadwayNormal {
+		t.Errorf("spacing = %+v", s)
+	}
+
+	// 串车：建议后车在下一站驻站，驻站时间不超过上限
+	actions := monitor.Update(progress(3000, 5000, now), now)
+	if len(actions) != 1 {
+		t.Fatalf("bunching produced %d actions, want 1", len(actions))
+	}
+	if a := actions[0]; a.Action != HeadwayActionHold || a.Status != HeadwayBunching || a.DriverID != "follower" ||
+		a.LeaderID != "leader" || a.HeadwaySeconds != 200 || a.HoldSeconds != 180 || a.SiteID != 7 {
+		t.Errorf("bunching action = %+v", a)
+	}
+
+	// 状态不变时不重复下发
+	if actions := monitor.Update(progress(3100, 5000, now), now); len(actions) != 0 {
+		t.Errorf("unchanged status produced actions %+v", actions)
+	}
+
+	// 大间隔：建议后车跳站追赶
+	actions = monitor.Update(progress(0, 9500, now), now)
+	if len(actions) != 1 || actions[0].Action != HeadwayActionSkipStop || actions[0].Status != HeadwayGap {
+		t.Fatalf("gap actions = %+v, want one skip_stop", actions)
+	}
+
+	// 前车定位过期后后车没有前车，撤销之前的建议
+	actions = monitor.Update(progress(0, 9500, now.Add(-time.Minute)), now)
+	if len(actions) != 1 || actions[0].Action != HeadwayActionResume || actions[0].Status != HeadwayNormal || actions[0].DriverID != "follower" {
+		t.Fatalf("stale leader actions = %+v, want one resume", actions)
+	}
+	if actions := monitor.Update(progress(0, 9500, now.Add(-time.Minute)), now); len(actions) != 0 {
+		t.Errorf("resume was sent twice: %+v", actions)
+	}
+}
+
+func TestHeadwayMonitorClosedLoop(t *testing.T) {
+	// 环线上最前面的车以沿线位置最小的车为前车
+	cache := &routeCache{
+		routes: map[int]*routeGeometry{
+			1: {ID: 1, Line: newPolyline([][]float64{{0, 0}, {0.05, 0}, {0.05, 0.05}, {0, 0.05}, {0, 0}})},
+		},
+		loadedAt: time.Now(),
+		version:  websocket.GeodataVersion(),
+	}
+	monitor := NewHeadwayMonitor(cache)
+	now := time.Now()
+	monitor.Update([]driverProgress{
+		{DriverID: "a", RouteID: 1, Along: 1000, At: now, Speed: 10},
+		{DriverID: "b", RouteID: 1, Along: 12000, At: now, Speed: 10},
+	}, now)
+
+	current := monitor.Current()
+	if len(current) != 1 || len(current[0].Spacings) != 2 {
+		t.Fatalf("current headways = %+v, want two spacings on the loop", current)
+	}
+	wrap := current[0].Spacings[1]
+	want := 1000 + cache.routes[1].Line.length() - 12000
+	if wrap.FollowerID != "b" || wrap.LeaderID != "a" || wrap.SpacingMeters != math.Round(want) {
+		t.Errorf("wrap-around spacing = %+v, want b following a by %.0f m", wrap, want)
+	}
+}
@@ -0,0 +1,54 @@
+package gps
+
+import (
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"time"
+)
+
+// 事件记录类型
+const (
+	IncidentRouteDeviation = "route_deviation"
+	IncidentOverspeed      = "overspeed"
+)
+
+// Incident 写入 incident_table 的一条事件记录，表结构见 migrations/001_incident_table.sql
+type Incident struct {
+	Type      string    // 事件类型
+	DriverID  string    // 驾驶员编号
+	CarID     string    // 车牌号
+	RouteID   int       // 线路编号
+	Location  Location  // 事件发生位置
+	Value     float64   // 事件数值，例如偏离距离（米）、最高车速（km/h）
+	StartTime time.Time // 事件开始时间
+	Note      string    // 备注
+}
+
+// recordIncident 写入一条事件记录，返回记录编号（失败时为 0）
+func recordIncident(incident Incident) int64 {
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"INSERT INTO incident_table (incident_type, driver_id, car_id, route_id, latitude, longitude, incident_value, incident_stime, incident_note) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		incident.Type, incident.DriverID, incident.CarID, incident.RouteID,
+		incident.Location.Latitude, incident.Location.Longitude, incident.Value,
+		incident.StartTime.Format("2006-01-02 15:04:05"), incident.Note)
+	if err != nil {
+		log_service.GPSLogger.Printf("记录事件 %s 失败：%v\n", incident.Type, err)
+		return 0
+	}
+	id, _ := result.(int64)
+	return id
+}
+
+// closeIncident 记录事件的结束时间，以及事件期间的最大数值
+func closeIncident(id int64, value float64, endTime time.Time) {
+	if id == 0 {
+		return
+	}
+	_, err := db.ExecuteSQL(config.RoleDriver,
+		"UPDATE incident_table SET incident_etime = ?, incident_value = GREATEST(incident_value, ?) WHERE incident_id = ?",
+		endTime.Format("2006-01-02 15:04:05"), value, id)
+	if err != nil {
+		log_service.GPSLogger.Printf("更新事件 %d 失败：%v\n", id, err)
+	}
+}
@@ -0,0 +1,124 @@
+package gps
+
+import (
+	"login/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// ShiftStats 一个班次内由定位流累计得到的里程与时间统计
+type ShiftStats struct {
+	DriverID      string  `json:"driver_id"`      // 驾驶员编号
+	DistanceKm    float64 `json:"distance_km"`    // 行驶里程（公里）
+	MovingSeconds int     `json:"moving_seconds"` // 行驶时间（秒）
+	IdleSeconds   int     `json:"idle_seconds"`   // 怠速时间（秒）
+}
+
+// mileageConfig 返回填充了默认值的里程统计配置
+func mileageConfig() config.MileageConfig {
+	c := config.AppConfig.GPS.Mileage
+	if c.MovingSpeedKmh <= 0 {
+		c.MovingSpeedKmh = 3
+	}
+	if c.MaxGapSeconds <= 0 {
+		c.MaxGapSeconds = 120
+	}
+	return c
+}
+
+// mileageState 单个驾驶员的累计状态
+type mileageState struct {
+	distance float64 // 米
+	moving   float64 // 秒
+	idle     float64 // 秒
+	last     Location
+	lastTime time.Time
+}
+
+// MileageTracker 按驾驶员累计班次内的行驶里程、行驶时间与怠速时间
+type MileageTracker struct {
+	mu     sync.Mutex
+	states map[string]*mileageState
+}
+
+// NewMileageTracker 创建里程统计器
+func NewMileageTracker() *MileageTracker {
+	return &MileageTracker{states: make(map[string]*mileageState)}
+}
+
+// Update 用一次已通过过滤的定位累计里程与时间
+func (t *MileageTracker) Update(driver Driver, now time.Time) {
+	cfg := mileageConfig()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, exists := t.states[driver.ID]
+	if !exists {
+		t.states[driver.ID] = &mileageState{last: driver.Location, lastTime: now}
+		return
+	}
+	if state.lastTime.IsZero() {
+		// 重启后恢复的累计值，第一次定位只作为起点
+		state.last = driver.Location
+		state.lastTime = now
+		return
+	}
+
+	dt := now.Sub(state.lastTime).Seconds()
+	distance := haversine(state.last, driver.Location)
+	state.last = driver.Location
+	state.lastTime = now
+	if dt <= 0 {
+		return
+	}
+
+	// 信号中断期间车辆至少行驶了两点间的直线距离，但无法判断是行驶还是怠速，只计里程不计时间
+	if dt > float64(cfg.MaxGapSeconds) {
+		state.distance += distance
+		return
+	}
+	if distance/dt*3.6 >= cfg.MovingSpeedKmh {
+		state.distance += distance
+		state.moving += dt
+	} else {
+		// 低速时的位移主要来自 GPS 抖动，不计入里程
+		state.idle += dt
+	}
+}
+
+// Stats 获取驾驶员当前班次的累计统计
+func (t *MileageTracker) Stats(driverID string) (ShiftStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, exists := t.states[driverID]
+	if !exists {
+		return ShiftStats{DriverID: driverID}, false
+	}
+	return ShiftStats{
+		DriverID:      driverID,
+		DistanceKm:    math.Round(state.distance) / 1000,
+		MovingSeconds: int(math.Round(state.moving)),
+		IdleSeconds:   int(math.Round(state.idle)),
+	}, true
+}
+
+// Restore 恢复服务重启前已累计的统计（重启期间的行驶不计入）
+func (t *MileageTracker) Restore(stats ShiftStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.states[stats.DriverID] = &mileageState{
+		distance: stats.DistanceKm * 1000,
+		moving:   float64(stats.MovingSeconds),
+		idle:     float64(stats.IdleSeconds),
+	}
+}
+
+// Remove 清除驾驶员的累计状态
+func (t *MileageTracker) Remove(driverID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, driverID)
+}
@@ -0,0 +1,62 @@
+package gps
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMileageTrackerUpdate(t *testing.T) {
+	tracker := NewMileageTracker()
+	start := time.Now()
+	origin := Location{Latitude: 31.2, Longitude: 121.4}
+	// 沿经线每 0.001 度约 111 米
+	north := func(steps float64) Location {
+		return Location{Latitude: origin.Latitude + 0.001*steps, Longitude: origin.Longitude}
+	}
+	update := func(loc Location, seconds int) {
+		tracker.Update(Driver{ID: "d1", Location: loc}, start.Add(time.Duration(seconds)*time.Second))
+	}
+
+	if _, exists := tracker.Stats("d1"); exists {
+		t.Fatal("stats exist before the first update")
+	}
+	update(origin, 0) // 第一个定位只作为起点
+	if stats, _ := tracker.Stats("d1"); stats != (ShiftStats{DriverID: "d1"}) {
+		t.Fatalf("stats after the first fix = %+v, want zero", stats)
+	}
+
+	update(north(1), 10)     // 约 40 km/h，计为行驶
+	update(north(1.001), 40) // 几乎不动，计为怠速，抖动不计里程
+	update(north(3), 340)    // 中断 300 秒，只计里程
+	update(north(3), 340)    // 同一时刻的重复定位不计时间
+
+	want := haversine(origin, north(1)) + haversine(north(1.001), north(3))
+	stats, exists := tracker.Stats("d1")
+	if !exists {
+		t.Fatal("stats missing after updates")
+	}
+	if stats.DistanceKm != math.Round(want)/1000 || stats.MovingSeconds != 10 || stats.IdleSeconds != 30 {
+		t.Errorf("stats = %+v, want %.3f km, 10 s moving, 30 s idle", stats, math.Round(want)/1000)
+	}
+
+	tracker.Remove("d1")
+	if _, exists := tracker.Stats("d1"); exists {
+		t.Error("stats still exist after Remove")
+	}
+}
+
+func TestMileageTrackerRestore(t *testing.T) {
+	tracker := NewMileageTracker()
+	tracker.Restore(ShiftStats{DriverID: "d1", DistanceKm: 12.5, MovingSeconds: 3600, IdleSeconds: 600})
+
+	// 恢复后第一个定位只作为起点，重启期间的行驶不计入
+	start := time.Now()
+	tracker.Update(Driver{ID: "d1", Location: Location{Latitude: 31.2, Longitude: 121.4}}, start)
+	tracker.Update(Driver{ID: "d1", Location: Location{Latitude: 31.201, Longitude: 121.4}}, start.Add(10*time.Second))
+
+	stats, _ := tracker.Stats("d1")
+	if stats.MovingSeconds != 3610 || stats.IdleSeconds != 600 || stats.DistanceKm <= 12.5 || stats.DistanceKm > 12.7 {
+		t.Errorf("stats after restore = %+v", stats)
+	}
+}
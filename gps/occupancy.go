@@ -0,0 +1,203 @@
+package gps
+
+import (
+	"database/sql"
+	"fmt"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"login/websocket"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OccupancyRecord 一次上下车事件及事件后的载客量，写入 occupancy_table（表结构见 migrations/003_occupancy_table.sql）
+type OccupancyRecord struct {
+	CarID     string
+	DriverID  string
+	RouteID   int
+	SiteID    int // 最近一次到达的站点，未知时为 0
+	Boarding  int
+	Alighting int
+	Occupancy int
+	Capacity  int
+	Time      time.Time
+}
+
+// VehicleOccupancy 车辆的实时载客量
+type VehicleOccupancy struct {
+	CarID     string `json:"car_id"`    // 车牌号
+	Occupancy int    `json:"occupancy"` // 当前载客量
+	Capacity  int    `json:"capacity"`  // 车辆载客量
+}
+
+// StopLoad 某个站点的上下车与载客统计
+type StopLoad struct {
+	SiteID       int     `json:"site_id"`       // 站点编号，0 表示无法确定站点的事件
+	SiteName     string  `json:"site_name"`     // 站点名称
+	Events       int     `json:"events"`        // 上下车事件数
+	Boarding     int     `json:"boarding"`      // 上车总人数
+	Alighting    int     `json:"alighting"`     // 下车总人数
+	AvgOccupancy float64 `json:"avg_occupancy"` // 事件后的平均载客量
+	MaxOccupancy int     `json:"max_occupancy"` // 事件后的最高载客量
+	AvgLoad      float64 `json:"avg_load"`      // 平均满载率（载客量 / 载客上限）
+}
+
+// occupancyConfig 返回填充了默认值的载客量配置
+func occupancyConfig() config.OccupancyConfig {
+	c := config.AppConfig.GPS.Occupancy
+	if c.DefaultCapacity <= 0 {
+		c.DefaultCapacity = 40
+	}
+	return c
+}
+
+// VehicleCapacity 返回车辆的载客上限
+func VehicleCapacity(carID string) int {
+	c := occupancyConfig()
+	if capacity, ok := c.Capacities[carID]; ok && capacity > 0 {
+		return capacity
+	}
+	return c.DefaultCapacity
+}
+
+// OccupancyTracker 按车牌号维护实时载客量
+type OccupancyTracker struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewOccupancyTracker 创建载客量统计器
+func NewOccupancyTracker() *OccupancyTracker {
+	return &OccupancyTracker{counts: make(map[string]int)}
+}
+
+// Apply 先下后上更新载客量，上车后超过载客上限时拒绝本次上车并返回 *websocket.CapacityError
+// 下车人数不受载客上限影响，上车被拒绝时仍然计入，返回的载客量与错误中的载客量一致
+func (t *OccupancyTracker) Apply(carID string, boarding, alighting int) (int, error) {
+	if boarding < 0 || alighting < 0 {
+		return 0, fmt.Errorf("上下车人数不能为负数")
+	}
+	capacity := VehicleCapacity(carID)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := t.counts[carID] - alighting
+	if count < 0 {
+		// 漏报上车时下车人数可能多于车上人数
+		count = 0
+	}
+	t.counts[carID] = count
+	if count+boarding > capacity {
+		return count, &websocket.CapacityError{CarID: carID, Occupancy: count, Capacity: capacity, Requested: boarding}
+	}
+	count += boarding
+	t.counts[carID] = count
+	return count, nil
+}
+
+// Count 获取车辆当前的载客量
+func (t *OccupancyTracker) Count(carID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.counts[carID]
+}
+
+// Set 直接设置车辆的载客量（重启后恢复时调用）
+func (t *OccupancyTracker) Set(carID string, occupancy int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if occupancy > 0 {
+		t.counts[carID] = occupancy
+	}
+}
+
+// Reset 将车辆载客量清零（下班时调用）
+func (t *OccupancyTracker) Reset(carID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counts, carID)
+}
+
+// All 获取所有有乘客记录的车辆的载客量，按车牌号排序
+func (t *OccupancyTracker) All() []VehicleOccupancy {
+	t.mu.Lock()
+	vehicles := make([]VehicleOccupancy, 0, len(t.counts))
+	for carID, count := range t.counts {
+		vehicles = append(vehicles, VehicleOccupancy{CarID: carID, Occupancy: count})
+	}
+	t.mu.Unlock()
+
+	for i := range vehicles {
+		vehicles[i].Capacity = VehicleCapacity(vehicles[i].CarID)
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].CarID < vehicles[j].CarID })
+	return vehicles
+}
+
+// recordOccupancy 写入一条上下车记录，并同步 car_table 中的乘客人数
+func recordOccupancy(record OccupancyRecord) {
+	_, err := db.ExecuteSQL(config.RoleDriver,
+		"INSERT INTO occupancy_table (car_id, driver_id, route_id, site_id, boarding, alighting, occupancy, capacity, occupancy_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		record.CarID, record.DriverID, record.RouteID, record.SiteID, record.Boarding, record.Alighting,
+		record.Occupancy, record.Capacity, record.Time.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log_service.GPSLogger.Printf("记录车辆 %s 的上下车失败：%v\n", record.CarID, err)
+	}
+	updateCarPassenger(record.CarID, record.Occupancy)
+}
+
+// updateCarPassenger 更新 car_table 中车辆的乘客人数
+func updateCarPassenger(carID string, occupancy int) {
+	_, err := db.ExecuteSQL(config.RoleDriver, "UPDATE car_table SET car_passenger = ? WHERE car_id = ?", occupancy, carID)
+	if err != nil {
+		log_service.GPSLogger.Printf("更新车辆 %s 的乘客人数失败：%v\n", carID, err)
+	}
+}
+
+// queryStopLoads 按站点汇总指定线路在时间范围内的上下车记录，from/to 为空时不限制
+func queryStopLoads(routeID int, from, to string) ([]StopLoad, error) {
+	sqlS := `SELECT o.site_id, COALESCE(MAX(s.site_name), ''), COUNT(*), SUM(o.boarding), SUM(o.alighting),
+		AVG(o.occupancy), MAX(o.occupancy), AVG(o.occupancy / NULLIF(o.capacity, 0))
+		FROM occupancy_table o LEFT JOIN site_table s ON s.site_id = o.site_id
+		WHERE o.route_id = ?`
+	args := []interface{}{routeID}
+	if from != "" {
+		sqlS += " AND o.occupancy_time >= ?"
+		args = append(args, from)
+	}
+	if to != "" {
+		sqlS += " AND o.occupancy_time <= ?"
+		args = append(args, to)
+	}
+	sqlS += " GROUP BY o.site_id"
+
+	result, err := db.ExecuteSQL(config.RoleDriver, sqlS, args...)
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return nil, fmt.Errorf("数据库返回结果格式错误")
+	}
+	defer rows.Close()
+
+	loads := make([]StopLoad, 0)
+	for rows.Next() {
+		var load StopLoad
+		var avgLoad sql.NullFloat64
+		if err := rows.Scan(&load.SiteID, &load.SiteName, &load.Events, &load.Boarding, &load.Alighting,
+			&load.AvgOccupancy, &load.MaxOccupancy, &avgLoad); err != nil {
+			return nil, err
+		}
+		load.AvgOccupancy = math.Round(load.AvgOccupancy*10) / 10
+		if avgLoad.Valid {
+			load.AvgLoad = math.Round(avgLoad.Float64*100) / 100
+		}
+		loads = append(loads, load)
+	}
+	return loads, rows.Err()
+}
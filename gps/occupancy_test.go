@@ -0,0 +1,60 @@
+package gps
+
+import (
+	"errors"
+	"login/config"
+	"login/websocket"
+	"testing"
+)
+
+func TestOccupancyTrackerApply(t *testing.T) {
+	saved := config.AppConfig.GPS.Occupancy
+	config.AppConfig.GPS.Occupancy = config.OccupancyConfig{Capacities: map[string]int{"沪S1": 10}}
+	t.Cleanup(func() { config.AppConfig.GPS.Occupancy = saved })
+
+	tracker := NewOccupancyTracker()
+	steps := []struct {
+		name      string
+		carID     string
+		boarding  int
+		alighting int
+		want      int
+		wantErr   *websocket.CapacityError
+	}{
+		{"board", "沪S1", 6, 0, 6, nil},
+		{"alight before boarding", "沪S1", 4, 2, 8, nil},
+		{"full", "沪S1", 2, 0, 10, nil},
+		// 上车被拒绝，下车仍然计入
+		{"over capacity is rejected", "沪S1", 3, 1, 9, &websocket.CapacityError{CarID: "沪S1", Occupancy: 9, Capacity: 10, Requested: 3}},
+		{"more alighting than on board", "沪S1", 0, 15, 0, nil},
+		{"default capacity", "沪D1", 40, 0, 40, nil},
+		{"over default capacity", "沪D1", 1, 0, 40, &websocket.CapacityError{CarID: "沪D1", Occupancy: 40, Capacity: 40, Requested: 1}},
+	}
+	for _, step := range steps {
+		got, err := tracker.Apply(step.carID, step.boarding, step.alighting)
+		if got != step.want {
+			t.Errorf("%s: occupancy = %d, want %d", step.name, got, step.want)
+		}
+		if step.wantErr == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", step.name, err)
+			}
+			continue
+		}
+		var capacityErr *websocket.CapacityError
+		if !errors.As(err, &capacityErr) || *capacityErr != *step.wantErr {
+			t.Errorf("%s: error = %v, want %+v", step.name, err, step.wantErr)
+			continue
+		}
+		if count := tracker.Count(step.carID); count != step.want || count != capacityErr.Occupancy {
+			t.Errorf("%s: stored occupancy %d, want %d as reported in the error", step.name, count, step.want)
+		}
+	}
+
+	if _, err := tracker.Apply("沪S1", -1, 0); err == nil {
+		t.Error("negative boarding accepted")
+	}
+	if _, err := tracker.Apply("沪S1", 0, -1); err == nil {
+		t.Error("negative alighting accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package gps
+
+import (
+	"encoding/json"
+	"login/config"
+	"login/log_service"
+	"login/websocket"
+	"time"
+)
+
+// 驾驶员在线状态
+const (
+	DriverStatusActive  = "active"  // 正常上报位置
+	DriverStatusStale   = "stale"   // 连接可能仍在，但一段时间未上报位置
+	DriverStatusExpired = "expired" // 长时间未上报位置，位置已不可信
+)
+
+// 失联后的处理方式
+const (
+	ExpireActionFlag  = "flag"
+	ExpireActionEvict = "evict"
+)
+
+// DriverPresenceEvent 驾驶员在线状态变化时推送给管理员的消息
+type DriverPresenceEvent struct {
+	Type          string `json:"type"` // 固定为 "driver_presence"
+	DriverID      string `json:"driver_id"`
+	CarID         string `json:"car_id"`
+	Status        string `json:"status"`         // 新的状态
+	LastUpdate    string `json:"last_update"`    // 最近一次上报位置的时间
+	SilentSeconds int    `json:"silent_seconds"` // 已静默的秒数
+	Evicted       bool   `json:"evicted"`        // 是否已被移除
+}
+
+// presenceConfig 返回填充了默认值的在线状态配置
+func presenceConfig() config.PresenceConfig {
+	c := config.AppConfig.GPS.Presence
+	if c.StaleAfterSeconds <= 0 {
+		c.StaleAfterSeconds = 30
+	}
+	if c.ExpireAfterSeconds <= 0 {
+		c.ExpireAfterSeconds = 300
+	}
+	if c.ExpireAfterSeconds < c.StaleAfterSeconds {
+		c.ExpireAfterSeconds = c.StaleAfterSeconds
+	}
+	if c.ExpireAction != ExpireActionEvict {
+		c.ExpireAction = ExpireActionFlag
+	}
+	return c
+}
+
+// presenceStatus 根据静默时长计算驾驶员状态
+func presenceStatus(silent time.Duration, c config.PresenceConfig) string {
+	switch {
+	case silent >= time.Duration(c.ExpireAfterSeconds)*time.Second:
+		return DriverStatusExpired
+	case silent >= time.Duration(c.StaleAfterSeconds)*time.Second:
+		return DriverStatusStale
+	default:
+		return DriverStatusActive
+	}
+}
+
+// sweepStaleDrivers 检查所有驾驶员的最近上报时间，更新状态并按配置移除失联驾驶员
+func (g *GPSModule) sweepStaleDrivers(now time.Time) {
+	c := presenceConfig()
+
+	var events []DriverPresenceEvent
+	var evictions []string
+
+	g.driversMutex.Lock()
+	for id, driver := range g.drivers {
+		status := presenceStatus(now.Sub(driver.lastSeen), c)
+		if status == driver.Status {
+			continue
+		}
+		driver.Status = status
+		event := DriverPresenceEvent{
+			Type:          "driver_presence",
+			DriverID:      id,
+			CarID:         driver.Car_ID,
+			Status:        status,
+			LastUpdate:    driver.LastUpdate,
+			SilentSeconds: int(now.Sub(driver.lastSeen).Seconds()),
+		}
+		if status == DriverStatusExpired && c.ExpireAction == ExpireActionEvict {
+			event.Evicted = true
+			evictions = append(evictions, id)
+		}
+		events = append(events, event)
+	}
+	g.driversMutex.Unlock()
+
+	for _, id := range evictions {
+		if err := g.DeleteDriver(id); err == nil {
+			log_service.GPSLogger.Printf("驾驶员 %s 长时间未上报位置，已自动移除\n", id)
+		}
+	}
+	for _, event := range events {
+		log_service.GPSLogger.Printf("驾驶员 %s 状态变为 %s，已静默 %d 秒\n", event.DriverID, event.Status, event.SilentSeconds)
+		eventData, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		g.webSocketAPI.SendMessage(eventData, websocket.ClientTypeAdmin)
+	}
+}
+
+// driverDisconnected 驾驶员的 WebSocket 连接断开时立即保存状态快照，掉线期间服务重启也不会丢失里程
+// 在线状态仍由定位上报时间决定，短暂断线重连不影响状态
+func (g *GPSModule) driverDisconnected(driverID string) {
+	g.driversMutex.Lock()
+	_, exists := g.drivers[driverID]
+	g.driversMutex.Unlock()
+	if !exists {
+		return
+	}
+	log_service.GPSLogger.Printf("驾驶员 %s 的连接已断开，保存状态快照\n", driverID)
+	g.snapshotDrivers()
+}
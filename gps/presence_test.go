@@ -0,0 +1,51 @@
+package gps
+
+import (
+	"login/config"
+	"testing"
+	"time"
+)
+
+func TestPresenceConfig(t *testing.T) {
+	saved := config.AppConfig.GPS.Presence
+	t.Cleanup(func() { config.AppConfig.GPS.Presence = saved })
+
+	tests := []struct {
+		name string
+		in   config.PresenceConfig
+		want config.PresenceConfig
+	}{
+		{"defaults", config.PresenceConfig{},
+			config.PresenceConfig{StaleAfterSeconds: 30, ExpireAfterSeconds: 300, ExpireAction: ExpireActionFlag}},
+		{"expire before stale", config.PresenceConfig{StaleAfterSeconds: 60, ExpireAfterSeconds: 20, ExpireAction: ExpireActionEvict},
+			config.PresenceConfig{StaleAfterSeconds: 60, ExpireAfterSeconds: 60, ExpireAction: ExpireActionEvict}},
+		{"unknown action", config.PresenceConfig{StaleAfterSeconds: 10, ExpireAfterSeconds: 100, ExpireAction: "delete"},
+			config.PresenceConfig{StaleAfterSeconds: 10, ExpireAfterSeconds: 100, ExpireAction: ExpireActionFlag}},
+	}
+	for _, tt := range tests {
+		config.AppConfig.GPS.Presence = tt.in
+		if got := presenceConfig(); got != tt.want {
+			t.Errorf("%s: config = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPresenceStatus(t *testing.T) {
+	c := config.PresenceConfig{StaleAfterSeconds: 30, ExpireAfterSeconds: 300}
+	tests := []struct {
+		silent time.Duration
+		want   string
+	}{
+		{0, DriverStatusActive},
+		{29 * time.Second, DriverStatusActive},
+		{30 * time.Second, DriverStatusStale},
+		{299 * time.Second, DriverStatusStale},
+		{300 * time.Second, DriverStatusExpired},
+		{time.Hour, DriverStatusExpired},
+	}
+	for _, tt := range tests {
+		if got := presenceStatus(tt.silent, c); got != tt.want {
+			t.Errorf("status after %v = %s, want %s", tt.silent, got, tt.want)
+		}
+	}
+}
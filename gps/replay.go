@@ -0,0 +1,204 @@
+package gps
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"sort"
+	"time"
+)
+
+// 时间格式，与 work_table 中的时间一致
+const timeLayout = "2006-01-02 15:04:05"
+
+// 回放时相邻两帧之间的最长等待，避免车辆长时间静止时回放停滞
+const maxReplayGap = 5 * time.Second
+
+// DriverStatusReplay 回放帧中驾驶员的状态，便于前端与实时位置区分
+const DriverStatusReplay = "replay"
+
+// ReplayPoint 回放轨迹中的一个点
+type ReplayPoint struct {
+	Time     string `json:"time"`      // 实际定位时间
+	OffsetMs int64  `json:"offset_ms"` // 按回放倍速换算后，距回放开始的毫秒数
+	Driver   Driver `json:"driver"`    // 与实时 driver_gps 广播相同格式的驾驶员信息
+}
+
+// ReplayTrack 一段时间窗口内的回放轨迹
+type ReplayTrack struct {
+	DriverID string        `json:"driver_id"`
+	CarID    string        `json:"car_id"`
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Speed    float64       `json:"speed"` // 回放倍速
+	Points   []ReplayPoint `json:"points"`
+}
+
+// historyPoint 从轨迹记录中读出的一个带时间的点
+type historyPoint struct {
+	at     time.Time
+	driver Driver
+}
+
+// queryHistory 读取驾驶员或车辆在时间窗口内的历史轨迹，按时间升序
+// 进行中的班次优先使用内存中尚未落库的轨迹
+func (g *GPSModule) queryHistory(driverID, carID string, from, to time.Time) ([]historyPoint, error) {
+	if driverID == "" && carID == "" {
+		return nil, errors.New("driver_id or car_id is required")
+	}
+
+	condition := "driver_id = ?"
+	arg := driverID
+	if driverID == "" {
+		condition = "car_id = ?"
+		arg = carID
+	}
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT work_stime, driver_id, route_id, car_id, record_route FROM work_table WHERE "+condition+
+			" AND work_stime <= ? AND (work_etime IS NULL OR work_etime >= ?)",
+		arg, to.Format(timeLayout), from.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	rows := result.(*sql.Rows)
+	defer rows.Close()
+
+	var points []historyPoint
+	for rows.Next() {
+		var shiftStart, shiftDriver, shiftCar string
+		var routeID int
+		var recordRoute sql.NullString
+		if err := rows.Scan(&shiftStart, &shiftDriver, &routeID, &shiftCar, &recordRoute); err != nil {
+			log_service.GPSLogger.Printf("读取历史班次失败：%v\n", err)
+			continue
+		}
+
+		track, live := g.recorder.Track(shiftDriver, shiftStart)
+		if !live && recordRoute.Valid && recordRoute.String != "" {
+			if err := json.Unmarshal([]byte(recordRoute.String), &track); err != nil {
+				log_service.GPSLogger.Printf("解析驾驶员 %s 的轨迹失败：%v\n", shiftDriver, err)
+				continue
+			}
+		}
+
+		for _, p := range track {
+			at, err := time.ParseInLocation(timeLayout, p.Time, time.Local)
+			if err != nil || at.Before(from) || at.After(to) {
+				continue
+			}
+			points = append(points, historyPoint{
+				at: at,
+				driver: Driver{
+					Type:       "driver_gps",
+					ID:         shiftDriver,
+					Location:   Location{Latitude: p.GPSY, Longitude: p.GPSX},
+					Car_ID:     shiftCar,
+					RouteID:    routeID,
+					Status:     DriverStatusReplay,
+					LastUpdate: p.Time,
+				},
+			})
+		}
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].at.Before(points[j].at) })
+	return points, nil
+}
+
+// parseReplayWindow 解析回放的时间窗口与倍速，倍速限制在 (0, 100]，默认 1
+func parseReplayWindow(fromStr, toStr string, speed float64) (time.Time, time.Time, float64, error) {
+	from, err := time.ParseInLocation(timeLayout, fromStr, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, errors.New("invalid start time, expected " + timeLayout)
+	}
+	to, err := time.ParseInLocation(timeLayout, toStr, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, errors.New("invalid end time, expected " + timeLayout)
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, 0, errors.New("end time must be after start time")
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	if speed > 100 {
+		speed = 100
+	}
+	return from, to, speed, nil
+}
+
+// GetReplay 获取驾驶员或车辆在时间窗口内的回放轨迹
+func (g *GPSModule) GetReplay(driverID, carID, fromStr, toStr string, speed float64) (*ReplayTrack, error) {
+	from, to, speed, err := parseReplayWindow(fromStr, toStr, speed)
+	if err != nil {
+		return nil, err
+	}
+	points, err := g.queryHistory(driverID, carID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &ReplayTrack{
+		DriverID: driverID,
+		CarID:    carID,
+		From:     from.Format(timeLayout),
+		To:       to.Format(timeLayout),
+		Speed:    speed,
+		Points:   make([]ReplayPoint, 0, len(points)),
+	}
+	for _, p := range points {
+		track.Points = append(track.Points, ReplayPoint{
+			Time:     p.at.Format(timeLayout),
+			OffsetMs: int64(float64(p.at.Sub(points[0].at).Milliseconds()) / speed),
+			Driver:   p.driver,
+		})
+	}
+	return track, nil
+}
+
+// StreamReplay 按回放倍速逐帧发送历史轨迹，每帧与实时 driver_gps 广播格式相同（驾驶员数组），
+// 结束时发送 replay_end；ctx 取消或 send 返回错误（例如连接已断开）时停止回放
+func (g *GPSModule) StreamReplay(ctx context.Context, driverID, carID, fromStr, toStr string, speed float64, send func([]byte) error) error {
+	from, to, speed, err := parseReplayWindow(fromStr, toStr, speed)
+	if err != nil {
+		return err
+	}
+	points, err := g.queryHistory(driverID, carID, from, to)
+	if err != nil {
+		return err
+	}
+	log_service.GPSLogger.Printf("开始回放驾驶员 %s / 车辆 %s 的轨迹，共 %d 帧，倍速 %.1f\n", driverID, carID, len(points), speed)
+
+	for i, p := range points {
+		if i > 0 {
+			gap := time.Duration(float64(p.at.Sub(points[i-1].at)) / speed)
+			if gap > maxReplayGap {
+				gap = maxReplayGap
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(gap):
+			}
+		}
+		frame, err := json.Marshal([]Driver{p.driver})
+		if err != nil {
+			continue
+		}
+		if err := send(frame); err != nil {
+			return err
+		}
+	}
+
+	end, _ := json.Marshal(map[string]interface{}{
+		"type":      "replay_end",
+		"driver_id": driverID,
+		"car_id":    carID,
+		"frames":    len(points),
+	})
+	return send(end)
+}
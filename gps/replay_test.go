@@ -0,0 +1,51 @@
+package gps
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReplayWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  string
+		speed     float64
+		wantSpeed float64
+		wantErr   bool
+	}{
+		{"default speed", "2024-05-01 08:00:00", "2024-05-01 09:00:00", 0, 1, false},
+		{"negative speed", "2024-05-01 08:00:00", "2024-05-01 09:00:00", -2, 1, false},
+		{"fast forward", "2024-05-01 08:00:00", "2024-05-01 09:00:00", 8, 8, false},
+		{"speed is capped", "2024-05-01 08:00:00", "2024-05-01 09:00:00", 500, 100, false},
+		{"bad start", "2024-05-01T08:00:00", "2024-05-01 09:00:00", 1, 0, true},
+		{"bad end", "2024-05-01 08:00:00", "09:00", 1, 0, true},
+		{"empty window", "2024-05-01 08:00:00", "2024-05-01 08:00:00", 1, 0, true},
+		{"reversed window", "2024-05-01 09:00:00", "2024-05-01 08:00:00", 1, 0, true},
+	}
+	for _, tt := range tests {
+		from, to, speed, err := parseReplayWindow(tt.from, tt.to, tt.speed)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: accepted %s ~ %s", tt.name, tt.from, tt.to)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if from.Format(timeLayout) != tt.from || to.Format(timeLayout) != tt.to || from.Location() != time.Local {
+			t.Errorf("%s: window = %v ~ %v", tt.name, from, to)
+		}
+		if speed != tt.wantSpeed {
+			t.Errorf("%s: speed = %v, want %v", tt.name, speed, tt.wantSpeed)
+		}
+	}
+}
+
+func TestQueryHistoryRequiresDriverOrCar(t *testing.T) {
+	g := &GPSModule{}
+	if _, err := g.queryHistory("", "", time.Now().Add(-time.Hour), time.Now()); err == nil {
+		t.Error("history queried without driver_id or car_id")
+	}
+}
@@ -0,0 +1,165 @@
+package gps
+
+import (
+	"login/config"
+	"login/log_service"
+	"login/websocket"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 路线与站点缓存的刷新间隔；通过 update_routes / update_sites 等修改时立即失效，不必等待过期
+const routeCacheTTL = time.Minute
+
+// routeStop 路线上的一个站点，以及它在路线上的投影位置
+type routeStop struct {
+	Site   websocket.Site
+	Along  float64 // 站点投影到路线上的沿线距离（米）
+	Offset float64 // 站点到路线的垂直距离（米）
+}
+
+// routeGeometry 一条路线的几何信息
+type routeGeometry struct {
+	ID    int
+	Line  *polyline
+	Stops []routeStop // 按沿线距离升序排列
+}
+
+// routeCache 缓存 assets/route{id}.json 中的路线几何以及 site_table 中的站点
+// 加载在锁外进行，完成后整体替换 routes 与 sites，读取方拿到的 map 与切片不会再被修改
+type routeCache struct {
+	mu       sync.Mutex
+	routes   map[int]*routeGeometry
+	sites    []websocket.Site
+	loadedAt time.Time
+	version  uint64 // 加载时的 websocket.GeodataVersion
+	loading  bool   // 是否有调用方正在加载，加载期间其他调用方继续使用旧数据
+}
+
+func newRouteCache() *routeCache {
+	return &routeCache{routes: make(map[int]*routeGeometry)}
+}
+
+// stopSnapMeters 站点距路线多少米以内视为该路线上的站点
+func stopSnapMeters() float64 {
+	if v := config.AppConfig.GPS.ETA.StopSnapMeters; v > 0 {
+		return v
+	}
+	return 60
+}
+
+// current 返回缓存的路线与站点，缓存过期或线路、站点被修改过时先重新加载
+func (c *routeCache) current() (map[int]*routeGeometry, []websocket.Site) {
+	version := websocket.GeodataVersion()
+	c.mu.Lock()
+	if c.loading || (version == c.version && time.Since(c.loadedAt) <= routeCacheTTL) {
+		routes, sites := c.routes, c.sites
+		c.mu.Unlock()
+		return routes, sites
+	}
+	c.loading = true
+	previousRoutes, previousSites := c.routes, c.sites
+	c.mu.Unlock()
+
+	routes, sites := loadRouteGeometries(previousRoutes, previousSites)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 无论成功与否都更新加载时间，避免数据库不可用时每次调用都重试
+	c.routes, c.sites = routes, sites
+	c.loadedAt = time.Now()
+	c.version = version
+	c.loading = false
+	return routes, sites
+}
+
+// loadRouteGeometries 加载路线与站点并计算每条路线上的站点，加载失败的部分沿用 previous
+func loadRouteGeometries(previousRoutes map[int]*routeGeometry, previousSites []websocket.Site) (map[int]*routeGeometry, []websocket.Site) {
+	routes, err := websocket.QueryRoutes()
+	if err != nil {
+		log_service.GPSLogger.Printf("加载路线失败：%v\n", err)
+		return previousRoutes, previousSites
+	}
+	sites, err := websocket.QuerySites()
+	if err != nil {
+		// 站点加载失败时保留旧站点，路线几何仍然可以使用
+		log_service.GPSLogger.Printf("加载站点失败：%v\n", err)
+		sites = previousSites
+	}
+
+	snap := stopSnapMeters()
+	geometries := make(map[int]*routeGeometry, len(routes))
+	for _, route := range routes {
+		line := newPolyline(route.Path)
+		if len(line.points) < 2 {
+			continue
+		}
+		geometry := &routeGeometry{ID: route.ID, Line: line}
+		for _, site := range sites {
+			along, offset := line.project(Location{Latitude: site.Location.Latitude, Longitude: site.Location.Longitude})
+			if offset <= snap {
+				geometry.Stops = append(geometry.Stops, routeStop{Site: site, Along: along, Offset: offset})
+			}
+		}
+		sort.Slice(geometry.Stops, func(i, j int) bool { return geometry.Stops[i].Along < geometry.Stops[j].Along })
+		geometries[route.ID] = geometry
+	}
+	return geometries, sites
+}
+
+// route 获取指定路线的几何信息
+func (c *routeCache) route(routeID int) *routeGeometry {
+	routes, _ := c.current()
+	return routes[routeID]
+}
+
+// allSites 获取 site_table 中的全部站点
+func (c *routeCache) allSites() []websocket.Site {
+	_, sites := c.current()
+	return sites
+}
+
+// RouteStop 供其他模块使用的路线站点信息
+type RouteStop struct {
+	SiteID   int      `json:"site_id"`
+	SiteName string   `json:"site_name"`
+	Location Location `json:"location"`
+	Along    float64  `json:"along"` // 站点投影到路线上的沿线距离（米）
+}
+
+// RouteShape 供其他模块使用的路线几何信息
+type RouteShape struct {
+	ID     int         `json:"id"`
+	Path   []Location  `json:"path"`
+	Dist   []float64   `json:"dist"`   // Dist[i] 为起点到 Path[i] 的沿线距离（米）
+	Length float64     `json:"length"` // 路线总长度（米）
+	Closed bool        `json:"closed"` // 是否为环线
+	Stops  []RouteStop `json:"stops"`  // 按沿线距离升序排列
+}
+
+// shapes 获取全部路线的几何信息，按路线编号升序
+func (c *routeCache) shapes() []RouteShape {
+	routes, _ := c.current()
+	shapes := make([]RouteShape, 0, len(routes))
+	for _, geometry := range routes {
+		shape := RouteShape{
+			ID:     geometry.ID,
+			Path:   append([]Location(nil), geometry.Line.points...),
+			Dist:   append([]float64(nil), geometry.Line.cumDist...),
+			Length: geometry.Line.length(),
+			Closed: geometry.Line.closed(),
+		}
+		for _, stop := range geometry.Stops {
+			shape.Stops = append(shape.Stops, RouteStop{
+				SiteID:   stop.Site.ID,
+				SiteName: stop.Site.Name,
+				Location: Location{Latitude: stop.Site.Location.Latitude, Longitude: stop.Site.Location.Longitude},
+				Along:    stop.Along,
+			})
+		}
+		shapes = append(shapes, shape)
+	}
+	sort.Slice(shapes, func(i, j int) bool { return shapes[i].ID < shapes[j].ID })
+	return shapes
+}
@@ -0,0 +1,229 @@
+package gps
+
+import (
+	"login/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// 超速告警类型
+const (
+	AlertOverspeed        = "overspeed"
+	AlertOverspeedCleared = "overspeed_cleared"
+)
+
+// 两次定位距离小于该值时不更新行驶方向，避免停车时 GPS 抖动导致方向乱跳
+const headingMinDistance = 3.0
+
+// OverspeedAlert 超速告警，推送给管理员客户端
+type OverspeedAlert struct {
+	Type       string   `json:"type"`        // overspeed 或 overspeed_cleared
+	DriverID   string   `json:"driver_id"`   // 驾驶员编号
+	CarID      string   `json:"car_id"`      // 车牌号
+	RouteID    int      `json:"route_id"`    // 线路编号
+	Location   Location `json:"location"`    // 当前位置
+	SpeedKmh   float64  `json:"speed"`       // 当前平滑车速（km/h）
+	MaxSpeed   float64  `json:"max_speed"`   // 本次超速的最高车速（km/h）
+	LimitKmh   float64  `json:"limit"`       // 适用的限速（km/h）
+	LimitName  string   `json:"limit_name"`  // 限速来源，例如区域名称
+	Since      string   `json:"since"`       // 开始超速的时间
+	Time       string   `json:"time"`        // 告警时间
+	IncidentID int64    `json:"incident_id"` // 对应 incident_table 中的记录
+
+	started time.Time // 开始超速的时间，作为事件记录的开始时间
+}
+
+// speedConfig 返回填充了默认值的车速配置
+func speedConfig() config.SpeedConfig {
+	c := config.AppConfig.GPS.Speed
+	if c.DefaultLimitKmh <= 0 {
+		c.DefaultLimitKmh = 30
+	}
+	if c.MinDurationSeconds <= 0 {
+		c.MinDurationSeconds = 10
+	}
+	if c.SmoothingFactor <= 0 || c.SmoothingFactor > 1 {
+		c.SmoothingFactor = 0.3
+	}
+	return c
+}
+
+// updateMotion 根据上一次定位计算驾驶员的瞬时车速、平滑车速与行驶方向，调用方需持有驾驶员锁
+func updateMotion(driver *Driver, location Location, now time.Time) {
+	if driver.locatedAt.IsZero() {
+		return
+	}
+	dt := now.Sub(driver.locatedAt).Seconds()
+	if dt <= 0 {
+		return
+	}
+	distance := haversine(driver.Location, location)
+	speed := distance / dt * 3.6
+
+	alpha := speedConfig().SmoothingFactor
+	driver.Speed = math.Round(speed*10) / 10
+	driver.SmoothedSpeed = math.Round((alpha*speed+(1-alpha)*driver.SmoothedSpeed)*10) / 10
+	if distance >= headingMinDistance {
+		driver.Heading = math.Round(bearing(driver.Location, location))
+	}
+}
+
+// overspeedState 单个驾驶员的超速状态
+type overspeedState struct {
+	since      time.Time // 开始超速的时间，零值表示当前未超速
+	maxSpeed   float64
+	limit      float64
+	limitName  string
+	alerted    bool
+	incidentID int64
+}
+
+// OverspeedDetector 将驾驶员的平滑车速与所在路段或区域的限速比较，持续超速时产生告警
+type OverspeedDetector struct {
+	mu     sync.Mutex
+	routes *routeCache
+	states map[string]*overspeedState
+}
+
+// NewOverspeedDetector 创建超速检测器
+func NewOverspeedDetector(routes *routeCache) *OverspeedDetector {
+	return &OverspeedDetector{
+		routes: routes,
+		states: make(map[string]*overspeedState),
+	}
+}
+
+// SpeedLimit 返回驾驶员当前位置适用的限速（km/h）及其来源，命中多个限速时取最低值
+func (o *OverspeedDetector) SpeedLimit(driver Driver) (float64, string) {
+	c := speedConfig()
+	limit, name := c.DefaultLimitKmh, "default"
+
+	for _, zone := range c.Zones {
+		if zone.LimitKmh <= 0 || zone.LimitKmh >= limit {
+			continue
+		}
+		if haversine(driver.Location, Location{Latitude: zone.Latitude, Longitude: zone.Longitude}) <= zone.RadiusMeters {
+			limit, name = zone.LimitKmh, zone.Name
+		}
+	}
+
+	if driver.RouteID == 0 {
+		return limit, name
+	}
+	var geometry *routeGeometry
+	var along float64
+	for _, segment := range c.Segments {
+		if segment.RouteID != driver.RouteID || segment.LimitKmh <= 0 || segment.LimitKmh >= limit {
+			continue
+		}
+		if geometry == nil {
+			if geometry = o.routes.route(driver.RouteID); geometry == nil {
+				break
+			}
+			var offset float64
+			if along, offset = geometry.Line.project(driver.Location); offset > etaMaxSnapOffset {
+				break // 不在线路上，路段限速不适用
+			}
+		}
+		if inSegment(geometry, along, segment.FromSiteID, segment.ToSiteID) {
+			limit, name = segment.LimitKmh, "segment"
+		}
+	}
+	return limit, name
+}
+
+// inSegment 判断沿线距离是否位于线路上两个站点之间，两个站点都为 0 时表示整条线路
+func inSegment(geometry *routeGeometry, along float64, fromSiteID, toSiteID int) bool {
+	if fromSiteID == 0 && toSiteID == 0 {
+		return true
+	}
+	from, to := -1.0, -1.0
+	for _, stop := range geometry.Stops {
+		if stop.Site.ID == fromSiteID {
+			from = stop.Along
+		}
+		if stop.Site.ID == toSiteID {
+			to = stop.Along
+		}
+	}
+	if from < 0 || to < 0 {
+		return false
+	}
+	if from <= to {
+		return along >= from && along <= to
+	}
+	// 环线上跨越起点的路段
+	return along >= from || along <= to
+}
+
+// Update 根据驾驶员的最新车速更新超速状态，返回本次产生的告警
+func (o *OverspeedDetector) Update(driver Driver, now time.Time) []OverspeedAlert {
+	limit, limitName := o.SpeedLimit(driver)
+	minDuration := time.Duration(speedConfig().MinDurationSeconds) * time.Second
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	state, exists := o.states[driver.ID]
+	if !exists {
+		state = &overspeedState{}
+		o.states[driver.ID] = state
+	}
+
+	newAlert := func(alertType string) OverspeedAlert {
+		return OverspeedAlert{
+			Type:       alertType,
+			DriverID:   driver.ID,
+			CarID:      driver.Car_ID,
+			RouteID:    driver.RouteID,
+			Location:   driver.Location,
+			SpeedKmh:   driver.SmoothedSpeed,
+			MaxSpeed:   state.maxSpeed,
+			LimitKmh:   state.limit,
+			LimitName:  state.limitName,
+			Since:      state.since.Format("2006-01-02 15:04:05"),
+			Time:       now.Format("2006-01-02 15:04:05"),
+			IncidentID: state.incidentID,
+			started:    state.since,
+		}
+	}
+
+	if driver.SmoothedSpeed <= limit {
+		var alerts []OverspeedAlert
+		if state.alerted {
+			alerts = append(alerts, newAlert(AlertOverspeedCleared))
+		}
+		*state = overspeedState{}
+		return alerts
+	}
+
+	if state.since.IsZero() {
+		state.since = now
+	}
+	state.maxSpeed = math.Max(state.maxSpeed, driver.SmoothedSpeed)
+	if state.limit == 0 || limit < state.limit {
+		state.limit, state.limitName = limit, limitName
+	}
+	if state.alerted || now.Sub(state.since) < minDuration {
+		return nil
+	}
+	state.alerted = true
+	return []OverspeedAlert{newAlert(AlertOverspeed)}
+}
+
+// SetIncident 关联本次超速对应的事件记录编号
+func (o *OverspeedDetector) SetIncident(driverID string, incidentID int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if state, exists := o.states[driverID]; exists {
+		state.incidentID = incidentID
+	}
+}
+
+// Remove 移除驾驶员的超速状态（下班时调用）
+func (o *OverspeedDetector) Remove(driverID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.states, driverID)
+}
@@ -0,0 +1,157 @@
+package gps
+
+import (
+	"login/config"
+	"login/websocket"
+	"math"
+	"testing"
+	"time"
+)
+
+// setSpeedConfig 临时修改车速配置，测试结束时恢复
+func setSpeedConfig(t *testing.T, c config.SpeedConfig) {
+	t.Helper()
+	saved := config.AppConfig.GPS.Speed
+	config.AppConfig.GPS.Speed = c
+	t.Cleanup(func() { config.AppConfig.GPS.Speed = saved })
+}
+
+func TestUpdateMotion(t *testing.T) {
+	setSpeedConfig(t, config.SpeedConfig{SmoothingFactor: 0.5})
+	start := time.Now()
+	driver := &Driver{Location: Location{Latitude: 31.2, Longitude: 121.4}}
+
+	// 第一次定位没有参照点，不计算车速
+	updateMotion(driver, Location{Latitude: 31.201, Longitude: 121.4}, start)
+	if driver.Speed != 0 || driver.SmoothedSpeed != 0 {
+		t.Fatalf("speed without a previous fix = %+v", driver)
+	}
+
+	driver.locatedAt = start
+	north := Location{Latitude: 31.201, Longitude: 121.4}
+	updateMotion(driver, north, start.Add(10*time.Second))
+	want := haversine(driver.Location, north) / 10 * 3.6
+	if driver.Speed != math.Round(want*10)/10 || driver.SmoothedSpeed != math.Round(want*0.5*10)/10 {
+		t.Errorf("speed = %v smoothed = %v, want %.1f and half of it", driver.Speed, driver.SmoothedSpeed, want)
+	}
+	if driver.Heading != 0 {
+		t.Errorf("heading = %v, want 0 (north)", driver.Heading)
+	}
+
+	driver.Location, driver.locatedAt = north, start.Add(10*time.Second)
+	updateMotion(driver, Location{Latitude: 31.201, Longitude: 121.401}, start.Add(20*time.Second))
+	if driver.Heading != 90 {
+		t.Errorf("heading = %v, want 90 (east)", driver.Heading)
+	}
+
+	// 移动距离太小时保留原方向，时间没有前进时不更新
+	heading, speed := driver.Heading, driver.Speed
+	updateMotion(driver, Location{Latitude: 31.20101, Longitude: 121.4}, start.Add(10*time.Second))
+	if driver.Heading != heading || driver.Speed != speed {
+		t.Errorf("fix at the same time changed motion: %+v", driver)
+	}
+}
+
+func TestSpeedLimit(t *testing.T) {
+	routes := testRouteCache()
+	routes.routes[1].Stops = []routeStop{
+		{Site: websocket.Site{ID: 1}, Along: 1000},
+		{Site: websocket.Site{ID: 2}, Along: 3000},
+	}
+	setSpeedConfig(t, config.SpeedConfig{
+		DefaultLimitKmh: 40,
+		Zones:           []config.SpeedZoneConfig{{Name: "校门", Latitude: 0, Longitude: 0.05, RadiusMeters: 200, LimitKmh: 20}},
+		Segments:        []config.SpeedSegmentConfig{{RouteID: 1, FromSiteID: 1, ToSiteID: 2, LimitKmh: 30}},
+	})
+	detector := NewOverspeedDetector(routes)
+
+	// 经度每 0.001 度约 111 米
+	tests := []struct {
+		name      string
+		driver    Driver
+		wantLimit float64
+		wantName  string
+	}{
+		{"default", Driver{RouteID: 1, Location: Location{Longitude: 0.08}}, 40, "default"},
+		{"segment between sites", Driver{RouteID: 1, Location: Location{Longitude: 0.018}}, 30, "segment"},
+		{"segment on another route", Driver{RouteID: 2, Location: Location{Longitude: 0.018}}, 40, "default"},
+		{"segment off the route", Driver{RouteID: 1, Location: Location{Latitude: 0.01, Longitude: 0.018}}, 40, "default"},
+		{"zone", Driver{Location: Location{Longitude: 0.0505}}, 20, "校门"},
+	}
+	for _, tt := range tests {
+		if limit, name := detector.SpeedLimit(tt.driver); limit != tt.wantLimit || name != tt.wantName {
+			t.Errorf("%s: limit = %v (%s), want %v (%s)", tt.name, limit, name, tt.wantLimit, tt.wantName)
+		}
+	}
+}
+
+func TestInSegment(t *testing.T) {
+	geometry := &routeGeometry{Stops: []routeStop{
+		{Site: websocket.Site{ID: 1}, Along: 1000},
+		{Site: websocket.Site{ID: 2}, Along: 3000},
+		{Site: websocket.Site{ID: 3}, Along: 5000},
+	}}
+	tests := []struct {
+		along    float64
+		from, to int
+		want     bool
+	}{
+		{2000, 1, 2, true},
+		{1000, 1, 2, true},
+		{4000, 1, 2, false},
+		{5500, 3, 1, true}, // 环线上跨越起点的路段
+		{500, 3, 1, true},
+		{2000, 3, 1, false},
+		{2000, 0, 0, true},  // 整条线路
+		{2000, 1, 9, false}, // 站点不在线路上
+	}
+	for _, tt := range tests {
+		if got := inSegment(geometry, tt.along, tt.from, tt.to); got != tt.want {
+			t.Errorf("inSegment(%v, %d, %d) = %v, want %v", tt.along, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestOverspeedDetectorUpdate(t *testing.T) {
+	setSpeedConfig(t, config.SpeedConfig{DefaultLimitKmh: 30, MinDurationSeconds: 10})
+	detector := NewOverspeedDetector(testRouteCache())
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	update := func(speed float64, seconds int) []OverspeedAlert {
+		return detector.Update(Driver{ID: "d1", Car_ID: "沪A1", SmoothedSpeed: speed}, start.Add(time.Duration(seconds)*time.Second))
+	}
+
+	steps := []struct {
+		name     string
+		speed    float64
+		seconds  int
+		wantType string
+	}{
+		{"under the limit", 25, 0, ""},
+		{"starts speeding", 35, 5, ""},
+		{"not long enough", 45, 14, ""},
+		{"overspeed confirmed", 40, 15, AlertOverspeed},
+		{"alerted only once", 50, 30, ""},
+		{"slows down", 28, 40, AlertOverspeedCleared},
+		{"stays slow", 28, 50, ""},
+	}
+	for _, step := range steps {
+		alerts := update(step.speed, step.seconds)
+		if step.wantType == "" {
+			if len(alerts) != 0 {
+				t.Fatalf("%s: unexpected alerts %+v", step.name, alerts)
+			}
+			continue
+		}
+		if len(alerts) != 1 || alerts[0].Type != step.wantType {
+			t.Fatalf("%s: alerts = %+v, want one %s", step.name, alerts, step.wantType)
+		}
+		alert := alerts[0]
+		// 事件从开始超速时算起，而不是确认告警的时间
+		if alert.Since != "2024-01-01 08:00:05" || !alert.started.Equal(start.Add(5*time.Second)) || alert.LimitKmh != 30 {
+			t.Errorf("%s: alert = %+v started = %v", step.name, alert, alert.started)
+		}
+	}
+	if alerts := update(50, 60); len(alerts) != 0 {
+		t.Errorf("new overspeed alerted immediately: %+v", alerts)
+	}
+}
@@ -0,0 +1,293 @@
+package gps
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DriverState 需要跨重启保留的驾驶员状态
+type DriverState struct {
+	Driver     Driver     // 驾驶员位置、线路、载客量等
+	ShiftStart string     // 所属班次的开始时间，恢复时与 work_table 中未结束的班次比对
+	Mileage    ShiftStats // 本班次已累计的里程与时间
+}
+
+// DriverStore 驾驶员状态的存储接口，GPSModule 定期保存快照，启动时读取以恢复在班驾驶员
+type DriverStore interface {
+	Save(states []DriverState) error // 写入或覆盖这些驾驶员的状态
+	Load() ([]DriverState, error)    // 读取所有已保存的状态
+	Delete(driverID string) error    // 删除驾驶员的状态（下班时调用）
+}
+
+// newDriverStore 根据配置创建驾驶员状态存储
+func newDriverStore() DriverStore {
+	if config.AppConfig.GPS.Store.Backend == "db" {
+		return NewDBDriverStore()
+	}
+	return NewMemoryDriverStore()
+}
+
+// snapshotInterval 返回快照间隔
+func snapshotInterval() time.Duration {
+	if v := config.AppConfig.GPS.Store.SnapshotSeconds; v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// MemoryDriverStore 仅保存在内存中的驾驶员状态，进程重启后丢失
+type MemoryDriverStore struct {
+	mu     sync.Mutex
+	states map[string]DriverState
+}
+
+// NewMemoryDriverStore 创建内存存储
+func NewMemoryDriverStore() *MemoryDriverStore {
+	return &MemoryDriverStore{states: make(map[string]DriverState)}
+}
+
+func (s *MemoryDriverStore) Save(states []DriverState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, state := range states {
+		s.states[state.Driver.ID] = state
+	}
+	return nil
+}
+
+func (s *MemoryDriverStore) Load() ([]DriverState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]DriverState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func (s *MemoryDriverStore) Delete(driverID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, driverID)
+	return nil
+}
+
+// DBDriverStore 将驾驶员状态快照保存到 driver_state_table（表结构见 migrations/004_driver_state_table.sql）
+type DBDriverStore struct{}
+
+// NewDBDriverStore 创建数据库存储
+func NewDBDriverStore() *DBDriverStore {
+	return &DBDriverStore{}
+}
+
+func (s *DBDriverStore) Save(states []DriverState) error {
+	savedAt := time.Now().Format("2006-01-02 15:04:05")
+	for _, state := range states {
+		d := state.Driver
+		_, err := db.ExecuteSQL(config.RoleDriver,
+			`INSERT INTO driver_state_table (driver_id, car_id, route_id, shift_start, latitude, longitude, heading, occupancy, last_update, distance_km, moving_seconds, idle_seconds, saved_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE car_id = VALUES(car_id), route_id = VALUES(route_id), shift_start = VALUES(shift_start),
+			latitude = VALUES(latitude), longitude = VALUES(longitude), heading = VALUES(heading), occupancy = VALUES(occupancy),
+			last_update = VALUES(last_update), distance_km = VALUES(distance_km), moving_seconds = VALUES(moving_seconds),
+			idle_seconds = VALUES(idle_seconds), saved_at = VALUES(saved_at)`,
+			d.ID, d.Car_ID, d.RouteID, state.ShiftStart, d.Location.Latitude, d.Location.Longitude, d.Heading, d.Occupancy,
+			d.LastUpdate, state.Mileage.DistanceKm, state.Mileage.MovingSeconds, state.Mileage.IdleSeconds, savedAt)
+		if err != nil {
+			return fmt.Errorf("save driver %s: %w", d.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *DBDriverStore) Load() ([]DriverState, error) {
+	config.AllowWarning = false
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT driver_id, car_id, route_id, shift_start, latitude, longitude, heading, occupancy, last_update, distance_km, moving_seconds, idle_seconds FROM driver_state_table")
+	config.AllowWarning = true
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return nil, fmt.Errorf("数据库返回结果格式错误")
+	}
+	defer rows.Close()
+
+	states := make([]DriverState, 0)
+	for rows.Next() {
+		var state DriverState
+		d := &state.Driver
+		if err := rows.Scan(&d.ID, &d.Car_ID, &d.RouteID, &state.ShiftStart, &d.Location.Latitude, &d.Location.Longitude,
+			&d.Heading, &d.Occupancy, &d.LastUpdate, &state.Mileage.DistanceKm, &state.Mileage.MovingSeconds, &state.Mileage.IdleSeconds); err != nil {
+			return nil, err
+		}
+		state.Mileage.DriverID = d.ID
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+func (s *DBDriverStore) Delete(driverID string) error {
+	_, err := db.ExecuteSQL(config.RoleDriver, "DELETE FROM driver_state_table WHERE driver_id = ?", driverID)
+	return err
+}
+
+// openShift work_table 中尚未结束的班次
+type openShift struct {
+	DriverID    string
+	CarID       string
+	RouteID     int
+	ShiftStart  string
+	RecordRoute []TrackPoint
+}
+
+// loadOpenShifts 查询 work_etime 为空的班次
+func loadOpenShifts() ([]openShift, error) {
+	config.AllowWarning = false
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT driver_id, car_id, route_id, DATE_FORMAT(work_stime, '%Y-%m-%d %H:%i:%s'), record_route FROM work_table WHERE work_etime IS NULL ORDER BY work_stime DESC")
+	config.AllowWarning = true
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return nil, fmt.Errorf("数据库返回结果格式错误")
+	}
+	defer rows.Close()
+
+	shifts := make([]openShift, 0)
+	for rows.Next() {
+		var shift openShift
+		var routeID sql.NullInt64
+		var recordRoute sql.NullString
+		if err := rows.Scan(&shift.DriverID, &shift.CarID, &routeID, &shift.ShiftStart, &recordRoute); err != nil {
+			return nil, err
+		}
+		shift.RouteID = int(routeID.Int64)
+		if recordRoute.Valid && recordRoute.String != "" {
+			if err := json.Unmarshal([]byte(recordRoute.String), &shift.RecordRoute); err != nil {
+				log_service.GPSLogger.Printf("解析驾驶员 %s 的已记录轨迹失败：%v\n", shift.DriverID, err)
+			}
+		}
+		shifts = append(shifts, shift)
+	}
+	return shifts, rows.Err()
+}
+
+// RestoreDrivers 根据 work_table 中未结束的班次恢复在班驾驶员，并用已保存的快照补全位置、载客量与里程
+// 返回恢复的驾驶员数量
+func (g *GPSModule) RestoreDrivers() (int, error) {
+	shifts, err := loadOpenShifts()
+	if err != nil {
+		return 0, fmt.Errorf("load open shifts: %w", err)
+	}
+	saved := make(map[string]DriverState)
+	states, err := g.store.Load()
+	if err != nil {
+		log_service.GPSLogger.Printf("读取驾驶员状态快照失败，仅按班次恢复：%v\n", err)
+	}
+	for _, state := range states {
+		saved[state.Driver.ID] = state
+	}
+
+	now := time.Now()
+	open := make(map[string]bool)
+	restored := 0
+	for _, shift := range shifts {
+		// 同一驾驶员有多条未结束的班次时以最新的一条为准（按开始时间降序，先处理的生效）
+		if open[shift.DriverID] {
+			continue
+		}
+		open[shift.DriverID] = true
+		driver := &Driver{
+			Type:     "driver_gps",
+			ID:       shift.DriverID,
+			Car_ID:   shift.CarID,
+			RouteID:  shift.RouteID,
+			Status:   DriverStatusActive,
+			Capacity: VehicleCapacity(shift.CarID),
+			lastSeen: now, // 给客户端重新连接留出与新上班相同的静默时间
+		}
+		state, hasState := saved[shift.DriverID]
+		if hasState && state.ShiftStart == shift.ShiftStart {
+			driver.Location = state.Driver.Location
+			driver.Heading = state.Driver.Heading
+			driver.LastUpdate = state.Driver.LastUpdate
+			driver.Occupancy = state.Driver.Occupancy
+		}
+
+		g.driversMutex.Lock()
+		_, exists := g.drivers[shift.DriverID]
+		if !exists {
+			g.drivers[shift.DriverID] = driver
+		}
+		g.driversMutex.Unlock()
+		if exists {
+			continue
+		}
+
+		g.recorder.Resume(shift.DriverID, shift.CarID, shift.ShiftStart, shift.RecordRoute)
+		if hasState && state.ShiftStart == shift.ShiftStart {
+			g.mileage.Restore(state.Mileage)
+			if shift.CarID != "" {
+				g.occupancy.Set(shift.CarID, state.Driver.Occupancy)
+			}
+		}
+		restored++
+		log_service.GPSLogger.Printf("已恢复在班驾驶员 %s（车牌 %s，线路 %d，班次开始于 %s）\n",
+			shift.DriverID, shift.CarID, shift.RouteID, shift.ShiftStart)
+	}
+
+	// 班次已结束的快照不再需要
+	for id := range saved {
+		if !open[id] {
+			if err := g.store.Delete(id); err != nil {
+				log_service.GPSLogger.Printf("删除驾驶员 %s 的状态快照失败：%v\n", id, err)
+			}
+		}
+	}
+	return restored, nil
+}
+
+// snapshotDrivers 将所有驾驶员的当前状态写入存储
+func (g *GPSModule) snapshotDrivers() {
+	drivers := g.GetAllDrivers()
+	if len(drivers) == 0 {
+		return
+	}
+	sort.Slice(drivers, func(i, j int) bool { return drivers[i].ID < drivers[j].ID })
+
+	states := make([]DriverState, 0, len(drivers))
+	for _, driver := range drivers {
+		stats, _ := g.mileage.Stats(driver.ID)
+		states = append(states, DriverState{
+			Driver:     *driver,
+			ShiftStart: g.recorder.ShiftStart(driver.ID),
+			Mileage:    stats,
+		})
+	}
+	if err := g.store.Save(states); err != nil {
+		log_service.GPSLogger.Printf("保存驾驶员状态快照失败：%v\n", err)
+	}
+}
+
+// startSnapshotLoop 按配置周期保存驾驶员状态快照
+func (g *GPSModule) startSnapshotLoop() {
+	go func() {
+		ticker := time.NewTicker(snapshotInterval())
+		defer ticker.Stop()
+
+		for range ticker.C {
+			g.snapshotDrivers()
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package gps
+
+import (
+	"login/config"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMemoryDriverStore(t *testing.T) {
+	store := NewMemoryDriverStore()
+	load := func() []DriverState {
+		states, err := store.Load()
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		sort.Slice(states, func(i, j int) bool { return states[i].Driver.ID < states[j].Driver.ID })
+		return states
+	}
+
+	first := DriverState{Driver: Driver{ID: "d1", Car_ID: "沪A1", RouteID: 1}, ShiftStart: "2024-05-01 08:00:00"}
+	second := DriverState{Driver: Driver{ID: "d2", Car_ID: "沪A2", RouteID: 2}, Mileage: ShiftStats{DriverID: "d2", DistanceKm: 3.5}}
+	if err := store.Save([]DriverState{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if states := load(); !reflect.DeepEqual(states, []DriverState{first, second}) {
+		t.Errorf("states = %+v", states)
+	}
+
+	// 再次保存覆盖同一驾驶员的旧快照
+	first.Mileage = ShiftStats{DriverID: "d1", DistanceKm: 1.2, MovingSeconds: 300}
+	if err := store.Save([]DriverState{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("d2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("unknown"); err != nil {
+		t.Errorf("deleting an unknown driver failed: %v", err)
+	}
+	if states := load(); !reflect.DeepEqual(states, []DriverState{first}) {
+		t.Errorf("states after overwrite and delete = %+v", states)
+	}
+}
+
+func TestDriverStoreConfig(t *testing.T) {
+	saved := config.AppConfig.GPS.Store
+	t.Cleanup(func() { config.AppConfig.GPS.Store = saved })
+
+	config.AppConfig.GPS.Store = config.StoreConfig{}
+	if _, ok := newDriverStore().(*MemoryDriverStore); !ok {
+		t.Error("default store is not the memory store")
+	}
+	if interval := snapshotInterval(); interval != 10*time.Second {
+		t.Errorf("default snapshot interval = %v", interval)
+	}
+
+	config.AppConfig.GPS.Store = config.StoreConfig{Backend: "db", SnapshotSeconds: 3}
+	if _, ok := newDriverStore().(*DBDriverStore); !ok {
+		t.Error("db backend did not create the database store")
+	}
+	if interval := snapshotInterval(); interval != 3*time.Second {
+		t.Errorf("snapshot interval = %v, want 3s", interval)
+	}
+}
@@ -0,0 +1,220 @@
+package gps
+
+import (
+	"encoding/json"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"sync"
+	"time"
+)
+
+// TrackPoint 轨迹中的一个点，字段与 work_table.record_route 中保存的 JSON 一致
+type TrackPoint struct {
+	Time string  `json:"time"`  // 时间戳
+	GPSX float64 `json:"gps_x"` // 经度
+	GPSY float64 `json:"gps_y"` // 纬度
+}
+
+// shiftTrack 一个班次正在记录的轨迹
+type shiftTrack struct {
+	DriverID   string
+	CarID      string
+	ShiftStart string // work_table.work_stime，用于定位该班次的记录
+	Points     []TrackPoint
+	lastAt     time.Time // 最近一个记录点的时间
+	lastLoc    Location  // 最近一个记录点的位置
+	dirty      bool      // 是否有尚未写入数据库的点
+
+	saveMu sync.Mutex // 串行化该班次的写入，FlushAll 与 Stop 可能同时在锁外写入
+	saved  int        // 已写入数据库的点数，由 saveMu 保护；轨迹只追加，点数越多越新
+}
+
+// TrajectoryRecorder 在上班与下班之间缓存驾驶员的轨迹，降采样后定期写入 work_table.record_route
+type TrajectoryRecorder struct {
+	mu     sync.Mutex
+	tracks map[string]*shiftTrack
+}
+
+// NewTrajectoryRecorder 创建轨迹记录器
+func NewTrajectoryRecorder() *TrajectoryRecorder {
+	return &TrajectoryRecorder{tracks: make(map[string]*shiftTrack)}
+}
+
+// trajectoryConfig 返回填充了默认值的轨迹配置
+func trajectoryConfig() config.TrajectoryConfig {
+	c := config.AppConfig.GPS.Trajectory
+	if c.MinIntervalSeconds <= 0 {
+		c.MinIntervalSeconds = 5
+	}
+	if c.MaxIntervalSeconds <= 0 {
+		c.MaxIntervalSeconds = 60
+	}
+	if c.MinDistanceMeters <= 0 {
+		c.MinDistanceMeters = 15
+	}
+	if c.FlushIntervalSeconds <= 0 {
+		c.FlushIntervalSeconds = 60
+	}
+	return c
+}
+
+// Start 开始记录一个班次的轨迹
+func (t *TrajectoryRecorder) Start(driverID, carID, shiftStart string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tracks[driverID] = &shiftTrack{DriverID: driverID, CarID: carID, ShiftStart: shiftStart}
+	log_service.GPSLogger.Printf("开始记录驾驶员 %s 的轨迹，班次开始于 %s\n", driverID, shiftStart)
+}
+
+// Resume 服务重启后继续记录班次轨迹，points 为已写入数据库的轨迹，避免被新的轨迹覆盖
+func (t *TrajectoryRecorder) Resume(driverID, carID, shiftStart string, points []TrackPoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	track := &shiftTrack{DriverID: driverID, CarID: carID, ShiftStart: shiftStart, Points: points, saved: len(points)}
+	t.tracks[driverID] = track
+	log_service.GPSLogger.Printf("继续记录驾驶员 %s 的轨迹，班次开始于 %s，已有 %d 个点\n", driverID, shiftStart, len(points))
+}
+
+// ShiftStart 获取正在记录的班次开始时间，未在记录时返回空字符串
+func (t *TrajectoryRecorder) ShiftStart(driverID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if track, exists := t.tracks[driverID]; exists {
+		return track.ShiftStart
+	}
+	return ""
+}
+
+// Record 记录一个定位点，按时间间隔和移动距离降采样
+func (t *TrajectoryRecorder) Record(driver Driver, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	track, exists := t.tracks[driver.ID]
+	if !exists {
+		return
+	}
+
+	c := trajectoryConfig()
+	if len(track.Points) > 0 {
+		elapsed := now.Sub(track.lastAt)
+		if elapsed < time.Duration(c.MinIntervalSeconds)*time.Second {
+			return
+		}
+		moved := haversine(track.lastLoc, driver.Location)
+		if moved < c.MinDistanceMeters && elapsed < time.Duration(c.MaxIntervalSeconds)*time.Second {
+			return
+		}
+	}
+
+	track.Points = append(track.Points, TrackPoint{
+		Time: now.Format("2006-01-02 15:04:05"),
+		GPSX: driver.Location.Longitude,
+		GPSY: driver.Location.Latitude,
+	})
+	track.CarID = driver.Car_ID
+	track.lastAt = now
+	track.lastLoc = driver.Location
+	track.dirty = true
+}
+
+// Track 获取正在记录的班次轨迹；shiftStart 为空时不校验班次开始时间
+func (t *TrajectoryRecorder) Track(driverID, shiftStart string) ([]TrackPoint, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	track, exists := t.tracks[driverID]
+	if !exists || (shiftStart != "" && track.ShiftStart != shiftStart) {
+		return nil, false
+	}
+	points := make([]TrackPoint, len(track.Points))
+	copy(points, track.Points)
+	return points, true
+}
+
+// Stop 停止记录并把剩余轨迹写入数据库（下班时调用）
+func (t *TrajectoryRecorder) Stop(driverID string) {
+	t.mu.Lock()
+	track, exists := t.tracks[driverID]
+	var points []TrackPoint
+	if exists {
+		delete(t.tracks, driverID)
+		points = track.Points
+	}
+	t.mu.Unlock()
+
+	if exists {
+		t.save(track, points)
+	}
+}
+
+// FlushAll 将所有有新点的轨迹写入数据库
+func (t *TrajectoryRecorder) FlushAll() {
+	type pending struct {
+		track  *shiftTrack
+		points []TrackPoint
+	}
+
+	t.mu.Lock()
+	var batch []pending
+	for _, track := range t.tracks {
+		if !track.dirty {
+			continue
+		}
+		points := make([]TrackPoint, len(track.Points))
+		copy(points, track.Points)
+		batch = append(batch, pending{track, points})
+		track.dirty = false
+	}
+	t.mu.Unlock()
+
+	// 在锁外访问数据库
+	for _, p := range batch {
+		t.save(p.track, p.points)
+	}
+}
+
+// StartFlushLoop 按配置周期把轨迹写入数据库
+func (t *TrajectoryRecorder) StartFlushLoop() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(trajectoryConfig().FlushIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			t.FlushAll()
+		}
+	}()
+}
+
+// save 将整段轨迹覆盖写入对应班次的 record_route
+// 同一班次的写入串行进行，比已写入的轨迹更旧（点数更少）的快照直接丢弃，不会覆盖完整的轨迹
+func (t *TrajectoryRecorder) save(track *shiftTrack, points []TrackPoint) {
+	track.saveMu.Lock()
+	defer track.saveMu.Unlock()
+
+	if len(points) == 0 || len(points) <= track.saved {
+		return
+	}
+	if err := writeRecordRoute(track.DriverID, track.ShiftStart, points); err != nil {
+		log_service.GPSLogger.Printf("写入驾驶员 %s 的轨迹失败：%v\n", track.DriverID, err)
+		return
+	}
+	track.saved = len(points)
+	log_service.GPSLogger.Printf("已写入驾驶员 %s 的轨迹，共 %d 个点\n", track.DriverID, len(points))
+}
+
+// writeRecordRoute 将轨迹写入 work_table.record_route
+var writeRecordRoute = func(driverID, shiftStart string, points []TrackPoint) error {
+	data, err := json.Marshal(points)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecuteSQL(config.RoleDriver,
+		"UPDATE work_table SET record_route = ? WHERE driver_id = ? AND work_stime = ?",
+		string(data), driverID, shiftStart)
+	return err
+}
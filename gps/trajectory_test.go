@@ -0,0 +1,129 @@
+package gps
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubRecordRoute 替换 writeRecordRoute，记录每次写入的点数，测试结束时恢复
+func stubRecordRoute(t *testing.T) func() []int {
+	t.Helper()
+	var mu sync.Mutex
+	var writes []int
+	saved := writeRecordRoute
+	writeRecordRoute = func(driverID, shiftStart string, points []TrackPoint) error {
+		mu.Lock()
+		defer mu.Unlock()
+		writes = append(writes, len(points))
+		return nil
+	}
+	t.Cleanup(func() { writeRecordRoute = saved })
+	return func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), writes...)
+	}
+}
+
+func TestTrajectoryRecordDownsamples(t *testing.T) {
+	stubRecordRoute(t)
+	rec := NewTrajectoryRecorder()
+	rec.Start("d1", "沪A1", "2024-01-01 08:00:00")
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)
+	origin := Location{Latitude: 31.2, Longitude: 121.4}
+	moved := Location{Latitude: 31.201, Longitude: 121.4} // 约 111 米
+
+	steps := []struct {
+		name    string
+		loc     Location
+		seconds int
+		want    int
+	}{
+		{"first point is always kept", origin, 0, 1},
+		{"too soon", moved, 3, 1},
+		{"moved far enough", moved, 6, 2},
+		{"standing still", moved, 30, 2},
+		{"standing still past the max interval", moved, 70, 3},
+	}
+	for _, step := range steps {
+		rec.Record(Driver{ID: "d1", Car_ID: "沪A1", Location: step.loc}, start.Add(time.Duration(step.seconds)*time.Second))
+		points, ok := rec.Track("d1", "")
+		if !ok || len(points) != step.want {
+			t.Fatalf("%s: %d points, want %d", step.name, len(points), step.want)
+		}
+	}
+
+	points, _ := rec.Track("d1", "2024-01-01 08:00:00")
+	if p := points[1]; p.Time != "2024-01-01 08:00:06" || p.GPSX != moved.Longitude || p.GPSY != moved.Latitude {
+		t.Errorf("second point = %+v", p)
+	}
+	if _, ok := rec.Track("d1", "2024-01-02 08:00:00"); ok {
+		t.Error("track returned for another shift")
+	}
+	rec.Record(Driver{ID: "unknown", Location: origin}, start)
+	if _, ok := rec.Track("unknown", ""); ok {
+		t.Error("recorded a driver without a shift")
+	}
+}
+
+func TestTrajectoryOlderSnapshotDoesNotOverwrite(t *testing.T) {
+	writes := stubRecordRoute(t)
+	rec := NewTrajectoryRecorder()
+	rec.Resume("d1", "沪A1", "2024-01-01 08:00:00", []TrackPoint{{Time: "2024-01-01 08:00:00"}})
+	track := rec.tracks["d1"]
+
+	full := []TrackPoint{{}, {}, {}}
+	rec.save(track, full)
+	rec.save(track, full[:2]) // FlushAll 在 Stop 之前复制、之后才写入的旧快照
+	rec.save(track, full[:1]) // 重启前已写入的轨迹不重复写入
+	if got := writes(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("writes = %v, want only the full track [3]", got)
+	}
+}
+
+func TestTrajectoryConcurrentFlushAndStop(t *testing.T) {
+	writes := stubRecordRoute(t)
+	rec := NewTrajectoryRecorder()
+	rec.Start("d1", "沪A1", "2024-01-01 08:00:00")
+	start := time.Now()
+
+	const points = 50
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < points; i++ {
+			// 每次间隔超过最大采样间隔，每个点都会被记录
+			rec.Record(Driver{ID: "d1", Location: Location{Latitude: 31.2, Longitude: 121.4}}, start.Add(time.Duration(i)*time.Minute))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < points; i++ {
+			rec.FlushAll()
+		}
+	}()
+	wg.Wait()
+
+	var flushers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		flushers.Add(1)
+		go func() {
+			defer flushers.Done()
+			rec.FlushAll()
+		}()
+	}
+	rec.Stop("d1")
+	flushers.Wait()
+
+	got := writes()
+	if len(got) == 0 || got[len(got)-1] != points {
+		t.Fatalf("writes = %v, want the last write to hold all %d points", got, points)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Errorf("write %d has %d points after a write of %d", i, got[i], got[i-1])
+		}
+	}
+}
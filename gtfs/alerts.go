@@ -0,0 +1,211 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"errors"
+	"login/log_service"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 告警原因与影响，管理员发布告警时使用的名称
+var (
+	alertCauses = map[string]int{
+		"other":             causeOther,
+		"technical_problem": causeTechnical,
+		"accident":          causeAccident,
+		"weather":           causeWeather,
+		"maintenance":       causeMaintenance,
+		"construction":      causeConstruct,
+	}
+	alertEffects = map[string]int{
+		"no_service":         effectNoService,
+		"reduced_service":    effectReducedService,
+		"significant_delays": effectSignificantDelays,
+		"detour":             effectDetour,
+		"modified_service":   effectModifiedService,
+		"stop_moved":         effectStopMoved,
+		"other":              effectOtherEffect,
+	}
+)
+
+// ServiceAlert 管理员发布的服务告警，例如停运、站点临时迁移
+type ServiceAlert struct {
+	ID          int    `json:"id"`
+	Header      string `json:"header"`      // 告警标题
+	Description string `json:"description"` // 告警内容
+	RouteID     int    `json:"route_id"`    // 影响的线路，0 表示不限
+	StopID      int    `json:"stop_id"`     // 影响的站点，0 表示不限
+	Cause       string `json:"cause"`       // 原因，见 alertCauses
+	Effect      string `json:"effect"`      // 影响，见 alertEffects
+	Start       string `json:"start"`       // 生效时间，为空表示立即生效
+	End         string `json:"end"`         // 失效时间，为空表示一直有效
+}
+
+// toFeed 转换为 GTFS-Realtime 告警
+func (a *ServiceAlert) toFeed(language string) *Alert {
+	alert := &Alert{
+		Cause:           causeUnknown,
+		Effect:          effectUnknownEffect,
+		HeaderText:      a.Header,
+		DescriptionText: a.Description,
+		Language:        language,
+	}
+	if cause, ok := alertCauses[a.Cause]; ok {
+		alert.Cause = cause
+	}
+	if effect, ok := alertEffects[a.Effect]; ok {
+		alert.Effect = effect
+	}
+	if start, err := time.ParseInLocation(timeLayout, a.Start, time.Local); err == nil {
+		alert.Start = uint64(start.Unix())
+	}
+	if end, err := time.ParseInLocation(timeLayout, a.End, time.Local); err == nil {
+		alert.End = uint64(end.Unix())
+	}
+
+	selector := EntitySelector{AgencyID: agencyID}
+	if a.RouteID != 0 {
+		selector = EntitySelector{RouteID: strconv.Itoa(a.RouteID)}
+	}
+	if a.StopID != 0 {
+		selector.AgencyID = ""
+		selector.StopID = strconv.Itoa(a.StopID)
+	}
+	alert.InformedEntity = []EntitySelector{selector}
+	return alert
+}
+
+// validate 检查告警内容与时间格式
+func (a *ServiceAlert) validate() error {
+	if a.Header == "" {
+		return errors.New("header is required")
+	}
+	if _, ok := alertCauses[a.Cause]; a.Cause != "" && !ok {
+		return errors.New("unknown cause: " + a.Cause)
+	}
+	if _, ok := alertEffects[a.Effect]; a.Effect != "" && !ok {
+		return errors.New("unknown effect: " + a.Effect)
+	}
+	for _, t := range []string{a.Start, a.End} {
+		if _, err := time.ParseInLocation(timeLayout, t, time.Local); t != "" && err != nil {
+			return errors.New("invalid time, expected " + timeLayout)
+		}
+	}
+	return nil
+}
+
+// AlertStore 保存管理员发布的服务告警（仅保存在内存中，服务重启后需重新发布）
+type AlertStore struct {
+	mu     sync.Mutex
+	nextID int
+	alerts map[int]ServiceAlert
+}
+
+// NewAlertStore 创建告警存储
+func NewAlertStore() *AlertStore {
+	return &AlertStore{nextID: 1, alerts: make(map[int]ServiceAlert)}
+}
+
+// Add 发布一条告警，返回带编号的告警
+func (s *AlertStore) Add(alert ServiceAlert) (ServiceAlert, error) {
+	if err := alert.validate(); err != nil {
+		return alert, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert.ID = s.nextID
+	s.nextID++
+	s.alerts[alert.ID] = alert
+	log_service.GPSLogger.Printf("发布服务告警 %d：%s\n", alert.ID, alert.Header)
+	return alert, nil
+}
+
+// Delete 撤销一条告警
+func (s *AlertStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.alerts[id]; !exists {
+		return errors.New("alert not found")
+	}
+	delete(s.alerts, id)
+	log_service.GPSLogger.Printf("撤销服务告警 %d\n", id)
+	return nil
+}
+
+// All 获取全部告警，按编号升序
+func (s *AlertStore) All() []ServiceAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alerts := make([]ServiceAlert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ID < alerts[j].ID })
+	return alerts
+}
+
+// Active 获取当前时间仍然有效（未过期）的告警
+func (s *AlertStore) Active(now time.Time) []ServiceAlert {
+	var active []ServiceAlert
+	for _, alert := range s.All() {
+		if end, err := time.ParseInLocation(timeLayout, alert.End, time.Local); err == nil && now.After(end) {
+			continue
+		}
+		active = append(active, alert)
+	}
+	return active
+}
+
+// HandleAlerts GET 列出全部告警，POST 发布一条告警
+func (s *AlertStore) HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.All())
+	case http.MethodPost:
+		var alert ServiceAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		alert, err := s.Add(alert)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleDeleteAlert 撤销一条告警，请求体 {"id": 1}
+func (s *AlertStore) HandleDeleteAlert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.ID == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := s.Delete(requestData.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Alert deleted successfully"))
+}
@@ -0,0 +1,89 @@
+package gtfs
+
+import (
+	"bytes"
+	"login/config"
+	"login/gps"
+	"login/log_service"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RouteSource 提供路线几何与站点，由 gps.GPSAPI 实现
+type RouteSource interface {
+	RouteShapes() []gps.RouteShape
+}
+
+// Exporter 将校园巴士的线路、站点与班次导出为 GTFS 数据
+type Exporter struct {
+	source RouteSource
+}
+
+// NewExporter 创建 GTFS 导出器
+func NewExporter(source RouteSource) *Exporter {
+	return &Exporter{source: source}
+}
+
+// RegisterRoutes 注册 HTTP 路由
+func (e *Exporter) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/gtfs/static.zip", e.HandleStaticZip)
+}
+
+// HandleStaticZip 下载 GTFS 静态数据压缩包
+func (e *Exporter) HandleStaticZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteStatic(&buf, time.Now()); err != nil {
+		log_service.GPSLogger.Printf("生成 GTFS 静态数据失败：%v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gtfs.zip"`)
+	w.Write(buf.Bytes())
+}
+
+// ExportStaticFile 将 GTFS 静态数据写入磁盘（命令行模式使用）
+func (e *Exporter) ExportStaticFile(path string) error {
+	var buf bytes.Buffer
+	if err := e.WriteStatic(&buf, time.Now()); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// gtfsConfig 返回填充了默认值的 GTFS 配置
+func gtfsConfig() config.GTFSConfig {
+	c := config.AppConfig.GTFS
+	if c.AgencyName == "" {
+		c.AgencyName = "Campus Bus"
+	}
+	if c.AgencyURL == "" {
+		c.AgencyURL = "https://sysuschoolbus.top"
+	}
+	if c.Timezone == "" {
+		c.Timezone = "Asia/Shanghai"
+	}
+	if c.ServiceStart == "" {
+		c.ServiceStart = "07:30:00"
+	}
+	if c.ServiceEnd == "" {
+		c.ServiceEnd = "21:30:00"
+	}
+	if c.HeadwayMinutes <= 0 {
+		c.HeadwayMinutes = 15
+	}
+	if c.SpeedKmh <= 0 {
+		c.SpeedKmh = 15
+	}
+	if c.DwellSeconds < 0 {
+		c.DwellSeconds = 0
+	}
+	return c
+}
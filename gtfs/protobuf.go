@@ -0,0 +1,333 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 以下结构体对应 gtfs-realtime.proto 中用到的消息，字段编号与官方定义一致
+// 只实现了本系统需要的字段，直接用 protowire 编码，不依赖生成代码
+
+// GTFS-Realtime 枚举值
+const (
+	incrementalityFullDataset = 0
+
+	scheduleRelationshipAdded = 1
+
+	vehicleStatusStoppedAt   = 1
+	vehicleStatusInTransitTo = 2
+
+	causeUnknown     = 1
+	causeOther       = 2
+	causeTechnical   = 3
+	causeAccident    = 6
+	causeWeather     = 8
+	causeMaintenance = 9
+	causeConstruct   = 10
+
+	effectNoService         = 1
+	effectReducedService    = 2
+	effectSignificantDelays = 3
+	effectDetour            = 4
+	effectModifiedService   = 6
+	effectOtherEffect       = 7
+	effectUnknownEffect     = 8
+	effectStopMoved         = 9
+)
+
+// FeedMessage 一份完整的 GTFS-Realtime 数据
+// JSON 编码（format=json）按 GTFS-Realtime 规范的字段名输出，Timestamp 放在 header 中
+type FeedMessage struct {
+	Timestamp uint64       `json:"timestamp"`
+	Entities  []FeedEntity `json:"entity"`
+}
+
+// FeedEntity 数据中的一个实体，三种内容只填其一
+type FeedEntity struct {
+	ID         string           `json:"id"`
+	TripUpdate *TripUpdate      `json:"trip_update,omitempty"`
+	Vehicle    *VehiclePosition `json:"vehicle,omitempty"`
+	Alert      *Alert           `json:"alert,omitempty"`
+}
+
+// TripDescriptor 班次描述
+type TripDescriptor struct {
+	TripID               string `json:"trip_id,omitempty"`
+	RouteID              string `json:"route_id,omitempty"`
+	ScheduleRelationship int    `json:"schedule_relationship"`
+}
+
+// VehicleDescriptor 车辆描述
+type VehicleDescriptor struct {
+	ID           string `json:"id,omitempty"`
+	Label        string `json:"label,omitempty"`
+	LicensePlate string `json:"license_plate,omitempty"`
+}
+
+// Position 车辆位置，Bearing 为度，Speed 为米/秒
+type Position struct {
+	Latitude  float32 `json:"latitude"`
+	Longitude float32 `json:"longitude"`
+	Bearing   float32 `json:"bearing"`
+	Speed     float32 `json:"speed"`
+}
+
+// VehiclePosition 车辆实时位置
+type VehiclePosition struct {
+	Trip          TripDescriptor    `json:"trip"`
+	Vehicle       VehicleDescriptor `json:"vehicle"`
+	Position      Position          `json:"position"`
+	CurrentStatus int               `json:"current_status"`
+	StopID        string            `json:"stop_id,omitempty"`
+	Timestamp     uint64            `json:"timestamp"`
+}
+
+// StopTimeUpdate 某个站点的预计到达时间，JSON 中 ArrivalTime 为 arrival.time
+type StopTimeUpdate struct {
+	StopID      string `json:"stop_id"`
+	ArrivalTime int64  `json:"-"`
+}
+
+// TripUpdate 班次的到站预测
+type TripUpdate struct {
+	Trip            TripDescriptor    `json:"trip"`
+	Vehicle         VehicleDescriptor `json:"vehicle"`
+	StopTimeUpdates []StopTimeUpdate  `json:"stop_time_update"`
+	Timestamp       uint64            `json:"timestamp"`
+}
+
+// EntitySelector 告警影响的对象
+type EntitySelector struct {
+	AgencyID string `json:"agency_id,omitempty"`
+	RouteID  string `json:"route_id,omitempty"`
+	StopID   string `json:"stop_id,omitempty"`
+}
+
+// Alert 服务告警，JSON 中生效时间段为 active_period，文本为带语言的 translation 列表
+type Alert struct {
+	Start, End      uint64           `json:"-"` // 生效时间段，0 表示不限
+	InformedEntity  []EntitySelector `json:"informed_entity"`
+	Cause           int              `json:"cause"`
+	Effect          int              `json:"effect"`
+	HeaderText      string           `json:"-"`
+	DescriptionText string           `json:"-"`
+	Language        string           `json:"-"`
+}
+
+// MarshalJSON 按 GTFS-Realtime 的 JSON 结构输出，版本与时间戳放在 header 中
+func (m *FeedMessage) MarshalJSON() ([]byte, error) {
+	type header struct {
+		Version        string `json:"gtfs_realtime_version"`
+		Incrementality int    `json:"incrementality"`
+		Timestamp      uint64 `json:"timestamp"`
+	}
+	entities := m.Entities
+	if entities == nil {
+		entities = []FeedEntity{}
+	}
+	return json.Marshal(struct {
+		Header   header       `json:"header"`
+		Entities []FeedEntity `json:"entity"`
+	}{header{"2.0", incrementalityFullDataset, m.Timestamp}, entities})
+}
+
+// MarshalJSON 到达时间输出为 arrival.time
+func (u StopTimeUpdate) MarshalJSON() ([]byte, error) {
+	type arrival struct {
+		Time int64 `json:"time"`
+	}
+	return json.Marshal(struct {
+		StopID  string  `json:"stop_id"`
+		Arrival arrival `json:"arrival"`
+	}{u.StopID, arrival{u.ArrivalTime}})
+}
+
+// jsonTranslatedString JSON 编码的 TranslatedString，只有一种语言
+type jsonTranslatedString struct {
+	Translation []jsonTranslation `json:"translation"`
+}
+
+type jsonTranslation struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+// MarshalJSON 生效时间段输出为 active_period，标题与描述输出为 TranslatedString
+func (a *Alert) MarshalJSON() ([]byte, error) {
+	type period struct {
+		Start uint64 `json:"start,omitempty"`
+		End   uint64 `json:"end,omitempty"`
+	}
+	type alias Alert // 去掉 MarshalJSON，沿用字段上的标签
+	out := struct {
+		ActivePeriod []period `json:"active_period,omitempty"`
+		*alias
+		HeaderText      *jsonTranslatedString `json:"header_text,omitempty"`
+		DescriptionText *jsonTranslatedString `json:"description_text,omitempty"`
+	}{alias: (*alias)(a)}
+	if a.Start != 0 || a.End != 0 {
+		out.ActivePeriod = []period{{a.Start, a.End}}
+	}
+	if a.HeaderText != "" {
+		out.HeaderText = &jsonTranslatedString{[]jsonTranslation{{a.HeaderText, a.Language}}}
+	}
+	if a.DescriptionText != "" {
+		out.DescriptionText = &jsonTranslatedString{[]jsonTranslation{{a.DescriptionText, a.Language}}}
+	}
+	return json.Marshal(out)
+}
+
+// Marshal 编码为 protobuf 二进制
+func (m *FeedMessage) Marshal() []byte {
+	var header []byte
+	header = appendString(header, 1, "2.0")
+	header = appendVarint(header, 2, incrementalityFullDataset)
+	header = appendVarint(header, 3, m.Timestamp)
+
+	var b []byte
+	b = appendMessage(b, 1, header)
+	for _, entity := range m.Entities {
+		b = appendMessage(b, 2, entity.marshal())
+	}
+	return b
+}
+
+func (e *FeedEntity) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, e.ID)
+	if e.TripUpdate != nil {
+		b = appendMessage(b, 3, e.TripUpdate.marshal())
+	}
+	if e.Vehicle != nil {
+		b = appendMessage(b, 4, e.Vehicle.marshal())
+	}
+	if e.Alert != nil {
+		b = appendMessage(b, 5, e.Alert.marshal())
+	}
+	return b
+}
+
+func (t *TripDescriptor) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, t.TripID)
+	b = appendVarint(b, 4, uint64(t.ScheduleRelationship))
+	b = appendString(b, 5, t.RouteID)
+	return b
+}
+
+func (v *VehicleDescriptor) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, v.ID)
+	b = appendString(b, 2, v.Label)
+	b = appendString(b, 3, v.LicensePlate)
+	return b
+}
+
+func (p *Position) marshal() []byte {
+	var b []byte
+	b = appendFloat(b, 1, p.Latitude)
+	b = appendFloat(b, 2, p.Longitude)
+	b = appendFloat(b, 3, p.Bearing)
+	b = appendFloat(b, 5, p.Speed)
+	return b
+}
+
+func (v *VehiclePosition) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, v.Trip.marshal())
+	b = appendMessage(b, 2, v.Position.marshal())
+	b = appendVarint(b, 4, uint64(v.CurrentStatus))
+	b = appendVarint(b, 5, v.Timestamp)
+	b = appendString(b, 7, v.StopID)
+	b = appendMessage(b, 8, v.Vehicle.marshal())
+	return b
+}
+
+func (s *StopTimeUpdate) marshal() []byte {
+	var arrival []byte
+	arrival = appendVarint(arrival, 2, uint64(s.ArrivalTime))
+
+	var b []byte
+	b = appendMessage(b, 2, arrival)
+	b = appendString(b, 4, s.StopID)
+	return b
+}
+
+func (t *TripUpdate) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, t.Trip.marshal())
+	for _, update := range t.StopTimeUpdates {
+		b = appendMessage(b, 2, update.marshal())
+	}
+	b = appendMessage(b, 3, t.Vehicle.marshal())
+	b = appendVarint(b, 4, t.Timestamp)
+	return b
+}
+
+func (e *EntitySelector) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, e.AgencyID)
+	b = appendString(b, 2, e.RouteID)
+	b = appendString(b, 5, e.StopID)
+	return b
+}
+
+func (a *Alert) marshal() []byte {
+	var b []byte
+	if a.Start != 0 || a.End != 0 {
+		var period []byte
+		period = appendVarint(period, 1, a.Start)
+		period = appendVarint(period, 2, a.End)
+		b = appendMessage(b, 1, period)
+	}
+	for _, entity := range a.InformedEntity {
+		b = appendMessage(b, 5, entity.marshal())
+	}
+	b = appendVarint(b, 6, uint64(a.Cause))
+	b = appendVarint(b, 7, uint64(a.Effect))
+	b = appendMessage(b, 10, translatedString(a.HeaderText, a.Language))
+	if a.DescriptionText != "" {
+		b = appendMessage(b, 11, translatedString(a.DescriptionText, a.Language))
+	}
+	return b
+}
+
+// translatedString 编码只有一种语言的 TranslatedString
+func translatedString(text, language string) []byte {
+	var translation []byte
+	translation = appendString(translation, 1, text)
+	translation = appendString(translation, 2, language)
+
+	var b []byte
+	return appendMessage(b, 1, translation)
+}
+
+// 以下为编码辅助函数，零值字段不写入（proto2 optional 字段缺省即可）
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFloat(b []byte, num protowire.Number, v float32) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
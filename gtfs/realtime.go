@@ -0,0 +1,190 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"login/gps"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 时间格式，与 GPS 模块中的时间一致
+const timeLayout = "2006-01-02 15:04:05"
+
+// LiveSource 提供实时车辆状态，由 gps.GPSAPI 实现
+type LiveSource interface {
+	RouteSource
+	GetAllDrivers() []*gps.Driver
+	GetETAs(siteID int) []gps.SiteETA
+	ActiveDeviations() []gps.DeviationAlert
+}
+
+// RealtimeFeed 基于 GPS 模块的实时状态提供 GTFS-Realtime 数据
+type RealtimeFeed struct {
+	source LiveSource
+	alerts *AlertStore
+}
+
+// NewRealtimeFeed 创建 GTFS-Realtime 数据源
+func NewRealtimeFeed(source LiveSource) *RealtimeFeed {
+	return &RealtimeFeed{source: source, alerts: NewAlertStore()}
+}
+
+// RegisterRoutes 注册 HTTP 路由
+func (f *RealtimeFeed) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/gtfs-rt/vehicle_positions", f.serve(f.VehiclePositions))
+	mux.HandleFunc("/gtfs-rt/trip_updates", f.serve(f.TripUpdates))
+	mux.HandleFunc("/gtfs-rt/alerts", f.serve(f.ServiceAlerts))
+	mux.HandleFunc("/admin/gtfs/alerts", f.alerts.HandleAlerts)
+	mux.HandleFunc("/admin/gtfs/alerts/delete", f.alerts.HandleDeleteAlert)
+}
+
+// serve 以 protobuf 返回数据，带 format=json 参数时返回 JSON 便于调试
+func (f *RealtimeFeed) serve(build func(now time.Time) *FeedMessage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		feed := build(time.Now())
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(feed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(feed.Marshal())
+	}
+}
+
+// liveTrip 实时班次描述，实际运营的车辆不对应静态数据中的某个班次，因此作为新增班次发布
+func liveTrip(driver *gps.Driver) TripDescriptor {
+	return TripDescriptor{
+		TripID:               "live_" + driver.ID,
+		RouteID:              strconv.Itoa(driver.RouteID),
+		ScheduleRelationship: scheduleRelationshipAdded,
+	}
+}
+
+func vehicleOf(driver *gps.Driver) VehicleDescriptor {
+	return VehicleDescriptor{ID: driver.Car_ID, Label: driver.Car_ID, LicensePlate: driver.Car_ID}
+}
+
+// reportedAt 驾驶员最近一次上报位置的时间戳，解析失败时使用当前时间
+func reportedAt(driver *gps.Driver, now time.Time) uint64 {
+	at, err := time.ParseInLocation(timeLayout, driver.LastUpdate, time.Local)
+	if err != nil {
+		return uint64(now.Unix())
+	}
+	return uint64(at.Unix())
+}
+
+// liveDrivers 参与发布的驾驶员：已分配线路、已上报过位置且未失联，按编号排序
+func (f *RealtimeFeed) liveDrivers() []*gps.Driver {
+	var drivers []*gps.Driver
+	for _, driver := range f.source.GetAllDrivers() {
+		if driver.RouteID == 0 || driver.LastUpdate == "" || driver.Status == gps.DriverStatusExpired {
+			continue
+		}
+		drivers = append(drivers, driver)
+	}
+	sort.Slice(drivers, func(i, j int) bool { return drivers[i].ID < drivers[j].ID })
+	return drivers
+}
+
+// etasByDriver 按驾驶员分组的到站预测，每组按到达时间升序
+func (f *RealtimeFeed) etasByDriver() map[string][]gps.SiteETA {
+	grouped := make(map[string][]gps.SiteETA)
+	for _, eta := range f.source.GetETAs(0) {
+		grouped[eta.DriverID] = append(grouped[eta.DriverID], eta)
+	}
+	for _, etas := range grouped {
+		sort.Slice(etas, func(i, j int) bool { return etas[i].ETASeconds < etas[j].ETASeconds })
+	}
+	return grouped
+}
+
+// VehiclePositions 生成车辆位置数据
+func (f *RealtimeFeed) VehiclePositions(now time.Time) *FeedMessage {
+	feed := &FeedMessage{Timestamp: uint64(now.Unix())}
+	etas := f.etasByDriver()
+
+	for _, driver := range f.liveDrivers() {
+		vehicle := &VehiclePosition{
+			Trip:    liveTrip(driver),
+			Vehicle: vehicleOf(driver),
+			Position: Position{
+				Latitude:  float32(driver.Location.Latitude),
+				Longitude: float32(driver.Location.Longitude),
+				Bearing:   float32(driver.Heading),
+				Speed:     float32(driver.SmoothedSpeed / 3.6),
+			},
+			Timestamp: reportedAt(driver, now),
+		}
+		if next := etas[driver.ID]; len(next) > 0 {
+			vehicle.StopID = strconv.Itoa(next[0].SiteID)
+			vehicle.CurrentStatus = vehicleStatusInTransitTo
+			if next[0].Distance <= gps.SiteRadius(next[0].SiteID) {
+				vehicle.CurrentStatus = vehicleStatusStoppedAt
+			}
+		}
+		feed.Entities = append(feed.Entities, FeedEntity{ID: "vehicle_" + driver.ID, Vehicle: vehicle})
+	}
+	return feed
+}
+
+// TripUpdates 生成到站预测数据，每辆车一个班次，包含其后续各站的预计到达时间
+func (f *RealtimeFeed) TripUpdates(now time.Time) *FeedMessage {
+	feed := &FeedMessage{Timestamp: uint64(now.Unix())}
+	etas := f.etasByDriver()
+
+	for _, driver := range f.liveDrivers() {
+		update := &TripUpdate{
+			Trip:      liveTrip(driver),
+			Vehicle:   vehicleOf(driver),
+			Timestamp: reportedAt(driver, now),
+		}
+		for _, eta := range etas[driver.ID] {
+			update.StopTimeUpdates = append(update.StopTimeUpdates, StopTimeUpdate{
+				StopID:      strconv.Itoa(eta.SiteID),
+				ArrivalTime: now.Add(time.Duration(eta.ETASeconds) * time.Second).Unix(),
+			})
+		}
+		if len(update.StopTimeUpdates) == 0 {
+			continue
+		}
+		feed.Entities = append(feed.Entities, FeedEntity{ID: "trip_" + driver.ID, TripUpdate: update})
+	}
+	return feed
+}
+
+// ServiceAlerts 生成服务告警数据：管理员发布的告警，以及车辆偏离路线时的绕行提示
+func (f *RealtimeFeed) ServiceAlerts(now time.Time) *FeedMessage {
+	feed := &FeedMessage{Timestamp: uint64(now.Unix())}
+	c := gtfsConfig()
+
+	for _, alert := range f.alerts.Active(now) {
+		feed.Entities = append(feed.Entities, FeedEntity{ID: "alert_" + strconv.Itoa(alert.ID), Alert: alert.toFeed(c.Lang)})
+	}
+
+	deviations := f.source.ActiveDeviations()
+	sort.Slice(deviations, func(i, j int) bool { return deviations[i].DriverID < deviations[j].DriverID })
+	for _, deviation := range deviations {
+		since, _ := time.ParseInLocation(timeLayout, deviation.Since, time.Local)
+		feed.Entities = append(feed.Entities, FeedEntity{
+			ID: "deviation_" + deviation.DriverID,
+			Alert: &Alert{
+				Start:          uint64(since.Unix()),
+				InformedEntity: []EntitySelector{{RouteID: strconv.Itoa(deviation.RouteID)}},
+				Cause:          causeOther,
+				Effect:         effectDetour,
+				HeaderText:     fmt.Sprintf("%d 路车辆 %s 临时绕行", deviation.RouteID, deviation.CarID),
+				Language:       c.Lang,
+			},
+		})
+	}
+	return feed
+}
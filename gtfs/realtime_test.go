@@ -0,0 +1,282 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"login/gps"
+	"login/log_service"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestMain(m *testing.M) {
+	// 测试不写 application.log
+	log_service.GPSLogger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// fakeLive 固定返回的实时车辆状态
+type fakeLive struct {
+	drivers    []*gps.Driver
+	etas       []gps.SiteETA
+	deviations []gps.DeviationAlert
+}
+
+func (f *fakeLive) RouteShapes() []gps.RouteShape          { return nil }
+func (f *fakeLive) GetAllDrivers() []*gps.Driver           { return f.drivers }
+func (f *fakeLive) GetETAs(siteID int) []gps.SiteETA       { return f.etas }
+func (f *fakeLive) ActiveDeviations() []gps.DeviationAlert { return f.deviations }
+
+// pbField protobuf 消息中的一个字段
+type pbField struct {
+	num     protowire.Number
+	varint  uint64
+	fixed32 uint32
+	bytes   []byte
+}
+
+// decodeFields 解析一层 protobuf 消息，字段按出现顺序返回
+func decodeFields(t *testing.T, b []byte) map[protowire.Number][]pbField {
+	t.Helper()
+	fields := make(map[protowire.Number][]pbField)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		f := pbField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			f.fixed32, n = protowire.ConsumeFixed32(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("field %d has unexpected wire type %d", num, typ)
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields[num] = append(fields[num], f)
+	}
+	return fields
+}
+
+// one 取出只出现一次的字段
+func one(t *testing.T, fields map[protowire.Number][]pbField, num protowire.Number) pbField {
+	t.Helper()
+	if len(fields[num]) != 1 {
+		t.Fatalf("field %d appears %d times, want once", num, len(fields[num]))
+	}
+	return fields[num][0]
+}
+
+func testLive(now time.Time) *fakeLive {
+	reported := now.Add(-5 * time.Second)
+	return &fakeLive{
+		drivers: []*gps.Driver{
+			{ID: "d2", Car_ID: "沪A2", RouteID: 1, LastUpdate: reported.Format(timeLayout), Status: gps.DriverStatusActive,
+				Location: gps.Location{Latitude: 31.2, Longitude: 121.4}, Heading: 90, SmoothedSpeed: 36},
+			{ID: "d1", Car_ID: "沪A1", RouteID: 1, LastUpdate: "not a time", Status: gps.DriverStatusStale},
+			{ID: "d3", Car_ID: "沪A3", LastUpdate: reported.Format(timeLayout)},                                              // 没有线路
+			{ID: "d4", Car_ID: "沪A4", RouteID: 1},                                                                           // 没有上报过位置
+			{ID: "d5", Car_ID: "沪A5", RouteID: 1, LastUpdate: reported.Format(timeLayout), Status: gps.DriverStatusExpired}, // 已失联
+		},
+		etas: []gps.SiteETA{
+			{SiteID: 4, DriverID: "d2", Distance: 900, ETASeconds: 90},
+			{SiteID: 3, DriverID: "d2", Distance: 10, ETASeconds: 1},
+			{SiteID: 5, DriverID: "d1", Distance: 300, ETASeconds: 30},
+		},
+	}
+}
+
+func TestVehiclePositionsProtobuf(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	feed := NewRealtimeFeed(testLive(now)).VehiclePositions(now)
+
+	message := decodeFields(t, feed.Marshal())
+	header := decodeFields(t, one(t, message, 1).bytes)
+	if v := string(one(t, header, 1).bytes); v != "2.0" {
+		t.Errorf("gtfs_realtime_version = %q", v)
+	}
+	if len(header[2]) != 0 {
+		t.Error("FULL_DATASET incrementality should be omitted as the default")
+	}
+	if ts := one(t, header, 3).varint; ts != uint64(now.Unix()) {
+		t.Errorf("header timestamp = %d, want %d", ts, now.Unix())
+	}
+
+	entities := message[2]
+	if len(entities) != 2 {
+		t.Fatalf("got %d entities, want d1 and d2", len(entities))
+	}
+	entity := decodeFields(t, entities[0].bytes)
+	if id := string(one(t, entity, 1).bytes); id != "vehicle_d1" {
+		t.Errorf("first entity id = %s, want drivers sorted by id", id)
+	}
+	entity = decodeFields(t, entities[1].bytes)
+	vehicle := decodeFields(t, one(t, entity, 4).bytes)
+
+	trip := decodeFields(t, one(t, vehicle, 1).bytes)
+	if string(one(t, trip, 1).bytes) != "live_d2" || one(t, trip, 4).varint != scheduleRelationshipAdded || string(one(t, trip, 5).bytes) != "1" {
+		t.Errorf("trip descriptor = %+v", trip)
+	}
+	position := decodeFields(t, one(t, vehicle, 2).bytes)
+	tests := []struct {
+		num  protowire.Number
+		want float32
+	}{
+		{1, 31.2}, {2, 121.4}, {3, 90}, {5, 10}, // 车速换算为米/秒
+	}
+	for _, tt := range tests {
+		if got := math.Float32frombits(one(t, position, tt.num).fixed32); got != tt.want {
+			t.Errorf("position field %d = %v, want %v", tt.num, got, tt.want)
+		}
+	}
+	if status := one(t, vehicle, 4).varint; status != vehicleStatusStoppedAt {
+		t.Errorf("current_status = %d, want STOPPED_AT within the stop radius", status)
+	}
+	if ts := one(t, vehicle, 5).varint; ts != uint64(now.Unix()-5) {
+		t.Errorf("vehicle timestamp = %d, want the last report", ts)
+	}
+	if stop := string(one(t, vehicle, 7).bytes); stop != "3" {
+		t.Errorf("stop_id = %s, want the nearest upcoming stop", stop)
+	}
+	descriptor := decodeFields(t, one(t, vehicle, 8).bytes)
+	if string(one(t, descriptor, 1).bytes) != "沪A2" || string(one(t, descriptor, 3).bytes) != "沪A2" {
+		t.Errorf("vehicle descriptor = %+v", descriptor)
+	}
+
+	// 解析失败的上报时间使用当前时间，驶向下一站
+	first := decodeFields(t, one(t, decodeFields(t, entities[0].bytes), 4).bytes)
+	if one(t, first, 5).varint != uint64(now.Unix()) || one(t, first, 4).varint != vehicleStatusInTransitTo {
+		t.Errorf("d1 vehicle = %+v", first)
+	}
+}
+
+func TestTripUpdates(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	live := testLive(now)
+	live.etas = live.etas[:2] // d1 没有到站预测，不发布班次
+	feed := NewRealtimeFeed(live).TripUpdates(now)
+
+	if len(feed.Entities) != 1 || feed.Entities[0].ID != "trip_d2" {
+		t.Fatalf("entities = %+v, want only trip_d2", feed.Entities)
+	}
+	entity := decodeFields(t, decodeFields(t, feed.Marshal())[2][0].bytes)
+	update := decodeFields(t, one(t, entity, 3).bytes)
+	stops := update[2]
+	if len(stops) != 2 {
+		t.Fatalf("got %d stop time updates, want 2", len(stops))
+	}
+	for i, want := range []struct {
+		stopID  string
+		arrival int64
+	}{{"3", now.Unix() + 1}, {"4", now.Unix() + 90}} {
+		stop := decodeFields(t, stops[i].bytes)
+		arrival := decodeFields(t, one(t, stop, 2).bytes)
+		if string(one(t, stop, 4).bytes) != want.stopID || int64(one(t, arrival, 2).varint) != want.arrival {
+			t.Errorf("stop time update %d = stop %s at %d, want %s at %d",
+				i, one(t, stop, 4).bytes, one(t, arrival, 2).varint, want.stopID, want.arrival)
+		}
+	}
+
+	data, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Header struct {
+			Version string `json:"gtfs_realtime_version"`
+		} `json:"header"`
+		Entity []struct {
+			TripUpdate struct {
+				StopTimeUpdate []struct {
+					StopID  string `json:"stop_id"`
+					Arrival struct {
+						Time int64 `json:"time"`
+					} `json:"arrival"`
+				} `json:"stop_time_update"`
+			} `json:"trip_update"`
+		} `json:"entity"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Header.Version != "2.0" || len(decoded.Entity) != 1 || decoded.Entity[0].TripUpdate.StopTimeUpdate[1].Arrival.Time != now.Unix()+90 {
+		t.Errorf("json feed = %s", data)
+	}
+}
+
+func TestServiceAlerts(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	live := testLive(now)
+	live.deviations = []gps.DeviationAlert{{DriverID: "d2", CarID: "沪A2", RouteID: 1, Since: now.Add(-time.Minute).Format(timeLayout)}}
+	feed := NewRealtimeFeed(live)
+
+	if _, err := feed.alerts.Add(ServiceAlert{Header: "过期", End: now.Add(-time.Hour).Format(timeLayout)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := feed.alerts.Add(ServiceAlert{Header: "东门封闭", Description: "改停西门", StopID: 3, Cause: "construction", Effect: "stop_moved"}); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := feed.ServiceAlerts(now)
+	if len(alerts.Entities) != 2 || alerts.Entities[0].ID != "alert_2" || alerts.Entities[1].ID != "deviation_d2" {
+		t.Fatalf("entities = %+v, want alert_2 and deviation_d2", alerts.Entities)
+	}
+
+	entities := decodeFields(t, alerts.Marshal())[2]
+	manual := decodeFields(t, one(t, decodeFields(t, entities[0].bytes), 5).bytes)
+	if len(manual[1]) != 0 {
+		t.Error("alert without start or end has an active_period")
+	}
+	informed := decodeFields(t, one(t, manual, 5).bytes)
+	if len(informed[1]) != 0 || string(one(t, informed, 5).bytes) != "3" {
+		t.Errorf("informed entity = %+v, want only stop 3", informed)
+	}
+	if one(t, manual, 6).varint != causeConstruct || one(t, manual, 7).varint != effectStopMoved {
+		t.Errorf("cause/effect = %d/%d", one(t, manual, 6).varint, one(t, manual, 7).varint)
+	}
+	translation := decodeFields(t, one(t, decodeFields(t, one(t, manual, 11).bytes), 1).bytes)
+	if string(one(t, translation, 1).bytes) != "改停西门" {
+		t.Errorf("description translation = %+v", translation)
+	}
+
+	detour := decodeFields(t, one(t, decodeFields(t, entities[1].bytes), 5).bytes)
+	period := decodeFields(t, one(t, detour, 1).bytes)
+	if one(t, period, 1).varint != uint64(now.Unix()-60) || len(period[2]) != 0 {
+		t.Errorf("detour active_period = %+v, want open-ended from the deviation start", period)
+	}
+	if one(t, detour, 7).varint != effectDetour || len(detour[11]) != 0 {
+		t.Errorf("detour alert = %+v", detour)
+	}
+}
+
+func TestServiceAlertValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		alert   ServiceAlert
+		wantErr bool
+	}{
+		{"minimal", ServiceAlert{Header: "停运"}, false},
+		{"full", ServiceAlert{Header: "停运", Cause: "weather", Effect: "no_service", Start: "2024-05-01 08:00:00", End: "2024-05-01 18:00:00"}, false},
+		{"missing header", ServiceAlert{Description: "停运"}, true},
+		{"unknown cause", ServiceAlert{Header: "停运", Cause: "aliens"}, true},
+		{"unknown effect", ServiceAlert{Header: "停运", Effect: "teleport"}, true},
+		{"bad time", ServiceAlert{Header: "停运", Start: "tomorrow"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.alert.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
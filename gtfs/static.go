@@ -0,0 +1,287 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"login/config"
+	"login/db"
+	"login/gps"
+	"login/log_service"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GTFS 中的固定编号
+const (
+	agencyID  = "campus_bus"
+	serviceID = "campus_service"
+	routeType = "3" // 公交车
+)
+
+// GTFS 的星期列，顺序与 calendar.txt 一致
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// table 一个 GTFS 文件的表头和数据行
+type table struct {
+	name   string
+	header []string
+	rows   [][]string
+}
+
+// WriteStatic 生成 GTFS 静态数据压缩包，包含 agency、stops、routes、shapes、trips、stop_times 与 calendar
+func (e *Exporter) WriteStatic(w io.Writer, now time.Time) error {
+	c := gtfsConfig()
+	routes := exportableRoutes(e.source.RouteShapes())
+	if len(routes) == 0 {
+		return errors.New("no route with at least two stops to export")
+	}
+
+	calendar, err := buildCalendar(c, now)
+	if err != nil {
+		return err
+	}
+	trips, stopTimes, err := buildTrips(c, routes)
+	if err != nil {
+		return err
+	}
+
+	tables := []table{
+		buildAgency(c),
+		buildStops(routes),
+		buildRoutes(routes),
+		buildShapes(routes),
+		trips,
+		stopTimes,
+		calendar,
+	}
+
+	zw := zip.NewWriter(w)
+	for _, t := range tables {
+		if err := writeTable(zw, t); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	log_service.GPSLogger.Printf("已生成 GTFS 静态数据：%d 条线路，%d 个班次\n", len(routes), len(trips.rows))
+	return nil
+}
+
+// writeTable 将一个 GTFS 文件写入压缩包
+func writeTable(zw *zip.Writer, t table) error {
+	f, err := zw.Create(t.name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(t.header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.rows); err != nil {
+		return fmt.Errorf("write %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// exportableRoutes 筛选出 route_table 中仍在使用、且至少有两个站点的路线
+// route_table 读取失败时只按站点数筛选
+func exportableRoutes(shapes []gps.RouteShape) []gps.RouteShape {
+	inUse := make(map[int]bool)
+	result, err := db.ExecuteSQL(config.RoleDriver, "SELECT route_id, route_isusing FROM route_table")
+	if err != nil {
+		log_service.GPSLogger.Printf("读取 route_table 失败，导出全部路线：%v\n", err)
+	} else {
+		rows := result.(*sql.Rows)
+		defer rows.Close()
+		for rows.Next() {
+			var id, isUsing int
+			if err := rows.Scan(&id, &isUsing); err == nil {
+				inUse[id] = isUsing != 0
+			}
+		}
+	}
+
+	var routes []gps.RouteShape
+	for _, shape := range shapes {
+		if using, exists := inUse[shape.ID]; exists && !using {
+			continue
+		}
+		if len(shape.Stops) < 2 {
+			continue
+		}
+		routes = append(routes, shape)
+	}
+	return routes
+}
+
+func buildAgency(c config.GTFSConfig) table {
+	return table{
+		name:   "agency.txt",
+		header: []string{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang"},
+		rows:   [][]string{{agencyID, c.AgencyName, c.AgencyURL, c.Timezone, c.Lang}},
+	}
+}
+
+// buildStops 导出路线上用到的站点，同一站点只导出一次
+func buildStops(routes []gps.RouteShape) table {
+	t := table{name: "stops.txt", header: []string{"stop_id", "stop_name", "stop_lat", "stop_lon"}}
+	seen := make(map[int]bool)
+	for _, route := range routes {
+		for _, stop := range route.Stops {
+			if seen[stop.SiteID] {
+				continue
+			}
+			seen[stop.SiteID] = true
+			t.rows = append(t.rows, []string{
+				strconv.Itoa(stop.SiteID), stop.SiteName,
+				formatCoord(stop.Location.Latitude), formatCoord(stop.Location.Longitude),
+			})
+		}
+	}
+	return t
+}
+
+func buildRoutes(routes []gps.RouteShape) table {
+	t := table{name: "routes.txt", header: []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}}
+	for _, route := range routes {
+		first, last := route.Stops[0], route.Stops[len(route.Stops)-1]
+		longName := first.SiteName + " - " + last.SiteName
+		if route.Closed {
+			longName = first.SiteName + " 环线"
+		}
+		t.rows = append(t.rows, []string{strconv.Itoa(route.ID), agencyID, strconv.Itoa(route.ID), longName, routeType})
+	}
+	return t
+}
+
+func buildShapes(routes []gps.RouteShape) table {
+	t := table{name: "shapes.txt", header: []string{"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"}}
+	for _, route := range routes {
+		for i, point := range route.Path {
+			t.rows = append(t.rows, []string{
+				shapeID(route.ID), formatCoord(point.Latitude), formatCoord(point.Longitude),
+				strconv.Itoa(i + 1), strconv.FormatFloat(math.Round(route.Dist[i]*10)/10, 'f', -1, 64),
+			})
+		}
+	}
+	return t
+}
+
+// buildTrips 按运营时间与发车间隔生成每条路线的班次，站间时间由沿线距离与车速推算
+// 环线在最后回到首站
+func buildTrips(c config.GTFSConfig, routes []gps.RouteShape) (table, table, error) {
+	trips := table{name: "trips.txt", header: []string{"route_id", "service_id", "trip_id", "shape_id"}}
+	stopTimes := table{name: "stop_times.txt", header: []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}}
+
+	start, err := parseClock(c.ServiceStart)
+	if err != nil {
+		return trips, stopTimes, fmt.Errorf("invalid service_start: %w", err)
+	}
+	end, err := parseClock(c.ServiceEnd)
+	if err != nil {
+		return trips, stopTimes, fmt.Errorf("invalid service_end: %w", err)
+	}
+	if end < start {
+		return trips, stopTimes, errors.New("service_end must not be earlier than service_start")
+	}
+	speed := c.SpeedKmh / 3.6
+	headway := c.HeadwayMinutes * 60
+
+	for _, route := range routes {
+		stops := append([]gps.RouteStop(nil), route.Stops...)
+		alongs := make([]float64, len(stops))
+		for i, stop := range stops {
+			alongs[i] = stop.Along
+		}
+		if route.Closed {
+			stops = append(stops, stops[0])
+			alongs = append(alongs, stops[0].Along+route.Length)
+		}
+
+		for departure, n := start, 1; departure <= end; departure, n = departure+headway, n+1 {
+			tripID := fmt.Sprintf("%d_%d", route.ID, n)
+			trips.rows = append(trips.rows, []string{strconv.Itoa(route.ID), serviceID, tripID, shapeID(route.ID)})
+
+			for i, stop := range stops {
+				// 首站准点发车，中途站点各停靠 dwell_seconds
+				arrival := departure + int(math.Round((alongs[i]-alongs[0])/speed))
+				if i > 1 {
+					arrival += (i - 1) * c.DwellSeconds
+				}
+				leave := arrival
+				if i > 0 && i < len(stops)-1 {
+					leave += c.DwellSeconds
+				}
+				stopTimes.rows = append(stopTimes.rows, []string{
+					tripID, formatClock(arrival), formatClock(leave), strconv.Itoa(stop.SiteID), strconv.Itoa(i + 1),
+				})
+			}
+		}
+	}
+	return trips, stopTimes, nil
+}
+
+// buildCalendar 生成运营日历，service_days 为空时每天运营
+func buildCalendar(c config.GTFSConfig, now time.Time) (table, error) {
+	t := table{name: "calendar.txt", header: append(append([]string{"service_id"}, weekdays...), "start_date", "end_date")}
+
+	startDate := c.StartDate
+	if startDate == "" {
+		startDate = now.Format("20060102")
+	}
+	startAt, err := time.Parse("20060102", startDate)
+	if err != nil {
+		return t, fmt.Errorf("invalid start_date: %w", err)
+	}
+	endDate := c.EndDate
+	if endDate == "" {
+		endDate = startAt.AddDate(1, 0, 0).Format("20060102")
+	}
+	if _, err := time.Parse("20060102", endDate); err != nil {
+		return t, fmt.Errorf("invalid end_date: %w", err)
+	}
+
+	days := make(map[string]bool)
+	for _, day := range c.ServiceDays {
+		days[strings.ToLower(day)] = true
+	}
+	row := []string{serviceID}
+	for _, day := range weekdays {
+		if len(days) == 0 || days[day] {
+			row = append(row, "1")
+		} else {
+			row = append(row, "0")
+		}
+	}
+	t.rows = [][]string{append(row, startDate, endDate)}
+	return t, nil
+}
+
+func shapeID(routeID int) string {
+	return "shape_" + strconv.Itoa(routeID)
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+// parseClock 将 HH:MM:SS 解析为当天的秒数
+func parseClock(s string) (int, error) {
+	var h, m, sec int
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec); err != nil {
+		return 0, err
+	}
+	return h*3600 + m*60 + sec, nil
+}
+
+// formatClock 将秒数格式化为 HH:MM:SS，GTFS 允许超过 24 点表示次日凌晨
+func formatClock(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
@@ -0,0 +1,134 @@
+package gtfs
+
+import (
+	"login/config"
+	"login/gps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testShape(id int, closed bool) gps.RouteShape {
+	return gps.RouteShape{
+		ID:     id,
+		Length: 4000,
+		Closed: closed,
+		Stops: []gps.RouteStop{
+			{SiteID: 1, SiteName: "东门", Location: gps.Location{Latitude: 31.2, Longitude: 121.4}, Along: 0},
+			{SiteID: 2, SiteName: "图书馆", Location: gps.Location{Latitude: 31.21, Longitude: 121.4}, Along: 1500},
+			{SiteID: 3, SiteName: "西门", Location: gps.Location{Latitude: 31.22, Longitude: 121.4}, Along: 3000},
+		},
+	}
+}
+
+func TestBuildTrips(t *testing.T) {
+	// 车速 5 米/秒，每站停靠 30 秒
+	c := config.GTFSConfig{ServiceStart: "07:00:00", ServiceEnd: "07:20:00", HeadwayMinutes: 10, SpeedKmh: 18, DwellSeconds: 30}
+	trips, stopTimes, err := buildTrips(c, []gps.RouteShape{testShape(1, false), testShape(2, true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trips.rows) != 6 {
+		t.Fatalf("got %d trips, want 3 per route", len(trips.rows))
+	}
+	if want := []string{"2", serviceID, "2_3", "shape_2"}; !reflect.DeepEqual(trips.rows[5], want) {
+		t.Errorf("last trip = %v, want %v", trips.rows[5], want)
+	}
+
+	wantFirstTrip := [][]string{
+		{"1_1", "07:00:00", "07:00:00", "1", "1"},
+		{"1_1", "07:05:00", "07:05:30", "2", "2"},
+		{"1_1", "07:10:30", "07:10:30", "3", "3"},
+	}
+	if !reflect.DeepEqual(stopTimes.rows[:3], wantFirstTrip) {
+		t.Errorf("first trip stop times = %v, want %v", stopTimes.rows[:3], wantFirstTrip)
+	}
+	// 环线最后回到首站：4000 米 800 秒，途经两站各停 30 秒
+	loop := stopTimes.rows[9:13]
+	if len(loop) != 4 || loop[3][0] != "2_1" || loop[3][1] != "07:14:20" || loop[3][3] != "1" || loop[3][4] != "4" {
+		t.Errorf("loop trip stop times = %v", loop)
+	}
+}
+
+func TestBuildTripsServiceHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+	}{
+		{"bad start", "7am", "21:00:00"},
+		{"bad end", "07:00:00", ""},
+		{"end before start", "21:00:00", "07:00:00"},
+	}
+	for _, tt := range tests {
+		c := config.GTFSConfig{ServiceStart: tt.start, ServiceEnd: tt.end, HeadwayMinutes: 10, SpeedKmh: 18}
+		if _, _, err := buildTrips(c, []gps.RouteShape{testShape(1, false)}); err == nil {
+			t.Errorf("%s: service hours %q ~ %q accepted", tt.name, tt.start, tt.end)
+		}
+	}
+}
+
+func TestBuildCalendar(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		c       config.GTFSConfig
+		want    []string
+		wantErr bool
+	}{
+		{name: "every day from today", c: config.GTFSConfig{},
+			want: []string{serviceID, "1", "1", "1", "1", "1", "1", "1", "20240501", "20250501"}},
+		{name: "weekdays only", c: config.GTFSConfig{StartDate: "20240902", EndDate: "20250115",
+			ServiceDays: []string{"Monday", "tuesday", "wednesday", "thursday", "friday"}},
+			want: []string{serviceID, "1", "1", "1", "1", "1", "0", "0", "20240902", "20250115"}},
+		{name: "bad start date", c: config.GTFSConfig{StartDate: "2024-09-02"}, wantErr: true},
+		{name: "bad end date", c: config.GTFSConfig{EndDate: "tomorrow"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		calendar, err := buildCalendar(tt.c, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: accepted %+v", tt.name, tt.c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if len(calendar.rows) != 1 || !reflect.DeepEqual(calendar.rows[0], tt.want) {
+			t.Errorf("%s: calendar = %v, want %v", tt.name, calendar.rows, tt.want)
+		}
+	}
+}
+
+func TestBuildStopsAndRoutes(t *testing.T) {
+	routes := []gps.RouteShape{testShape(1, false), testShape(2, true)}
+
+	stops := buildStops(routes)
+	if len(stops.rows) != 3 {
+		t.Fatalf("stops = %v, want each site exported once", stops.rows)
+	}
+	if want := []string{"2", "图书馆", "31.210000", "121.400000"}; !reflect.DeepEqual(stops.rows[1], want) {
+		t.Errorf("stop row = %v, want %v", stops.rows[1], want)
+	}
+
+	rows := buildRoutes(routes).rows
+	if rows[0][3] != "东门 - 西门" || rows[1][3] != "东门 环线" || rows[1][4] != routeType {
+		t.Errorf("routes = %v", rows)
+	}
+}
+
+func TestClock(t *testing.T) {
+	seconds, err := parseClock("07:30:15")
+	if err != nil || seconds != 7*3600+30*60+15 {
+		t.Errorf("parseClock = %d, %v", seconds, err)
+	}
+	if _, err := parseClock("half past seven"); err == nil {
+		t.Error("invalid clock accepted")
+	}
+	// GTFS 允许超过 24 点表示次日凌晨
+	if got := formatClock(25*3600 + 5*60 + 9); got != "25:05:09" {
+		t.Errorf("formatClock = %s, want 25:05:09", got)
+	}
+}
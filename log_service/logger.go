@@ -5,10 +5,11 @@ import (
 	"os"
 )
 
-// 定义两个日志实例
+// 定义各模块的日志实例
 var (
 	WebSocketLogger *log.Logger
 	GPSLogger       *log.Logger
+	GeodataLogger   *log.Logger
 )
 
 // 初始化日志
@@ -25,5 +26,8 @@ func InitLoggers() error {
 	// 为 GPS 模块创建日志实例（与 WebSocket 共享同一个日志文件）
 	GPSLogger = log.New(logFile, "GPS: ", log.Ldate|log.Ltime|log.Lshortfile)
 
+	// 为线路与站点导入导出模块创建日志实例
+	GeodataLogger = log.New(logFile, "GEODATA: ", log.Ldate|log.Ltime|log.Lshortfile)
+
 	return nil
 }
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"login/api"
 	"login/auth"
 	"login/config"
 	"login/db"
 	"login/driverShift"
+	"login/geodata"
 	"login/gps"
+	"login/gtfs"
 	"login/log_service"
+	"login/simulator"
 
 	"login/user"
 	"login/websocket"
 	"net/http"
 	"os"
+	"os/signal"
+	"time"
 )
 
 // 创造数据库连接实例
@@ -43,6 +49,70 @@ func initDatasetCon() error {
 	return nil
 }
 
+// 命令行参数
+var (
+	exportGTFS   = flag.String("export-gtfs", "", "生成 GTFS 静态数据压缩包并写入指定路径，完成后退出")
+	exportSchema = flag.String("export-ws-schema", "", "将 WebSocket 协议文档（protocol.json 与 protocol.markdown）写入指定目录，完成后退出")
+	simulateN    = flag.Int("simulate", 0, "启动指定数量的模拟驾驶员（开发与演示用），为 0 时使用配置文件中的 simulator.drivers")
+	simulateSeed = flag.Int64("sim-seed", 0, "模拟器随机种子，为 0 时使用配置文件中的 simulator.seed")
+)
+
+// runGTFSExport 命令行模式：导出 GTFS 静态数据后退出，不启动服务
+func runGTFSExport(path string) int {
+	log_service.InitLoggers()
+	gps_api := gps.InitGPSAPI(websocket.NewWebSocketAPI())
+	err := gtfs.NewExporter(gps_api).ExportStaticFile(path)
+	if err != nil {
+		fmt.Println("GTFS 数据导出失败，错误信息为：", err)
+		return 1
+	}
+	fmt.Println("GTFS 数据已导出到", path)
+	return 0
+}
+
+// runSchemaExport 命令行模式：导出 WebSocket 协议文档后退出，不需要数据库
+func runSchemaExport(dir string) int {
+	if err := websocket.NewWebSocketAPI().ExportProtocol(dir); err != nil {
+		fmt.Println("WebSocket 协议文档导出失败，错误信息为：", err)
+		return 1
+	}
+	fmt.Println("WebSocket 协议文档已导出到", dir)
+	return 0
+}
+
+// startSimulator 按命令行参数或配置启动车队模拟器，进程收到中断信号时为模拟驾驶员下班
+func startSimulator(gps_api *gps.GPSAPI, webSocketAPI *websocket.WebSocketAPI) {
+	n := *simulateN
+	if n == 0 {
+		n = config.AppConfig.Simulator.Drivers
+	}
+	if n <= 0 {
+		return
+	}
+	seed := *simulateSeed
+	if seed == 0 {
+		seed = config.AppConfig.Simulator.Seed
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	sim := simulator.NewSimulator(gps_api, webSocketAPI, seed)
+	if err := sim.Start(n); err != nil {
+		fmt.Println("模拟器启动失败，错误信息为：", err)
+		return
+	}
+	fmt.Printf("模拟器已启动：%d 个驾驶员，随机种子 %d\n", n, seed)
+
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		sim.Stop()
+		os.Exit(0)
+	}()
+}
+
 // CORS 中间件
 func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +172,8 @@ func RegisterAdmin(mux *http.ServeMux) {
 	mux.HandleFunc("/admin/drivertable", api.GetDriversTableData)
 	mux.HandleFunc("/admin/car_table", api.GetCarsTableData)
 	mux.HandleFunc("/admin/work_table", api.GetWorkTableData)
+	mux.HandleFunc("/admin/work_table/mileage", api.GetMileageStats)
+	mux.HandleFunc("/admin/incident_table", api.GetIncidentTableData)
 
 	// 驾驶员支持
 	mux.HandleFunc("/admin/driver/get", api.GiveDriverInfo)
@@ -118,6 +190,7 @@ func RegisterAdmin(mux *http.ServeMux) {
 }
 
 func main() {
+	flag.Parse()
 
 	// 初始化全局参数 ======
 	err := config.LoadConfig("config.yaml")
@@ -126,15 +199,26 @@ func main() {
 		print(err.Error())
 	}
 
+	// 命令行导出协议文档模式 ======
+	if *exportSchema != "" {
+		os.Exit(runSchemaExport(*exportSchema))
+	}
+
 	// 启动日志服务 ======
 	log_service.InitLogService()
 
 	// 设置数据库连接 =====
 	err = initDatasetCon()
+	dbReady := err == nil
 	if err != nil {
 		print(err.Error())
 	}
 
+	// 命令行导出模式 ======
+	if *exportGTFS != "" {
+		os.Exit(runGTFSExport(*exportGTFS))
+	}
+
 	// 启动令牌服务 ======
 	err = auth.InitTokenService()
 	if err != nil {
@@ -157,8 +241,22 @@ func main() {
 	gps_api := gps.InitGPSAPI(webSocketAPI)
 	// 将 GPSModule 绑定到 WebSocketManager
 	webSocketAPI.SetUpdater(gps_api)
+	webSocketAPI.SetSnapshotProvider(gps_api)
+	webSocketAPI.SetReplayer(gps_api)
+	webSocketAPI.SetPassengerCounter(gps_api)
+	webSocketAPI.AddDisconnectListener(gps_api)
+	// 投诉通过 WebSocket 推送给驾驶员，驾驶员未连接时离线保存
+	api.DriverMessenger = webSocketAPI
 	// webSocketAPI.manager.Updater = gps_api
 	webSocketAPI.Start()
+	// 服务重启后从未结束的班次恢复在班驾驶员，驾驶员无需重新上班
+	if dbReady {
+		if restored, err := gps_api.RestoreDrivers(); err != nil {
+			log_service.GPSLogger.Printf("恢复在班驾驶员失败：%v\n", err)
+		} else {
+			log_service.GPSLogger.Printf("已恢复 %d 名在班驾驶员\n", restored)
+		}
+	}
 	//用于处理驾驶员上下班
 	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
 		driverShift.HandleShiftStart(w, r, gps_api)
@@ -166,6 +264,9 @@ func main() {
 	mux.HandleFunc("/end", func(w http.ResponseWriter, r *http.Request) {
 		driverShift.HandleShiftEnd(w, r, gps_api)
 	})
+	mux.HandleFunc("/getShiftTrack", func(w http.ResponseWriter, r *http.Request) {
+		driverShift.GetShiftTrack(w, r, gps_api)
+	})
 	mux.HandleFunc("/modifyDriverInfo", driverShift.HandleShiftInfo)
 
 	mux.HandleFunc("/getDriverData", driverShift.GetDriverData)
@@ -175,6 +276,13 @@ func main() {
 	// 注册 GPSAPI 提供的 HTTP 接口到路由器中。
 	gps_api.RegisterRoutes(mux)
 	gps_api.StartBroadcast()
+	// GTFS 数据导出
+	gtfs.NewExporter(gps_api).RegisterRoutes(mux)
+	gtfs.NewRealtimeFeed(gps_api).RegisterRoutes(mux)
+	// 线路与站点的 GeoJSON / KML / GPX 导入导出
+	geodata.RegisterRoutes(mux)
+	// 开发与演示用的车队模拟器
+	startSimulator(gps_api, webSocketAPI)
 	// - 驾驶员
 
 	//乘客信息处理
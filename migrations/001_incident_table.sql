@@ -0,0 +1,14 @@
+-- 偏离线路、超速等行车事件（gps 模块写入，/admin/incident_table 查询）
+CREATE TABLE IF NOT EXISTS incident_table (
+	incident_id    INT AUTO_INCREMENT PRIMARY KEY,
+	incident_type  VARCHAR(32)  NOT NULL,
+	driver_id      VARCHAR(32)  NOT NULL,
+	car_id         VARCHAR(32)  NOT NULL DEFAULT '',
+	route_id       INT          NOT NULL DEFAULT 0,
+	latitude       DOUBLE       NOT NULL DEFAULT 0,
+	longitude      DOUBLE       NOT NULL DEFAULT 0,
+	incident_value DOUBLE       NOT NULL DEFAULT 0,
+	incident_stime DATETIME     NOT NULL,
+	incident_etime DATETIME     NULL,
+	incident_note  VARCHAR(255) NOT NULL DEFAULT ''
+);
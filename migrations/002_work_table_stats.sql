@@ -0,0 +1,6 @@
+-- work_table 中的班次里程与时间统计列（下班时由 driverShift 模块写入）
+-- MySQL 不支持 ADD COLUMN IF NOT EXISTS，本文件不能重复执行；列已存在时会报 Duplicate column name，可忽略
+ALTER TABLE work_table
+	ADD COLUMN work_mileage     DOUBLE NOT NULL DEFAULT 0, -- 行驶里程（公里）
+	ADD COLUMN work_moving_time INT    NOT NULL DEFAULT 0, -- 行驶时间（秒）
+	ADD COLUMN work_idle_time   INT    NOT NULL DEFAULT 0; -- 怠速时间（秒）
@@ -0,0 +1,14 @@
+-- 上下车事件及事件后的载客量（gps 模块写入，站点客流统计查询）
+CREATE TABLE IF NOT EXISTS occupancy_table (
+	occupancy_id   INT AUTO_INCREMENT PRIMARY KEY,
+	car_id         VARCHAR(32) NOT NULL,
+	driver_id      VARCHAR(32) NOT NULL DEFAULT '',
+	route_id       INT         NOT NULL DEFAULT 0,
+	site_id        INT         NOT NULL DEFAULT 0,
+	boarding       INT         NOT NULL DEFAULT 0,
+	alighting      INT         NOT NULL DEFAULT 0,
+	occupancy      INT         NOT NULL DEFAULT 0,
+	capacity       INT         NOT NULL DEFAULT 0,
+	occupancy_time DATETIME    NOT NULL,
+	INDEX idx_route_time (route_id, occupancy_time)
+);
@@ -0,0 +1,16 @@
+-- 驾驶员状态快照（gps 模块定期写入，服务重启时恢复当班驾驶员）
+CREATE TABLE IF NOT EXISTS driver_state_table (
+	driver_id      VARCHAR(32) PRIMARY KEY,
+	car_id         VARCHAR(32) NOT NULL DEFAULT '',
+	route_id       INT         NOT NULL DEFAULT 0,
+	shift_start    VARCHAR(19) NOT NULL DEFAULT '',
+	latitude       DOUBLE      NOT NULL DEFAULT 0,
+	longitude      DOUBLE      NOT NULL DEFAULT 0,
+	heading        DOUBLE      NOT NULL DEFAULT 0,
+	occupancy      INT         NOT NULL DEFAULT 0,
+	last_update    VARCHAR(19) NOT NULL DEFAULT '',
+	distance_km    DOUBLE      NOT NULL DEFAULT 0,
+	moving_seconds INT         NOT NULL DEFAULT 0,
+	idle_seconds   INT         NOT NULL DEFAULT 0,
+	saved_at       DATETIME    NOT NULL
+);
@@ -0,0 +1,10 @@
+-- 发给未连接的驾驶员或车辆的离线消息（websocket 模块写入，重新绑定时补发）
+CREATE TABLE IF NOT EXISTS offline_message_table (
+	message_id   BIGINT AUTO_INCREMENT PRIMARY KEY,
+	recipient_id VARCHAR(64) NOT NULL,
+	message      MEDIUMTEXT  NOT NULL,
+	created_at   DATETIME    NOT NULL,
+	expires_at   DATETIME    NOT NULL,
+	INDEX idx_recipient (recipient_id, message_id),
+	INDEX idx_expires (expires_at)
+);
@@ -0,0 +1,303 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login/config"
+	"login/driverShift"
+	"login/gps"
+	"login/log_service"
+	"login/websocket"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// 每米对应的纬度（度）
+const metersPerDegree = 111320.0
+
+// bus 一辆模拟车辆
+type bus struct {
+	driverID   string
+	carID      string
+	route      gps.RouteShape
+	along      float64 // 当前沿线距离（米）
+	direction  float64 // 非环线到达终点后掉头，1 为正向，-1 为反向
+	speed      float64 // 车速（米/秒）
+	dwellLeft  float64 // 剩余停靠时间（秒）
+	passengers int
+}
+
+// Simulator 在路线上模拟驾驶员：通过上班接口创建驾驶员，按车速沿路线行驶、在站点停靠，
+// 并上报位置以及上下车消息
+// 所有随机数都来自同一个种子，且按上报次数而不是实际时间推进，相同配置与种子的运行结果一致
+type Simulator struct {
+	gpsAPI *gps.GPSAPI
+	wsAPI  *websocket.WebSocketAPI
+	cfg    config.SimulatorConfig
+	rng    *rand.Rand
+	buses  []*bus
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// simulatorConfig 返回填充了默认值的模拟器配置
+func simulatorConfig() config.SimulatorConfig {
+	c := config.AppConfig.Simulator
+	if c.SpeedKmh <= 0 {
+		c.SpeedKmh = 18
+	}
+	if c.SpeedJitter < 0 || c.SpeedJitter >= 1 {
+		c.SpeedJitter = 0.2
+	}
+	if c.DwellSeconds < 0 {
+		c.DwellSeconds = 0
+	} else if c.DwellSeconds == 0 {
+		c.DwellSeconds = 20
+	}
+	if c.TickSeconds <= 0 {
+		c.TickSeconds = 2
+	}
+	if c.NoiseMeters < 0 {
+		c.NoiseMeters = 0
+	}
+	if c.MaxBoarding <= 0 {
+		c.MaxBoarding = 5
+	}
+	return c
+}
+
+// NewSimulator 创建模拟器，seed 为随机种子
+func NewSimulator(gpsAPI *gps.GPSAPI, wsAPI *websocket.WebSocketAPI, seed int64) *Simulator {
+	return &Simulator{
+		gpsAPI: gpsAPI,
+		wsAPI:  wsAPI,
+		cfg:    simulatorConfig(),
+		rng:    rand.New(rand.NewSource(seed)),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start 为 n 个驾驶员上班并开始模拟，驾驶员依次分配到各条线路
+func (s *Simulator) Start(n int) error {
+	if n <= 0 {
+		return errors.New("number of simulated drivers must be positive")
+	}
+	routes := s.routes()
+	if len(routes) == 0 {
+		return errors.New("no route available for simulation")
+	}
+
+	for i := 0; i < n; i++ {
+		route := routes[i%len(routes)]
+		b := &bus{
+			driverID:  fmt.Sprintf("sim-%d", i+1),
+			carID:     fmt.Sprintf("SIM-%03d", i+1),
+			route:     route,
+			along:     s.rng.Float64() * route.Length,
+			direction: 1,
+			speed:     s.cfg.SpeedKmh / 3.6 * (1 + s.cfg.SpeedJitter*(2*s.rng.Float64()-1)),
+		}
+		if err := s.shift(driverShift.HandleShiftStart, b, "正常运营"); err != nil {
+			s.Stop()
+			return fmt.Errorf("start shift for %s: %w", b.driverID, err)
+		}
+		s.buses = append(s.buses, b)
+		log_service.GPSLogger.Printf("模拟驾驶员 %s（车牌 %s）在线路 %d 上班，车速 %.1f km/h\n", b.driverID, b.carID, route.ID, b.speed*3.6)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Stop 停止模拟，并为所有模拟驾驶员下班
+func (s *Simulator) Stop() {
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+	s.wg.Wait()
+
+	for _, b := range s.buses {
+		if err := s.shift(driverShift.HandleShiftEnd, b, "休息"); err != nil {
+			log_service.GPSLogger.Printf("模拟驾驶员 %s 下班失败：%v\n", b.driverID, err)
+		}
+	}
+	s.buses = nil
+}
+
+// routes 参与模拟的线路
+func (s *Simulator) routes() []gps.RouteShape {
+	wanted := make(map[int]bool)
+	for _, id := range s.cfg.RouteIDs {
+		wanted[id] = true
+	}
+	var routes []gps.RouteShape
+	for _, route := range s.gpsAPI.RouteShapes() {
+		if len(route.Path) < 2 || route.Length == 0 {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[route.ID] {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// shift 通过与驾驶员端相同的上下班接口处理模拟驾驶员的上下班
+func (s *Simulator) shift(handler func(http.ResponseWriter, *http.Request, *gps.GPSAPI), b *bus, status string) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"driver_id":   b.driverID,
+		"car_id":      b.carID,
+		"car_isusing": status,
+		"route_id":    b.route.ID,
+	})
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler(recorder, request, s.gpsAPI)
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	return nil
+}
+
+// run 按上报间隔推进所有车辆
+func (s *Simulator) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(s.cfg.TickSeconds * float64(time.Second)))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			for _, b := range s.buses {
+				s.step(b, s.cfg.TickSeconds)
+			}
+		}
+	}
+}
+
+// step 将车辆推进 dt 秒并上报位置；经过站点时停靠并产生上下车消息
+func (s *Simulator) step(b *bus, dt float64) {
+	if b.dwellLeft > 0 {
+		b.dwellLeft -= dt
+	} else {
+		next := b.along + b.direction*b.speed*dt
+		if stop, ok := s.passedStop(b, next); ok {
+			next = stop.Along
+			s.arrive(b, stop)
+		}
+		b.along = next
+		s.wrap(b)
+	}
+
+	location := interpolate(b.route, b.along)
+	location = s.addNoise(location)
+	if err := s.gpsAPI.UpdateDriverLocation(b.driverID, location.Latitude, location.Longitude, b.carID); err != nil {
+		log_service.GPSLogger.Printf("模拟驾驶员 %s 上报位置失败：%v\n", b.driverID, err)
+	}
+}
+
+// passedStop 查找从当前位置行驶到 next 途中经过的第一个站点
+func (s *Simulator) passedStop(b *bus, next float64) (gps.RouteStop, bool) {
+	var found gps.RouteStop
+	best := math.Inf(1)
+	for _, stop := range b.route.Stops {
+		ahead := (stop.Along - b.along) * b.direction
+		if b.route.Closed && ahead <= 0 {
+			ahead += b.route.Length
+		}
+		travel := (next - b.along) * b.direction
+		if ahead > 0 && ahead <= travel && ahead < best {
+			found, best = stop, ahead
+		}
+	}
+	return found, !math.IsInf(best, 1)
+}
+
+// wrap 环线回到起点，非环线到达终点后掉头
+func (s *Simulator) wrap(b *bus) {
+	length := b.route.Length
+	if b.route.Closed {
+		b.along = math.Mod(b.along+length, length)
+		return
+	}
+	if b.along >= length {
+		b.along, b.direction = length, -1
+	} else if b.along <= 0 {
+		b.along, b.direction = 0, 1
+	}
+}
+
+// arrive 在站点停靠，随机产生下车与上车人数
+func (s *Simulator) arrive(b *bus, stop gps.RouteStop) {
+	b.dwellLeft = float64(s.cfg.DwellSeconds) * (0.5 + s.rng.Float64())
+	alighting := s.rng.Intn(b.passengers + 1)
+	boarding := s.rng.Intn(s.cfg.MaxBoarding + 1)
+
+	// 与乘客端消息经过 WebSocket 时一样先更新载客量，满载时本站不再上车
+	if alighting > 0 {
+		s.gpsAPI.RecordPassengers(b.carID, 0, alighting)
+		s.send(map[string]interface{}{"type": "alightingMessage", "car_id": b.carID, "alightingCount": alighting})
+	}
+	if boarding > 0 {
+		if _, err := s.gpsAPI.RecordPassengers(b.carID, boarding, 0); err != nil {
+			log_service.GPSLogger.Printf("模拟车辆 %s 无法上车：%v\n", b.carID, err)
+			boarding = 0
+		} else {
+			s.send(map[string]interface{}{"type": "boardingMessage", "car_id": b.carID, "boardingCount": boarding})
+		}
+	}
+	b.passengers += boarding - alighting
+	log_service.GPSLogger.Printf("模拟车辆 %s 停靠站点 %d（%s）：下车 %d 人，上车 %d 人\n", b.carID, stop.SiteID, stop.SiteName, alighting, boarding)
+}
+
+// send 与乘客端一样，将上下车消息发送给绑定了该车牌的连接
+func (s *Simulator) send(message map[string]interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	s.wsAPI.SendMessageByID(message["car_id"].(string), data)
+}
+
+// addNoise 为位置加上随机误差
+func (s *Simulator) addNoise(location gps.Location) gps.Location {
+	if s.cfg.NoiseMeters == 0 {
+		return location
+	}
+	location.Latitude += s.rng.NormFloat64() * s.cfg.NoiseMeters / metersPerDegree
+	location.Longitude += s.rng.NormFloat64() * s.cfg.NoiseMeters / (metersPerDegree * math.Cos(location.Latitude*math.Pi/180))
+	return location
+}
+
+// interpolate 计算沿线距离 along 处的位置
+func interpolate(route gps.RouteShape, along float64) gps.Location {
+	for i := 1; i < len(route.Path); i++ {
+		if along > route.Dist[i] && i < len(route.Path)-1 {
+			continue
+		}
+		segment := route.Dist[i] - route.Dist[i-1]
+		t := 0.0
+		if segment > 0 {
+			t = math.Max(0, math.Min(1, (along-route.Dist[i-1])/segment))
+		}
+		a, b := route.Path[i-1], route.Path[i]
+		return gps.Location{
+			Latitude:  a.Latitude + (b.Latitude-a.Latitude)*t,
+			Longitude: a.Longitude + (b.Longitude-a.Longitude)*t,
+		}
+	}
+	return route.Path[0]
+}
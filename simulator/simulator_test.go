@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"login/config"
+	"login/gps"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testRoute 一条 1000 米的直线路线，途经 200 米与 700 米处两个站点
+func testRoute(closed bool) gps.RouteShape {
+	return gps.RouteShape{
+		ID:     1,
+		Path:   []gps.Location{{Latitude: 31.2, Longitude: 121.4}, {Latitude: 31.2, Longitude: 121.41}, {Latitude: 31.21, Longitude: 121.41}},
+		Dist:   []float64{0, 400, 1000},
+		Length: 1000,
+		Closed: closed,
+		Stops:  []gps.RouteStop{{SiteID: 1, Along: 200}, {SiteID: 2, Along: 700}},
+	}
+}
+
+func TestSimulatorConfig(t *testing.T) {
+	saved := config.AppConfig.Simulator
+	t.Cleanup(func() { config.AppConfig.Simulator = saved })
+
+	config.AppConfig.Simulator = config.SimulatorConfig{SpeedJitter: 1.5, NoiseMeters: -3}
+	c := simulatorConfig()
+	if c.SpeedKmh != 18 || c.SpeedJitter != 0.2 || c.DwellSeconds != 20 || c.TickSeconds != 2 || c.NoiseMeters != 0 || c.MaxBoarding != 5 {
+		t.Errorf("defaults = %+v", c)
+	}
+
+	// 负的停靠时间表示不停靠
+	config.AppConfig.Simulator = config.SimulatorConfig{DwellSeconds: -1, SpeedKmh: 30, TickSeconds: 1}
+	if c := simulatorConfig(); c.DwellSeconds != 0 || c.SpeedKmh != 30 || c.TickSeconds != 1 {
+		t.Errorf("explicit config = %+v", c)
+	}
+}
+
+func TestPassedStop(t *testing.T) {
+	s := &Simulator{}
+	tests := []struct {
+		name      string
+		closed    bool
+		along     float64
+		direction float64
+		next      float64
+		wantStop  int // 0 表示没有经过站点
+	}{
+		{"before the first stop", false, 0, 1, 150, 0},
+		{"reaches a stop exactly", false, 150, 1, 200, 1},
+		{"first of two stops", false, 100, 1, 800, 1},
+		{"stop it is standing at is not passed again", false, 200, 1, 300, 0},
+		{"backwards", false, 900, -1, 600, 2},
+		{"loop wraps past the end", true, 900, 1, 1250, 1},
+		{"open line does not wrap", false, 900, 1, 1250, 0},
+	}
+	for _, tt := range tests {
+		b := &bus{route: testRoute(tt.closed), along: tt.along, direction: tt.direction}
+		stop, ok := s.passedStop(b, tt.next)
+		if ok != (tt.wantStop != 0) || stop.SiteID != tt.wantStop {
+			t.Errorf("%s: passed stop %d (%v), want %d", tt.name, stop.SiteID, ok, tt.wantStop)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	s := &Simulator{}
+	tests := []struct {
+		name          string
+		closed        bool
+		along         float64
+		direction     float64
+		wantAlong     float64
+		wantDirection float64
+	}{
+		{"loop passes the start", true, 1250, 1, 250, 1},
+		{"loop stays in range", true, 400, 1, 400, 1},
+		{"turns around at the end", false, 1030, 1, 1000, -1},
+		{"turns around at the start", false, -20, -1, 0, 1},
+		{"keeps going", false, 500, -1, 500, -1},
+	}
+	for _, tt := range tests {
+		b := &bus{route: testRoute(tt.closed), along: tt.along, direction: tt.direction}
+		s.wrap(b)
+		if b.along != tt.wantAlong || b.direction != tt.wantDirection {
+			t.Errorf("%s: along %v direction %v, want %v %v", tt.name, b.along, b.direction, tt.wantAlong, tt.wantDirection)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	route := testRoute(false)
+	tests := []struct {
+		along float64
+		want  gps.Location
+	}{
+		{-10, gps.Location{Latitude: 31.2, Longitude: 121.4}},
+		{0, gps.Location{Latitude: 31.2, Longitude: 121.4}},
+		{200, gps.Location{Latitude: 31.2, Longitude: 121.405}},
+		{400, gps.Location{Latitude: 31.2, Longitude: 121.41}},
+		{700, gps.Location{Latitude: 31.205, Longitude: 121.41}},
+		{1200, gps.Location{Latitude: 31.21, Longitude: 121.41}},
+	}
+	for _, tt := range tests {
+		got := interpolate(route, tt.along)
+		if math.Abs(got.Latitude-tt.want.Latitude) > 1e-9 || math.Abs(got.Longitude-tt.want.Longitude) > 1e-9 {
+			t.Errorf("interpolate(%v) = %+v, want %+v", tt.along, got, tt.want)
+		}
+	}
+}
+
+func TestAddNoiseIsSeeded(t *testing.T) {
+	origin := gps.Location{Latitude: 31.2, Longitude: 121.4}
+	noisy := func(seed int64, meters float64) gps.Location {
+		s := &Simulator{cfg: config.SimulatorConfig{NoiseMeters: meters}, rng: rand.New(rand.NewSource(seed))}
+		return s.addNoise(origin)
+	}
+
+	if got := noisy(1, 0); got != origin {
+		t.Errorf("location without noise = %+v", got)
+	}
+	a, b := noisy(42, 5), noisy(42, 5)
+	if a != b {
+		t.Errorf("same seed gave %+v and %+v", a, b)
+	}
+	if a == origin || math.Abs(a.Latitude-origin.Latitude)*metersPerDegree > 50 {
+		t.Errorf("noisy location = %+v, want a few meters from %+v", a, origin)
+	}
+}
@@ -43,6 +43,9 @@ var DatabaseStructure = `
 - 车牌号 car_id  
 - 意见反馈 remark  
 - 路径记录 record_route  
+- 行驶里程（公里） work_mileage  
+- 行驶时间（秒） work_moving_time  
+- 怠速时间（秒） work_idle_time  
 
 #### fare_table
 - 车费记录时间 fare_time  
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"errors"
+	"login/auth"
+	"login/config"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ClientIdentity 握手时由 token 确定的连接身份
+type ClientIdentity struct {
+	UserID     string      // token 的 subject，即用户编号
+	Role       config.Role // token 中的角色
+	ClientType string      // 由角色得到的客户端类型：driver / passenger / admin
+}
+
+// clientTypeForRole 根据 token 角色得到客户端类型
+func clientTypeForRole(role config.Role) (string, bool) {
+	switch role {
+	case config.RoleAdmin:
+		return ClientTypeAdmin, true
+	case config.RoleDriver:
+		return ClientTypeDriver, true
+	case config.RolePassenger:
+		return ClientTypePassenger, true
+	default:
+		return "", false
+	}
+}
+
+// tokenFromRequest 从 Authorization 请求头或 token 查询参数中读取 token
+// 浏览器的 WebSocket 无法设置请求头，因此同时支持查询参数
+func tokenFromRequest(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return token
+}
+
+// authenticate 验证握手请求中的 token，返回连接身份
+func authenticate(r *http.Request) (ClientIdentity, error) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		return ClientIdentity{}, errors.New("token is missing")
+	}
+	userID, role, err := auth.VerifyAToken(token)
+	if err != nil {
+		return ClientIdentity{}, err
+	}
+	clientType, ok := clientTypeForRole(role)
+	if !ok || userID == "" {
+		return ClientIdentity{}, errors.New("token has no valid role or subject")
+	}
+	return ClientIdentity{UserID: userID, Role: role, ClientType: clientType}, nil
+}
+
+// checkOrigin 校验跨域请求的来源：不带 Origin 的非浏览器客户端、与服务同源的页面以及白名单中的来源允许连接
+// 白名单中的 * 表示允许所有来源
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // 非浏览器客户端不带 Origin
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range config.AppConfig.WebSocket.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"login/config"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientTypeForRole(t *testing.T) {
+	tests := []struct {
+		role   config.Role
+		want   string
+		wantOK bool
+	}{
+		{config.RoleAdmin, ClientTypeAdmin, true},
+		{config.RoleDriver, ClientTypeDriver, true},
+		{config.RolePassenger, ClientTypePassenger, true},
+		{config.Unknown, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := clientTypeForRole(tt.role); got != tt.want || ok != tt.wantOK {
+			t.Errorf("clientTypeForRole(%v) = %q, %v, want %q, %v", tt.role, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   string
+	}{
+		{"bearer header", "/ws", "Bearer abc", "abc"},
+		{"bare header", "/ws", "  abc  ", "abc"},
+		{"header wins over query", "/ws?token=query", "Bearer header", "header"},
+		{"query parameter", "/ws?token=query", "", "query"},
+		{"missing", "/ws", "", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if got := tokenFromRequest(r); got != tt.want {
+			t.Errorf("%s: token = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := authenticate(httptest.NewRequest("GET", "/ws", nil)); err == nil {
+		t.Error("handshake without a token authenticated")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"non-browser client", "", nil, true},
+		{"same origin", "https://bus.example.com", nil, true},
+		{"same origin ignores case", "https://BUS.example.com", nil, true},
+		{"other origin", "https://evil.example.com", nil, false},
+		{"allow-listed", "https://admin.example.com", []string{"https://admin.example.com"}, true},
+		{"wildcard", "https://evil.example.com", []string{"*"}, true},
+		{"allow list is exact", "https://admin.example.com.evil.com", []string{"https://admin.example.com"}, false},
+	}
+	for _, tt := range tests {
+		setWebSocketConfig(t, func(c *config.WebSocketConfig) { c.AllowedOrigins = tt.allowed })
+		r := httptest.NewRequest("GET", "https://bus.example.com/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(r); got != tt.want {
+			t.Errorf("%s: checkOrigin(%q) = %v, want %v", tt.name, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"login/log_service"
+	"sync"
+	"time"
+)
+
+// 呼叫状态
+const (
+	CallStatusPending     = "pending"     // 已发送给在线驾驶员，等待确认
+	CallStatusDelivered   = "delivered"   // 至少一名驾驶员已确认收到
+	CallStatusUndelivered = "undelivered" // 没有驾驶员在线或所有发送都未得到确认
+	CallStatusAccepted    = "accepted"    // 已有驾驶员接受
+)
+
+// 呼叫相关的错误码
+const (
+	ErrCodeCallNotFound = "call_not_found" // 呼叫不存在或已过期
+	ErrCodeCallTaken    = "call_taken"     // 呼叫已被其他驾驶员接受
+)
+
+// Call 一次乘客呼叫及其送达情况
+type Call struct {
+	CallID          string `json:"call_id" desc:"呼叫编号"`
+	PassengerID     string `json:"passenger_id" desc:"发起呼叫的乘客（token 身份）"`
+	Status          string `json:"status" jsonschema:"enum=pending|delivered|undelivered|accepted" desc:"呼叫状态"`
+	Sent            int    `json:"sent" desc:"发送给的驾驶员数"`
+	Delivered       int    `json:"delivered" desc:"已确认收到的驾驶员数"`
+	Failed          int    `json:"failed" desc:"重试用尽仍未确认的驾驶员数"`
+	AcceptedBy      string `json:"accepted_by,omitempty" desc:"接受呼叫的驾驶员"`
+	CarID           string `json:"car_id,omitempty" desc:"接受呼叫的车辆"`
+	AcceptDelivered bool   `json:"accept_delivered" desc:"接受消息是否已被乘客确认收到"`
+	CreatedAt       string `json:"created_at" desc:"呼叫时间"`
+
+	clientMsgID string // 乘客发送时的 msg_id，用于去重
+	created     time.Time
+}
+
+// CallStatus 推送给乘客的呼叫状态，也是 call_status 查询的回复
+type CallStatus struct {
+	Type string `json:"type"` // 固定为 "call_status"
+	Call
+}
+
+// CallQuery call_status 消息：查询呼叫的送达情况
+type CallQuery struct {
+	CallID string `json:"call_id" jsonschema:"required,minLength=1" desc:"呼叫编号"`
+}
+
+// callRegistry 保存最近的呼叫，超过 call_ttl_seconds 后移除
+type callRegistry struct {
+	mu    sync.Mutex
+	calls map[string]*Call
+	byMsg map[string]string // 乘客编号 + 乘客的 msg_id -> call_id
+}
+
+func newCallRegistry() *callRegistry {
+	return &callRegistry{calls: make(map[string]*Call), byMsg: make(map[string]string)}
+}
+
+// create 创建呼叫；同一乘客以相同 msg_id 重发时返回已有呼叫和 false
+func (r *callRegistry) create(passengerID, clientMsgID string, now time.Time) (Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if clientMsgID != "" {
+		if callID, exists := r.byMsg[passengerID+"|"+clientMsgID]; exists {
+			if call, ok := r.calls[callID]; ok {
+				return *call, false
+			}
+		}
+	}
+	call := &Call{
+		CallID:      newMessageID(),
+		PassengerID: passengerID,
+		Status:      CallStatusPending,
+		CreatedAt:   now.Format("2006-01-02 15:04:05"),
+		clientMsgID: clientMsgID,
+		created:     now,
+	}
+	r.calls[call.CallID] = call
+	if clientMsgID != "" {
+		r.byMsg[passengerID+"|"+clientMsgID] = call.CallID
+	}
+	return *call, true
+}
+
+// update 在锁内修改呼叫并返回修改后的副本
+func (r *callRegistry) update(callID string, change func(call *Call)) (Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	call, exists := r.calls[callID]
+	if !exists {
+		return Call{}, false
+	}
+	change(call)
+	return *call, true
+}
+
+// get 获取呼叫的副本
+func (r *callRegistry) get(callID string) (Call, bool) {
+	return r.update(callID, func(*Call) {})
+}
+
+// expire 移除超过 call_ttl_seconds 的呼叫
+func (r *callRegistry) expire(now time.Time) {
+	ttl := time.Duration(wsConfig().CallTTLSeconds) * time.Second
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for callID, call := range r.calls {
+		if now.Sub(call.created) > ttl {
+			delete(r.calls, callID)
+			delete(r.byMsg, call.PassengerID+"|"+call.clientMsgID)
+		}
+	}
+}
+
+// clientsOf 获取某个用户的所有连接
+func (wm *WebSocketManager) clientsOf(userID string) []*client {
+	var clients []*client
+	for _, c := range wm.snapshotClients() {
+		if c.identity.UserID == userID {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// clientsOfType 获取某种类型的所有连接
+func (wm *WebSocketManager) clientsOfType(clientType string) []*client {
+	var clients []*client
+	for _, c := range wm.snapshotClients() {
+		if c.identity.ClientType == clientType {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// pushCallStatus 将呼叫状态推送给发起呼叫的乘客的所有连接
+func (wm *WebSocketManager) pushCallStatus(call Call) {
+	for _, c := range wm.clientsOf(call.PassengerID) {
+		if data, err := json.Marshal(CallStatus{Type: "call_status", Call: call}); err == nil {
+			wm.deliver(c, data)
+		}
+	}
+}
+
+// handleVehicleCall 处理乘客的 vehicle_call：登记呼叫，可靠地发送给所有在线驾驶员，抄送管理员
+func (wm *WebSocketManager) handleVehicleCall(ctx *ConnContext, p *VehicleCall) error {
+	call, created := wm.calls.create(ctx.Identity.UserID, p.MsgID, time.Now())
+	if !created {
+		// 乘客重发的同一呼叫不再转发，只回复当前状态
+		return ctx.Reply(CallStatus{Type: "call_status", Call: call})
+	}
+
+	message, err := withFields(ctx.Raw, map[string]interface{}{"msg_id": call.CallID, "call_id": call.CallID})
+	if err != nil {
+		return err
+	}
+	drivers := wm.clientsOfType(ClientTypeDriver)
+	call, _ = wm.calls.update(call.CallID, func(c *Call) {
+		c.Sent = len(drivers)
+		if len(drivers) == 0 {
+			c.Status = CallStatusUndelivered
+		}
+	})
+	log_service.WebSocketLogger.Printf("乘客 %s 发起呼叫 %s，发送给 %d 名驾驶员\n", call.PassengerID, call.CallID, len(drivers))
+	wm.pushCallStatus(call)
+
+	for _, driver := range drivers {
+		wm.sendReliable(driver, call.CallID, message, func() {
+			updated, ok := wm.calls.update(call.CallID, func(c *Call) {
+				c.Delivered++
+				if c.Status == CallStatusPending || c.Status == CallStatusUndelivered {
+					c.Status = CallStatusDelivered
+				}
+			})
+			if ok {
+				wm.pushCallStatus(updated)
+			}
+		}, func() {
+			updated, ok := wm.calls.update(call.CallID, func(c *Call) {
+				c.Failed++
+				if c.Status == CallStatusPending && c.Failed >= c.Sent {
+					c.Status = CallStatusUndelivered
+				}
+			})
+			if ok {
+				wm.pushCallStatus(updated)
+			}
+		})
+	}
+	for _, admin := range wm.clientsOfType(ClientTypeAdmin) {
+		wm.deliver(admin, message)
+	}
+	return nil
+}
+
+// handleCallAccept 处理驾驶员的 call_accept：记录接受者，可靠地通知乘客，并告知其他驾驶员呼叫已被接受
+// 不带 call_id 的旧版消息仍按原方式广播
+func (wm *WebSocketManager) handleCallAccept(ctx *ConnContext, p *CallAccept) error {
+	if p.CallID == "" {
+		log_service.WebSocketLogger.Printf("驾驶员 %s 的 call_accept 未携带 call_id，按旧方式广播\n", ctx.Identity.UserID)
+		wm.SendMessageToClients(ctx.Raw, "")
+		return nil
+	}
+
+	driverID := ctx.Identity.UserID
+	var taken, repeated bool
+	call, exists := wm.calls.update(p.CallID, func(c *Call) {
+		if c.AcceptedBy != "" {
+			taken = c.AcceptedBy != driverID
+			repeated = !taken
+			return
+		}
+		c.AcceptedBy = driverID
+		c.CarID = p.CarID
+		c.Status = CallStatusAccepted
+	})
+	if !exists {
+		return &MessageError{Code: ErrCodeCallNotFound, Err: errors.New("呼叫不存在或已过期")}
+	}
+	if taken {
+		return &MessageError{Code: ErrCodeCallTaken, Err: errors.New("呼叫已被其他驾驶员接受")}
+	}
+	if err := ctx.Reply(CallStatus{Type: "call_status", Call: call}); err != nil {
+		return err
+	}
+	if repeated {
+		// 同一驾驶员重发的接受消息已处理过，只回复当前状态
+		return nil
+	}
+
+	// 呼叫已被接受，不再向其他驾驶员重发
+	wm.cancelDeliveries(call.CallID)
+	log_service.WebSocketLogger.Printf("驾驶员 %s（车辆 %s）接受了乘客 %s 的呼叫 %s\n", driverID, p.CarID, call.PassengerID, call.CallID)
+
+	acceptID := newMessageID()
+	message, err := withFields(ctx.Raw, map[string]interface{}{"msg_id": acceptID, "call_id": call.CallID, "driver_id": driverID})
+	if err != nil {
+		return err
+	}
+	for _, passenger := range wm.clientsOf(call.PassengerID) {
+		wm.sendReliable(passenger, acceptID, message, func() {
+			if updated, ok := wm.calls.update(call.CallID, func(c *Call) { c.AcceptDelivered = true }); ok {
+				wm.pushCallStatus(updated)
+			}
+		}, nil)
+	}
+	for _, c := range wm.snapshotClients() {
+		if c.identity.ClientType != ClientTypePassenger && c.conn != ctx.Conn {
+			wm.deliver(c, message)
+		}
+	}
+	return nil
+}
+
+// handleCallQuery 处理 call_status 查询，只有发起呼叫的乘客和管理员可以查询
+func (wm *WebSocketManager) handleCallQuery(ctx *ConnContext, p *CallQuery) error {
+	call, exists := wm.calls.get(p.CallID)
+	if !exists {
+		return &MessageError{Code: ErrCodeCallNotFound, Err: errors.New("呼叫不存在或已过期")}
+	}
+	if call.PassengerID != ctx.Identity.UserID && ctx.Identity.ClientType != ClientTypeAdmin {
+		return Forbidden("只能查询自己发起的呼叫")
+	}
+	return ctx.Reply(CallStatus{Type: "call_status", Call: call})
+}
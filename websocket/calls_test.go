@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"encoding/json"
+	"login/config"
+	"testing"
+	"time"
+)
+
+func TestCallRegistry(t *testing.T) {
+	setWebSocketConfig(t, func(c *config.WebSocketConfig) { c.CallTTLSeconds = 60 })
+	r := newCallRegistry()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+
+	call, created := r.create("p1", "m1", now)
+	if !created || call.Status != CallStatusPending || call.CreatedAt != "2024-05-01 08:00:00" {
+		t.Fatalf("created call = %+v, %v", call, created)
+	}
+	// 同一乘客以相同 msg_id 重发返回已有呼叫
+	if again, created := r.create("p1", "m1", now); created || again.CallID != call.CallID {
+		t.Errorf("resent call = %+v, %v, want existing %s", again, created, call.CallID)
+	}
+	if other, created := r.create("p2", "m1", now); !created || other.CallID == call.CallID {
+		t.Error("msg_id of another passenger matched the call")
+	}
+	if first, second := mustCreate(t, r, "p1", now), mustCreate(t, r, "p1", now); first.CallID == second.CallID {
+		t.Error("calls without msg_id were deduplicated")
+	}
+
+	updated, ok := r.update(call.CallID, func(c *Call) { c.Status = CallStatusDelivered })
+	if got, _ := r.get(call.CallID); !ok || updated.Status != CallStatusDelivered || got.Status != CallStatusDelivered {
+		t.Errorf("updated call = %+v, stored %+v", updated, got)
+	}
+
+	r.expire(now.Add(time.Minute))
+	if _, ok := r.get(call.CallID); !ok {
+		t.Error("call expired before call_ttl_seconds")
+	}
+	r.expire(now.Add(time.Minute + time.Second))
+	if len(r.calls) != 0 || len(r.byMsg) != 0 {
+		t.Errorf("calls left after ttl: %v %v", r.calls, r.byMsg)
+	}
+	if _, created := r.create("p1", "m1", now); !created {
+		t.Error("msg_id of an expired call still deduplicated")
+	}
+}
+
+// mustCreate 创建一个不带 msg_id 的呼叫
+func mustCreate(t *testing.T, r *callRegistry, passengerID string, now time.Time) Call {
+	t.Helper()
+	call, created := r.create(passengerID, "", now)
+	if !created {
+		t.Fatalf("call without msg_id was not created")
+	}
+	return call
+}
+
+// callMessage 连接收到的呼叫相关消息
+type callMessage struct {
+	Type     string `json:"type"`
+	MsgID    string `json:"msg_id"`
+	CallID   string `json:"call_id"`
+	Status   string `json:"status"`
+	DriverID string `json:"driver_id"`
+	Code     string `json:"code"`
+}
+
+// takeMessages 取出连接发送队列中的所有消息
+func takeMessages(t *testing.T, c *client) []callMessage {
+	t.Helper()
+	var messages []callMessage
+	for len(c.send) > 0 {
+		var m callMessage
+		if err := json.Unmarshal(<-c.send, &m); err != nil {
+			t.Fatalf("bad message: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestVehicleCallFlow(t *testing.T) {
+	wm := NewWebSocketManager()
+	passengerIdentity := ClientIdentity{UserID: "p1", Role: config.RolePassenger, ClientType: ClientTypePassenger}
+	firstIdentity := ClientIdentity{UserID: "d1", Role: config.RoleDriver, ClientType: ClientTypeDriver}
+	secondIdentity := ClientIdentity{UserID: "d2", Role: config.RoleDriver, ClientType: ClientTypeDriver}
+	passenger := registerIdle(t, wm, passengerIdentity)
+	first := registerIdle(t, wm, firstIdentity)
+	second := registerIdle(t, wm, secondIdentity)
+	admin := registerIdle(t, wm, ClientIdentity{UserID: "a1", Role: config.RoleAdmin, ClientType: ClientTypeAdmin})
+	dispatch := func(c *client, message string) {
+		wm.handlers.Dispatch(&ConnContext{Conn: c.conn, Identity: c.identity, Manager: wm, Raw: []byte(message)})
+	}
+
+	call := `{"type":"vehicle_call","msg_id":"p-1","from_str":"中山路","to_str":"火车站"}`
+	dispatch(passenger, call)
+	status := takeMessages(t, passenger)
+	if len(status) != 1 || status[0].Type != "call_status" || status[0].Status != CallStatusPending {
+		t.Fatalf("passenger got %+v", status)
+	}
+	callID := status[0].CallID
+	for name, c := range map[string]*client{"d1": first, "d2": second, "admin": admin} {
+		if got := takeMessages(t, c); len(got) != 1 || got[0].CallID != callID || got[0].MsgID != callID {
+			t.Errorf("%s got %+v", name, got)
+		}
+	}
+
+	// 乘客重发同一呼叫只收到当前状态，不再转发
+	dispatch(passenger, call)
+	if got := takeMessages(t, passenger); len(got) != 1 || got[0].CallID != callID {
+		t.Errorf("resent call reply = %+v", got)
+	}
+	if len(first.send) != 0 {
+		t.Error("resent call was forwarded again")
+	}
+
+	dispatch(first, `{"type":"ack","msg_id":"`+callID+`"}`)
+	if got := takeMessages(t, passenger); len(got) != 1 || got[0].Status != CallStatusDelivered {
+		t.Errorf("status after ack = %+v", got)
+	}
+
+	dispatch(first, `{"type":"call_accept","call_id":"`+callID+`","car_id":"沪A1"}`)
+	if got := takeMessages(t, first); len(got) != 1 || got[0].Status != CallStatusAccepted {
+		t.Errorf("accepting driver got %+v", got)
+	}
+	accept := takeMessages(t, passenger)
+	if len(accept) != 1 || accept[0].Type != "call_accept" || accept[0].DriverID != "d1" || accept[0].MsgID == "" {
+		t.Fatalf("passenger got %+v", accept)
+	}
+	if got := takeMessages(t, second); len(got) != 1 || got[0].Type != "call_accept" {
+		t.Errorf("other driver got %+v", got)
+	}
+	if _, pending := wm.deliveries.pending[callID]; pending {
+		t.Error("call is still resent after it was accepted")
+	}
+
+	dispatch(second, `{"type":"call_accept","call_id":"`+callID+`","car_id":"沪B2"}`)
+	if got := takeMessages(t, second); len(got) != 1 || got[0].Code != ErrCodeCallTaken {
+		t.Errorf("second accept got %+v", got)
+	}
+
+	dispatch(passenger, `{"type":"ack","msg_id":"`+accept[0].MsgID+`"}`)
+	if got, _ := wm.calls.get(callID); !got.AcceptDelivered || got.AcceptedBy != "d1" || got.CarID != "沪A1" || got.Delivered != 1 {
+		t.Errorf("call = %+v", got)
+	}
+	takeMessages(t, passenger)
+
+	// 只有发起呼叫的乘客和管理员可以查询
+	query := `{"type":"call_status","call_id":"` + callID + `"}`
+	dispatch(second, query)
+	if got := takeMessages(t, second); len(got) != 1 || got[0].Code != ErrCodeForbidden {
+		t.Errorf("driver query got %+v", got)
+	}
+	dispatch(admin, query)
+	if got := takeMessages(t, admin); len(got) != 2 || got[1].Status != CallStatusAccepted {
+		t.Errorf("admin messages = %+v", got)
+	}
+	dispatch(passenger, `{"type":"call_status","call_id":"unknown"}`)
+	if got := takeMessages(t, passenger); len(got) != 1 || got[0].Code != ErrCodeCallNotFound {
+		t.Errorf("unknown call query got %+v", got)
+	}
+}
+
+func TestVehicleCallWithoutDrivers(t *testing.T) {
+	wm := NewWebSocketManager()
+	passenger := registerIdle(t, wm, ClientIdentity{UserID: "p1", Role: config.RolePassenger, ClientType: ClientTypePassenger})
+
+	wm.handlers.Dispatch(&ConnContext{Conn: passenger.conn, Identity: passenger.identity, Manager: wm, Raw: []byte(`{"type":"vehicle_call"}`)})
+	if got := takeMessages(t, passenger); len(got) != 1 || got[0].Status != CallStatusUndelivered {
+		t.Errorf("passenger got %+v", got)
+	}
+}
@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"context"
+	"login/config"
+	"login/log_service"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConfig 返回填充了默认值的 WebSocket 配置
+func wsConfig() config.WebSocketConfig {
+	c := config.AppConfig.WebSocket
+	if c.SendQueueSize <= 0 {
+		c.SendQueueSize = 256
+	}
+	if c.WriteTimeoutSeconds <= 0 {
+		c.WriteTimeoutSeconds = 10
+	}
+	if c.PongTimeoutSeconds <= 0 {
+		c.PongTimeoutSeconds = 60
+	}
+	if c.PingIntervalSeconds <= 0 || c.PingIntervalSeconds >= c.PongTimeoutSeconds {
+		// ping 必须在 pong 超时之前发出
+		c.PingIntervalSeconds = c.PongTimeoutSeconds * 9 / 10
+		if c.PingIntervalSeconds <= 0 {
+			c.PingIntervalSeconds = 1
+		}
+	}
+	if c.MaxMessageBytes <= 0 {
+		c.MaxMessageBytes = 1 << 20
+	}
+	if c.AckTimeoutSeconds <= 0 {
+		c.AckTimeoutSeconds = 5
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 3
+	}
+	if c.CallTTLSeconds <= 0 {
+		c.CallTTLSeconds = 600
+	}
+	if c.OfflineTTLSeconds <= 0 {
+		c.OfflineTTLSeconds = 3600
+	}
+	if c.OfflineQueueSize <= 0 || c.OfflineQueueSize > c.SendQueueSize {
+		// 补发的离线消息必须能一次放入发送队列
+		c.OfflineQueueSize = c.SendQueueSize / 2
+	}
+	return c
+}
+
+// client 一个已注册的连接
+// gorilla/websocket 的连接不支持并发写，所有发往该连接的消息都先进入 send 队列，由 writePump 协程依次写出
+type client struct {
+	conn     *websocket.Conn
+	identity ClientIdentity
+	cfg      config.WebSocketConfig // 连接建立时的配置快照，读写协程只使用它
+	send     chan []byte
+	closed   chan struct{} // 客户端被移除或写失败后关闭，writePump 随之退出
+	once     sync.Once
+	bound    map[string]string // 绑定到该连接的 ID 及其类型（bindDriver / bindCar），由 WebSocketManager.mu 保护
+	replay   *replayJob        // 正在进行的轨迹回放，由 WebSocketManager.mu 保护
+}
+
+// replayJob 一个连接上正在进行的轨迹回放
+type replayJob struct {
+	cancel context.CancelFunc
+}
+
+// newClient 创建客户端，send 队列长度由 websocket.send_queue_size 决定
+func newClient(conn *websocket.Conn, identity ClientIdentity) *client {
+	cfg := wsConfig()
+	return &client{
+		conn:     conn,
+		identity: identity,
+		cfg:      cfg,
+		send:     make(chan []byte, cfg.SendQueueSize),
+		closed:   make(chan struct{}),
+		bound:    make(map[string]string),
+	}
+}
+
+// enqueue 将消息放入发送队列，不会阻塞；客户端已关闭或队列已满时返回 false
+func (c *client) enqueue(message []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// isClosed 判断客户端是否已关闭
+func (c *client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 停止写协程并关闭连接，可重复调用；连接关闭后读循环随之退出并注销客户端
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// prepareRead 设置读取限制与读超时：收到 pong 或任何消息都会延长读超时，超时后 ReadMessage 返回错误
+func (c *client) prepareRead() {
+	pongWait := time.Duration(c.cfg.PongTimeoutSeconds) * time.Second
+	c.conn.SetReadLimit(c.cfg.MaxMessageBytes)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+}
+
+// extendReadDeadline 收到客户端消息后延长读超时
+func (c *client) extendReadDeadline() {
+	c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.cfg.PongTimeoutSeconds) * time.Second))
+}
+
+// writePump 依次写出 send 队列中的消息并定时发送 ping，是该连接唯一的写入者
+func (c *client) writePump() {
+	timeout := time.Duration(c.cfg.WriteTimeoutSeconds) * time.Second
+	ticker := time.NewTicker(time.Duration(c.cfg.PingIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(timeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log_service.WebSocketLogger.Printf("向用户 %s（%s）发送消息失败，错误：%v\n", c.identity.UserID, c.identity.ClientType, err)
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(timeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log_service.WebSocketLogger.Printf("向用户 %s（%s）发送 ping 失败，错误：%v\n", c.identity.UserID, c.identity.ClientType, err)
+				c.close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// clientFor 查找连接对应的客户端
+func (wm *WebSocketManager) clientFor(conn *websocket.Conn) (*client, bool) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	c, ok := wm.clients[conn]
+	return c, ok
+}
+
+// deliver 将消息放入客户端的发送队列，队列已满的慢速客户端会被断开，避免拖慢其他客户端
+func (wm *WebSocketManager) deliver(c *client, message []byte) bool {
+	if c.enqueue(message) {
+		return true
+	}
+	select {
+	case <-c.closed:
+	default:
+		log_service.WebSocketLogger.Printf("用户 %s（%s）发送队列已满，断开连接\n", c.identity.UserID, c.identity.ClientType)
+		c.close()
+	}
+	return false
+}
+
+// send 向指定连接发送消息，连接未注册、已关闭或发送队列已满时返回 false
+func (wm *WebSocketManager) send(conn *websocket.Conn, message []byte) bool {
+	c, ok := wm.clientFor(conn)
+	if !ok {
+		return false
+	}
+	return wm.deliver(c, message)
+}
+
+// snapshotClients 复制当前所有客户端，供遍历发送时使用，避免持锁写入
+func (wm *WebSocketManager) snapshotClients() []*client {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	clients := make([]*client, 0, len(wm.clients))
+	for _, c := range wm.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Ack 客户端收到带 msg_id 的消息后回复的确认
+type Ack struct {
+	MsgID string `json:"msg_id" jsonschema:"required,minLength=1" desc:"收到的消息的 msg_id"`
+}
+
+// newMessageID 生成消息编号
+func newMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withFields 在 JSON 对象消息中加入或覆盖字段，用于给转发的原始消息加上 msg_id、call_id 等
+func withFields(raw []byte, fields map[string]interface{}) ([]byte, error) {
+	var message map[string]interface{}
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		message[k] = v
+	}
+	return json.Marshal(message)
+}
+
+// pendingDelivery 一条等待某个客户端确认的消息
+type pendingDelivery struct {
+	client   *client
+	message  []byte
+	attempts int // 已发送次数
+	lastSent time.Time
+	onAck    func()
+	onFail   func()
+}
+
+// deliveryTracker 可靠发送：消息带 msg_id 发出，客户端回复 ack 前按 ack_timeout_seconds 重发，最多重发 max_retries 次
+// 重发的消息使用相同的 msg_id，客户端应按 msg_id 去重
+type deliveryTracker struct {
+	mu      sync.Mutex
+	pending map[string]map[*client]*pendingDelivery // msg_id -> 客户端 -> 待确认的发送
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{pending: make(map[string]map[*client]*pendingDelivery)}
+}
+
+// sendReliable 向客户端发送一条需要确认的消息，确认后调用 onAck，重试用尽或客户端断开后调用 onFail
+func (wm *WebSocketManager) sendReliable(c *client, msgID string, message []byte, onAck, onFail func()) {
+	d := &pendingDelivery{client: c, message: message, attempts: 1, lastSent: time.Now(), onAck: onAck, onFail: onFail}
+	wm.deliveries.mu.Lock()
+	if wm.deliveries.pending[msgID] == nil {
+		wm.deliveries.pending[msgID] = make(map[*client]*pendingDelivery)
+	}
+	wm.deliveries.pending[msgID][c] = d
+	wm.deliveries.mu.Unlock()
+
+	// 入队失败时等待重试或在客户端断开后判定失败
+	wm.deliver(c, message)
+}
+
+// ack 处理客户端的确认，返回该确认是否对应一条待确认的消息
+func (wm *WebSocketManager) ack(c *client, msgID string) bool {
+	wm.deliveries.mu.Lock()
+	d, exists := wm.deliveries.pending[msgID][c]
+	if exists {
+		delete(wm.deliveries.pending[msgID], c)
+		if len(wm.deliveries.pending[msgID]) == 0 {
+			delete(wm.deliveries.pending, msgID)
+		}
+	}
+	wm.deliveries.mu.Unlock()
+
+	if exists && d.onAck != nil {
+		d.onAck()
+	}
+	return exists
+}
+
+// cancelDeliveries 停止重发某条消息（例如呼叫已被接受后不再重发给其他驾驶员），不调用回调
+func (wm *WebSocketManager) cancelDeliveries(msgID string) {
+	wm.deliveries.mu.Lock()
+	delete(wm.deliveries.pending, msgID)
+	wm.deliveries.mu.Unlock()
+}
+
+// retryDeliveries 重发超时未确认的消息，重试用尽或客户端已断开的判定为失败
+func (wm *WebSocketManager) retryDeliveries(now time.Time) {
+	cfg := wsConfig()
+	timeout := time.Duration(cfg.AckTimeoutSeconds) * time.Second
+
+	var resend []*pendingDelivery
+	var failed []*pendingDelivery
+	wm.deliveries.mu.Lock()
+	for msgID, deliveries := range wm.deliveries.pending {
+		for c, d := range deliveries {
+			if now.Sub(d.lastSent) < timeout && !c.isClosed() {
+				continue
+			}
+			if d.attempts > cfg.MaxRetries || c.isClosed() {
+				delete(deliveries, c)
+				failed = append(failed, d)
+				continue
+			}
+			d.attempts++
+			d.lastSent = now
+			resend = append(resend, d)
+		}
+		if len(deliveries) == 0 {
+			delete(wm.deliveries.pending, msgID)
+		}
+	}
+	wm.deliveries.mu.Unlock()
+
+	for _, d := range resend {
+		wm.deliver(d.client, d.message)
+	}
+	for _, d := range failed {
+		if d.onFail != nil {
+			d.onFail()
+		}
+	}
+}
+
+// startRetryLoop 每秒检查一次待确认的消息与过期的呼叫，并定期清理过期的离线消息
+func (wm *WebSocketManager) startRetryLoop() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			wm.retryDeliveries(now)
+			wm.calls.expire(now)
+			wm.offline.purgeExpired(now)
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"encoding/json"
+	"login/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithFields(t *testing.T) {
+	got, err := withFields([]byte(`{"type":"vehicle_call","msg_id":"p-1","from_str":"中山路"}`), map[string]interface{}{"msg_id": "c1", "call_id": "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]interface{}
+	json.Unmarshal(got, &message)
+	want := map[string]interface{}{"type": "vehicle_call", "msg_id": "c1", "call_id": "c1", "from_str": "中山路"}
+	if !reflect.DeepEqual(message, want) {
+		t.Errorf("message = %v, want %v", message, want)
+	}
+
+	if _, err := withFields([]byte(`[1,2]`), map[string]interface{}{"msg_id": "c1"}); err == nil {
+		t.Error("non-object message accepted")
+	}
+}
+
+func TestRetryDeliveries(t *testing.T) {
+	setWebSocketConfig(t, func(c *config.WebSocketConfig) {
+		c.AckTimeoutSeconds = 5
+		c.MaxRetries = 2
+	})
+	wm := NewWebSocketManager()
+	c := registerIdle(t, wm, ClientIdentity{UserID: "d1", ClientType: ClientTypeDriver})
+
+	var failed int
+	start := time.Now()
+	wm.sendReliable(c, "m1", []byte(`{"msg_id":"m1"}`), func() { t.Error("unacknowledged message reported as acked") }, func() { failed++ })
+
+	steps := []struct {
+		after      time.Duration
+		wantSent   int // 累计发送次数
+		wantFailed int
+	}{
+		{time.Second, 1, 0},
+		{6 * time.Second, 2, 0},
+		{8 * time.Second, 2, 0},
+		{12 * time.Second, 3, 0},
+		{18 * time.Second, 3, 1}, // 重发 2 次后仍未确认
+		{30 * time.Second, 3, 1},
+	}
+	for _, step := range steps {
+		wm.retryDeliveries(start.Add(step.after))
+		if len(c.send) != step.wantSent || failed != step.wantFailed {
+			t.Fatalf("after %v: sent %d failed %d, want %d %d", step.after, len(c.send), failed, step.wantSent, step.wantFailed)
+		}
+	}
+	if len(wm.deliveries.pending) != 0 {
+		t.Errorf("pending deliveries left: %v", wm.deliveries.pending)
+	}
+}
+
+func TestAckAndCancel(t *testing.T) {
+	wm := NewWebSocketManager()
+	first := registerIdle(t, wm, ClientIdentity{UserID: "d1", ClientType: ClientTypeDriver})
+	second := registerIdle(t, wm, ClientIdentity{UserID: "d2", ClientType: ClientTypeDriver})
+
+	var acked, failed []string
+	track := func(name string) (func(), func()) {
+		return func() { acked = append(acked, name) }, func() { failed = append(failed, name) }
+	}
+	onAck, onFail := track("first")
+	wm.sendReliable(first, "m1", []byte(`{}`), onAck, onFail)
+	onAck, onFail = track("second")
+	wm.sendReliable(second, "m1", []byte(`{}`), onAck, onFail)
+
+	if wm.ack(first, "unknown") {
+		t.Error("ack of an unknown message matched")
+	}
+	if !wm.ack(first, "m1") || wm.ack(first, "m1") {
+		t.Error("ack did not match exactly once")
+	}
+	if !reflect.DeepEqual(acked, []string{"first"}) {
+		t.Errorf("acked = %v", acked)
+	}
+
+	// 取消后不再重发，也不调用回调
+	wm.cancelDeliveries("m1")
+	wm.retryDeliveries(time.Now().Add(time.Hour))
+	if wm.ack(second, "m1") || len(failed) != 0 || len(second.send) != 1 {
+		t.Errorf("cancelled delivery: failed %v, sent %d", failed, len(second.send))
+	}
+
+	// 客户端断开后下一次检查即判定失败，不等待超时
+	onAck, onFail = track("closed")
+	wm.sendReliable(second, "m2", []byte(`{}`), onAck, onFail)
+	second.close()
+	wm.retryDeliveries(time.Now())
+	if !reflect.DeepEqual(failed, []string{"closed"}) {
+		t.Errorf("failed = %v, want [closed]", failed)
+	}
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"errors"
+	"login/log_service"
+)
+
+// 各内置消息类型的消息内容，字段名与旧版协议保持一致
+
+// DriverBinding connections 消息：将连接绑定到驾驶员
+type DriverBinding struct {
+	DriverID string `json:"driver_id" desc:"可省略，不为空时必须与 token 身份一致"`
+}
+
+// CarBinding car_conn 消息：将连接绑定到车辆
+type CarBinding struct {
+	CarID string `json:"car_id" jsonschema:"required,minLength=1" desc:"车牌号"`
+}
+
+// DriverGPS driver_gps 消息：驾驶员上报位置
+type DriverGPS struct {
+	DriverID string   `json:"driver_id" desc:"可省略，不为空时必须与 token 身份一致"`
+	CarID    string   `json:"car_id" desc:"车牌号"`
+	Location Location `json:"location" jsonschema:"required"`
+}
+
+// GPSSubscribe subscribe_gps 消息：按线路或车辆订阅驾驶员位置
+type GPSSubscribe struct {
+	RouteIDs []int    `json:"route_ids" desc:"订阅的线路"`
+	CarIDs   []string `json:"car_ids" desc:"订阅的车辆"`
+}
+
+// TopicList subscribe / unsubscribe 消息：订阅或退订主题
+type TopicList struct {
+	Topics []string `json:"topics" desc:"主题，例如 route:101；unsubscribe 省略时退订全部主题"`
+}
+
+// ReplayRequest replay 消息：回放历史轨迹
+type ReplayRequest struct {
+	DriverID  string  `json:"driver_id" desc:"与 car_id 至少提供一个"`
+	CarID     string  `json:"car_id" desc:"与 driver_id 至少提供一个"`
+	StartTime string  `json:"start_time" desc:"回放开始时间"`
+	EndTime   string  `json:"end_time" desc:"回放结束时间"`
+	Speed     float64 `json:"speed" jsonschema:"minimum=0" desc:"回放倍速"`
+}
+
+func (p *ReplayRequest) Validate() error {
+	if p.DriverID == "" && p.CarID == "" {
+		return errors.New("driver_id 与 car_id 不能同时为空")
+	}
+	return nil
+}
+
+// VehicleCall vehicle_call 消息：乘客呼叫车辆
+type VehicleCall struct {
+	MsgID       string   `json:"msg_id" desc:"可省略，乘客重发同一呼叫时使用相同的 msg_id，服务端据此去重"`
+	PassengerID string   `json:"passenger_id"`
+	From        Location `json:"from" desc:"起点位置"`
+	To          Location `json:"to" desc:"终点位置"`
+	FromStr     string   `json:"from_str" desc:"起点名称"`
+	ToStr       string   `json:"to_str" desc:"终点名称"`
+	Time        string   `json:"time"`
+	Status      string   `json:"status"`
+}
+
+// CallAccept call_accept 消息：驾驶员接受呼叫
+type CallAccept struct {
+	CallID      string `json:"call_id" desc:"vehicle_call 转发给驾驶员时附带的呼叫编号，省略时按旧方式广播"`
+	PassengerID string `json:"passenger_id"`
+	DriverID    string `json:"driver_id"`
+	CarID       string `json:"car_id" desc:"接受呼叫的车辆"`
+	Status      string `json:"status"`
+}
+
+// PaymentUserCount payment_user_count 消息：车辆的付款人数
+type PaymentUserCount struct {
+	CarID string `json:"car_id" jsonschema:"required,minLength=1" desc:"车牌号"`
+	Count int    `json:"count" jsonschema:"minimum=0" desc:"付款人数"`
+}
+
+// BoardingNotice boardingMessage 消息：上车人数
+type BoardingNotice struct {
+	CarID         string `json:"car_id" jsonschema:"required,minLength=1" desc:"车牌号"`
+	BoardingCount int    `json:"boardingCount" jsonschema:"minimum=0" desc:"上车人数"`
+}
+
+// AlightingNotice alightingMessage 消息：下车人数
+type AlightingNotice struct {
+	CarID          string `json:"car_id" jsonschema:"required,minLength=1" desc:"车牌号"`
+	AlightingCount int    `json:"alightingCount" jsonschema:"minimum=0" desc:"下车人数"`
+}
+
+// SiteList update_sites 消息：写入或更新站点
+type SiteList struct {
+	Sites []Site `json:"sites" jsonschema:"required,minItems=1"`
+}
+
+// RouteList update_routes / delete_route 消息：保存或删除线路
+// schema 要求 routes 至少有一个元素，delete_route 取第一条线路时不会越界
+type RouteList struct {
+	Routes []Route `json:"routes" jsonschema:"required,minItems=1"`
+}
+
+// authorizeCar 检查连接能否代表车辆发送消息：管理员不受限制，驾驶员只能代表通过 car_conn 绑定到本连接的车辆
+// 上下车与付款人数会改写车辆的载客量，不能由乘客或其他车辆的驾驶员发送
+func authorizeCar(ctx *ConnContext, carID string) error {
+	if ctx.Identity.ClientType == ClientTypeAdmin {
+		return nil
+	}
+	if !ctx.Manager.boundTo(ctx.Conn, carID, bindCar) {
+		return Forbidden("连接未绑定车辆 %s，请先发送 car_conn", carID)
+	}
+	return nil
+}
+
+// registerBuiltinHandlers 注册内置消息类型的处理函数
+func registerBuiltinHandlers(r *HandlerRegistry) {
+	drivers := []string{ClientTypeDriver}
+	admins := []string{ClientTypeAdmin}
+	carReporters := []string{ClientTypeDriver, ClientTypeAdmin}
+
+	RegisterHandler(r, "connections", drivers, func(ctx *ConnContext, p *DriverBinding) error {
+		if p.DriverID != "" && p.DriverID != ctx.Identity.UserID {
+			return Forbidden("driver_id 与 token 身份不一致")
+		}
+		// 连接只绑定到 token 中的身份
+		ctx.Manager.bind(ctx.Identity.UserID, bindDriver, ctx.Conn)
+		return nil
+	})
+	RegisterHandler(r, "car_conn", drivers, func(ctx *ConnContext, p *CarBinding) error {
+		carID, err := shiftCar(ctx.Identity.UserID)
+		if err != nil {
+			return err
+		}
+		if carID != p.CarID {
+			return Forbidden("只能绑定本人当前班次的车辆")
+		}
+		ctx.Manager.bind(p.CarID, bindCar, ctx.Conn)
+		return nil
+	})
+	RegisterHandler(r, "call_accept", drivers, func(ctx *ConnContext, p *CallAccept) error {
+		return ctx.Manager.handleCallAccept(ctx, p)
+	})
+	RegisterHandler(r, "call_status", nil, func(ctx *ConnContext, p *CallQuery) error {
+		return ctx.Manager.handleCallQuery(ctx, p)
+	})
+	RegisterHandler(r, "ack", nil, func(ctx *ConnContext, p *Ack) error {
+		if c, ok := ctx.Manager.clientFor(ctx.Conn); ok {
+			ctx.Manager.ack(c, p.MsgID)
+		}
+		return nil
+	})
+	RegisterHandler(r, "driver_gps", drivers, func(ctx *ConnContext, p *DriverGPS) error {
+		if p.DriverID != "" && p.DriverID != ctx.Identity.UserID {
+			return Forbidden("driver_id 与 token 身份不一致")
+		}
+		if ctx.Manager.Updater == nil {
+			return nil
+		}
+		if err := ctx.Manager.Updater.UpdateDriverLocation(ctx.Identity.UserID, p.Location.Latitude, p.Location.Longitude, p.CarID); err != nil {
+			log_service.WebSocketLogger.Printf("更新驾驶员位置失败：%v\n", err)
+		}
+		return nil
+	})
+	RegisterHandler(r, "subscribe_gps", nil, func(ctx *ConnContext, p *GPSSubscribe) error {
+		ctx.Manager.subscribeGPS(ctx.Conn, p.RouteIDs, p.CarIDs)
+		return nil
+	})
+	RegisterHandler(r, "unsubscribe_gps", nil, func(ctx *ConnContext, p *struct{}) error {
+		ctx.Manager.unsubscribeGPS(ctx.Conn)
+		return nil
+	})
+	RegisterHandler(r, "subscribe", nil, func(ctx *ConnContext, p *TopicList) error {
+		ctx.Manager.subscribeTopics(ctx.Conn, ctx.Identity, p.Topics)
+		return nil
+	})
+	RegisterHandler(r, "unsubscribe", nil, func(ctx *ConnContext, p *TopicList) error {
+		ctx.Manager.unsubscribeTopics(ctx.Conn, p.Topics)
+		return nil
+	})
+	RegisterHandler(r, "replay", admins, func(ctx *ConnContext, p *ReplayRequest) error {
+		ctx.Manager.startReplay(ctx.Conn, *p)
+		return nil
+	})
+	RegisterHandler(r, "vehicle_call", nil, func(ctx *ConnContext, p *VehicleCall) error {
+		return ctx.Manager.handleVehicleCall(ctx, p)
+	})
+	RegisterHandler(r, "payment_user_count", carReporters, func(ctx *ConnContext, p *PaymentUserCount) error {
+		if err := authorizeCar(ctx, p.CarID); err != nil {
+			return err
+		}
+		ctx.Manager.SendMessageByID(p.CarID, ctx.Raw)
+		return nil
+	})
+	RegisterHandler(r, "boardingMessage", carReporters, func(ctx *ConnContext, p *BoardingNotice) error {
+		if err := authorizeCar(ctx, p.CarID); err != nil {
+			return err
+		}
+		if ctx.Manager.countPassengers(ctx.Conn, p.CarID, p.BoardingCount, 0) {
+			ctx.Manager.SendMessageByID(p.CarID, ctx.Raw)
+		}
+		return nil
+	})
+	RegisterHandler(r, "alightingMessage", carReporters, func(ctx *ConnContext, p *AlightingNotice) error {
+		if err := authorizeCar(ctx, p.CarID); err != nil {
+			return err
+		}
+		if ctx.Manager.countPassengers(ctx.Conn, p.CarID, 0, p.AlightingCount) {
+			ctx.Manager.SendMessageByID(p.CarID, ctx.Raw)
+		}
+		return nil
+	})
+	RegisterHandler(r, "update_sites", admins, func(ctx *ConnContext, p *SiteList) error {
+		return SaveSites(p.Sites)
+	})
+	RegisterHandler(r, "update_routes", admins, func(ctx *ConnContext, p *RouteList) error {
+		return updateRoutes(p.Routes)
+	})
+	RegisterHandler(r, "delete_route", admins, func(ctx *ConnContext, p *RouteList) error {
+		return deleteRoute(p.Routes[0].ID)
+	})
+
+	// 服务端发送给客户端的消息，只用于生成协议文档
+	RegisterServerMessage[ErrorReply](r, "error")
+	RegisterServerMessage[SiteMessage](r, "site")
+	RegisterServerMessage[RouteMessage](r, "route")
+	RegisterServerMessage[TopicSubscriptions](r, "subscriptions")
+	RegisterServerMessage[CallStatus](r, "call_status")
+	RegisterServerMessage[BoardingRejected](r, "boarding_rejected")
+	RegisterServerMessage[DisconnectEvent](r, EventDriverDisconnected)
+	RegisterServerMessage[DisconnectEvent](r, EventCarDisconnected)
+	RegisterServerMessage[struct {
+		Error string `json:"error"`
+	}](r, "replay_error")
+
+	describeBuiltinMessages(r)
+}
+
+// describeBuiltinMessages 内置消息类型在协议文档中的说明
+func describeBuiltinMessages(r *HandlerRegistry) {
+	for msgType, description := range map[string]string{
+		"connections":        "将连接绑定到 token 中的驾驶员，绑定后补发该驾驶员的离线消息",
+		"car_conn":           "将连接绑定到驾驶员当前班次的车辆，绑定后补发该车辆的离线消息",
+		"call_accept":        "驾驶员接受乘客呼叫，第一个接受的驾驶员生效",
+		"call_status":        "客户端发送时查询呼叫的送达情况；服务端在呼叫状态变化时推送给发起呼叫的乘客",
+		"ack":                "确认收到带 msg_id 的消息，未确认的消息会被重发",
+		"driver_gps":         "驾驶员上报位置",
+		"subscribe_gps":      "按线路或车辆订阅驾驶员位置，两者都省略时接收全部位置",
+		"unsubscribe_gps":    "取消驾驶员位置订阅",
+		"subscribe":          "订阅主题，服务端回复 subscriptions",
+		"unsubscribe":        "退订主题，服务端回复 subscriptions",
+		"replay":             "回放历史轨迹",
+		"vehicle_call":       "乘客呼叫车辆，服务端分配 call_id 后转发给在线驾驶员",
+		"payment_user_count": "车辆的付款人数，转发给绑定了该车牌的连接；驾驶员须先用 car_conn 绑定该车辆",
+		"boardingMessage":    "上车人数，计入载客量后转发给绑定了该车牌的连接；驾驶员须先用 car_conn 绑定该车辆",
+		"alightingMessage":   "下车人数，计入载客量后转发给绑定了该车牌的连接；驾驶员须先用 car_conn 绑定该车辆",
+		"update_sites":       "写入或更新站点",
+		"update_routes":      "保存线路",
+		"delete_route":       "停用 routes 中第一条线路",
+		"error":              "消息被拒绝或处理失败",
+		"site":               "连接建立时发送的全部站点",
+		"route":              "连接建立时发送的全部线路",
+		"subscriptions":      "连接当前订阅的全部主题，以及本次被拒绝的主题",
+		"boarding_rejected":  "车辆已满，上车人数未被记录",
+		"replay_error":       "轨迹回放失败",
+
+		EventDriverDisconnected: "驾驶员的连接已断开，发送给管理员",
+		EventCarDisconnected:    "车辆的连接已断开，发送给管理员",
+	} {
+		r.Describe(msgType, description)
+	}
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"encoding/json"
+	"login/config"
+	"testing"
+)
+
+// countingPassengers 记录收到的上下车人数
+type countingPassengers struct {
+	calls []string
+}
+
+func (p *countingPassengers) RecordPassengers(carID string, boarding, alighting int) (int, error) {
+	p.calls = append(p.calls, carID)
+	return boarding, nil
+}
+
+func TestCarMessagesRequireBoundCar(t *testing.T) {
+	driver := ClientIdentity{UserID: "d1", Role: config.RoleDriver, ClientType: ClientTypeDriver}
+	passenger := ClientIdentity{UserID: "p1", Role: config.RolePassenger, ClientType: ClientTypePassenger}
+	admin := ClientIdentity{UserID: "a1", Role: config.RoleAdmin, ClientType: ClientTypeAdmin}
+
+	tests := []struct {
+		name     string
+		identity ClientIdentity
+		bindCar  string // 发送前通过 car_conn 绑定的车辆
+		message  string
+		wantCode string // 为空表示应被接受
+	}{
+		{"bound driver boards", driver, "沪A1", `{"type":"boardingMessage","car_id":"沪A1","boardingCount":2}`, ""},
+		{"bound driver alights", driver, "沪A1", `{"type":"alightingMessage","car_id":"沪A1","alightingCount":1}`, ""},
+		{"admin reports any car", admin, "", `{"type":"boardingMessage","car_id":"沪A1","boardingCount":2}`, ""},
+		{"passenger", passenger, "", `{"type":"boardingMessage","car_id":"沪A1","boardingCount":2}`, ErrCodeForbidden},
+		{"unbound driver", driver, "", `{"type":"alightingMessage","car_id":"沪A1","alightingCount":1}`, ErrCodeForbidden},
+		{"driver of another car", driver, "沪B2", `{"type":"boardingMessage","car_id":"沪A1","boardingCount":2}`, ErrCodeForbidden},
+		{"payment from another car", driver, "沪B2", `{"type":"payment_user_count","car_id":"沪A1","count":3}`, ErrCodeForbidden},
+		{"payment from passenger", passenger, "", `{"type":"payment_user_count","car_id":"沪A1","count":3}`, ErrCodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm := NewWebSocketManager()
+			counter := &countingPassengers{}
+			wm.PassengerCounter = counter
+			// 沪A1 默认绑定在另一个连接上，转发不会进入离线队列（离线队列需要数据库）
+			receiver := registerIdle(t, wm, ClientIdentity{UserID: "car", Role: config.RoleDriver, ClientType: ClientTypeDriver})
+			bindForTest(wm, "沪A1", bindCar, receiver)
+			c := registerIdle(t, wm, tt.identity)
+			if tt.bindCar != "" {
+				bindForTest(wm, tt.bindCar, bindCar, c)
+			}
+
+			wm.handlers.Dispatch(&ConnContext{Conn: c.conn, Identity: tt.identity, Manager: wm, Raw: []byte(tt.message)})
+
+			if tt.wantCode == "" {
+				if len(counter.calls) != 1 || counter.calls[0] != "沪A1" {
+					t.Errorf("passengers recorded for %v, want [沪A1]", counter.calls)
+				}
+				return
+			}
+			if len(counter.calls) != 0 {
+				t.Errorf("rejected message changed occupancy of %v", counter.calls)
+			}
+			if len(c.send) != 1 {
+				t.Fatalf("got %d replies, want 1", len(c.send))
+			}
+			var reply ErrorReply
+			if err := json.Unmarshal(<-c.send, &reply); err != nil || reply.Code != tt.wantCode {
+				t.Errorf("reply = %+v (%v), want code %s", reply, err, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ID 绑定的类型
+const (
+	bindDriver = "driver" // connections 消息绑定的驾驶员编号
+	bindCar    = "car"    // car_conn 消息绑定的车牌号
+)
+
+// 连接断开事件类型
+const (
+	EventDriverDisconnected = "driver_disconnected"
+	EventCarDisconnected    = "car_disconnected"
+)
+
+// DisconnectEvent 绑定了驾驶员编号或车牌号的连接断开时产生的事件，推送给管理员客户端并通知 DisconnectListener
+type DisconnectEvent struct {
+	Type     string `json:"type"` // driver_disconnected 或 car_disconnected
+	DriverID string `json:"driver_id,omitempty" desc:"断开的驾驶员编号"`
+	CarID    string `json:"car_id,omitempty" desc:"断开的车牌号"`
+	UserID   string `json:"user_id" desc:"连接的 token 身份"`
+	Time     string `json:"time" desc:"断开时间"`
+}
+
+// DisconnectListener 接收连接断开事件，供其他模块在驾驶员或车辆掉线时做出处理
+type DisconnectListener interface {
+	ConnectionClosed(event DisconnectEvent)
+}
+
+// AddDisconnectListener 添加连接断开事件的监听者
+func (wm *WebSocketManager) AddDisconnectListener(listener DisconnectListener) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.disconnectListeners = append(wm.disconnectListeners, listener)
+}
+
+// bind 将 ID（驾驶员编号或车牌号）绑定到连接，供 SendMessageByID 使用，并补发该 ID 未连接期间的离线消息
+// 同一 ID 再次绑定时以新连接为准，旧连接断开时不再产生断开事件
+func (wm *WebSocketManager) bind(ID, kind string, conn *websocket.Conn) {
+	unlock := wm.offline.lock(ID)
+	defer unlock()
+
+	wm.mu.Lock()
+	if previous, exists := wm.connections[ID]; exists && previous != conn {
+		if c, ok := wm.clients[previous]; ok {
+			delete(c.bound, ID)
+		}
+	}
+	wm.connections[ID] = conn
+	c, ok := wm.clients[conn]
+	if ok {
+		c.bound[ID] = kind
+	}
+	wm.mu.Unlock()
+
+	if ok {
+		wm.flushOffline(ID, c)
+	}
+}
+
+// boundTo 判断 ID 当前是否以 kind 类型绑定在该连接上
+func (wm *WebSocketManager) boundTo(conn *websocket.Conn, ID, kind string) bool {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	c, ok := wm.clients[conn]
+	return ok && wm.connections[ID] == conn && c.bound[ID] == kind
+}
+
+// shiftCar 查询驾驶员当前未结束班次的车牌号，没有在班班次时返回空字符串
+// car_conn 只能绑定该车辆，防止驾驶员冒领其他车辆的消息与离线队列
+var shiftCar = func(driverID string) (string, error) {
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT car_id FROM work_table WHERE driver_id = ? AND work_etime IS NULL ORDER BY work_stime DESC LIMIT 1", driverID)
+	if err != nil {
+		return "", err
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return "", fmt.Errorf("数据库返回结果格式错误")
+	}
+	defer rows.Close()
+	var carID string
+	if rows.Next() {
+		if err := rows.Scan(&carID); err != nil {
+			return "", err
+		}
+	}
+	return carID, rows.Err()
+}
+
+// unbindAll 解除连接上的所有 ID 绑定，返回对应的断开事件，调用方需持有 mu
+func (wm *WebSocketManager) unbindAll(c *client, now time.Time) []DisconnectEvent {
+	events := make([]DisconnectEvent, 0, len(c.bound))
+	for ID, kind := range c.bound {
+		if wm.connections[ID] != c.conn {
+			continue
+		}
+		delete(wm.connections, ID)
+		event := DisconnectEvent{UserID: c.identity.UserID, Time: now.Format("2006-01-02 15:04:05")}
+		if kind == bindCar {
+			event.Type = EventCarDisconnected
+			event.CarID = ID
+		} else {
+			event.Type = EventDriverDisconnected
+			event.DriverID = ID
+		}
+		events = append(events, event)
+	}
+	c.bound = make(map[string]string)
+	return events
+}
+
+// publishDisconnects 将断开事件推送给管理员客户端并通知所有监听者
+func (wm *WebSocketManager) publishDisconnects(events []DisconnectEvent) {
+	if len(events) == 0 {
+		return
+	}
+	wm.mu.Lock()
+	listeners := append([]DisconnectListener(nil), wm.disconnectListeners...)
+	wm.mu.Unlock()
+
+	for _, event := range events {
+		log_service.WebSocketLogger.Printf("%s 驾驶员 %s 车辆 %s 的连接已断开\n", event.Time, event.DriverID, event.CarID)
+		if data, err := json.Marshal(event); err == nil {
+			wm.SendMessageToClients(data, ClientTypeAdmin)
+		}
+		for _, listener := range listeners {
+			listener.ConnectionClosed(event)
+		}
+	}
+}
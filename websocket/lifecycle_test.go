@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"encoding/json"
+	"login/config"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestKeepaliveConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    config.WebSocketConfig
+		wantPing  int
+		wantPong  int
+		wantBytes int64
+	}{
+		{"defaults", config.WebSocketConfig{}, 54, 60, 1 << 20},
+		{"explicit", config.WebSocketConfig{PingIntervalSeconds: 20, PongTimeoutSeconds: 30, MaxMessageBytes: 4096}, 20, 30, 4096},
+		{"ping not before pong timeout", config.WebSocketConfig{PingIntervalSeconds: 30, PongTimeoutSeconds: 30}, 27, 30, 1 << 20},
+		{"short pong timeout", config.WebSocketConfig{PongTimeoutSeconds: 1}, 1, 1, 1 << 20},
+	}
+	for _, tt := range tests {
+		setWebSocketConfig(t, func(c *config.WebSocketConfig) { *c = tt.config })
+		c := wsConfig()
+		if c.PingIntervalSeconds != tt.wantPing || c.PongTimeoutSeconds != tt.wantPong || c.MaxMessageBytes != tt.wantBytes {
+			t.Errorf("%s: ping %d pong %d max %d, want %d %d %d", tt.name,
+				c.PingIntervalSeconds, c.PongTimeoutSeconds, c.MaxMessageBytes, tt.wantPing, tt.wantPong, tt.wantBytes)
+		}
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	setWebSocketConfig(t, func(c *config.WebSocketConfig) {
+		c.PongTimeoutSeconds = 1
+		c.MaxMessageBytes = 16
+	})
+
+	// 客户端不读取消息就不会回复 pong，读超时后 ReadMessage 返回错误
+	server, _ := testConnPair(t)
+	c := newClient(server, ClientIdentity{UserID: "idle"})
+	c.prepareRead()
+	start := time.Now()
+	if _, _, err := server.ReadMessage(); err == nil {
+		t.Fatal("read from a silent client succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("read deadline fired after %v", elapsed)
+	}
+
+	// 超过 max_message_bytes 的消息使读取失败
+	server, remote := testConnPair(t)
+	c = newClient(server, ClientIdentity{UserID: "big"})
+	c.prepareRead()
+	if err := remote.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 64))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.ReadMessage(); err != websocket.ErrReadLimit {
+		t.Errorf("oversized message read error = %v, want %v", err, websocket.ErrReadLimit)
+	}
+}
+
+func TestUnbindAll(t *testing.T) {
+	wm := NewWebSocketManager()
+	c := registerIdle(t, wm, ClientIdentity{UserID: "u1", ClientType: ClientTypeDriver})
+	other := registerIdle(t, wm, ClientIdentity{UserID: "u2", ClientType: ClientTypeDriver})
+	bindForTest(wm, "d1", bindDriver, c)
+	bindForTest(wm, "粤A12345", bindCar, c)
+	bindForTest(wm, "d2", bindDriver, c)
+	// d2 已重新绑定到另一条连接，旧连接断开时不再产生事件
+	bindForTest(wm, "d2", bindDriver, other)
+
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)
+	wm.mu.Lock()
+	events := wm.unbindAll(c, now)
+	wm.mu.Unlock()
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Type < events[j].Type })
+	want := []DisconnectEvent{
+		{Type: EventCarDisconnected, CarID: "粤A12345", UserID: "u1", Time: "2024-05-01 08:30:00"},
+		{Type: EventDriverDisconnected, DriverID: "d1", UserID: "u1", Time: "2024-05-01 08:30:00"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if len(c.bound) != 0 {
+		t.Errorf("bindings left on the connection: %v", c.bound)
+	}
+	if _, ok := wm.connections["d1"]; ok {
+		t.Error("d1 still bound")
+	}
+	if wm.connections["d2"] != other.conn {
+		t.Error("rebound d2 was unbound from the new connection")
+	}
+}
+
+// recordingListener 记录收到的断开事件
+type recordingListener struct {
+	mu     sync.Mutex
+	events []DisconnectEvent
+}
+
+func (l *recordingListener) ConnectionClosed(event DisconnectEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func TestPublishDisconnects(t *testing.T) {
+	wm := NewWebSocketManager()
+	listener := &recordingListener{}
+	wm.AddDisconnectListener(listener)
+	admin := registerIdle(t, wm, ClientIdentity{UserID: "a", ClientType: ClientTypeAdmin})
+	passenger := registerIdle(t, wm, ClientIdentity{UserID: "p", ClientType: ClientTypePassenger})
+
+	wm.publishDisconnects(nil)
+	if len(admin.send) != 0 || len(listener.events) != 0 {
+		t.Fatal("empty event list was published")
+	}
+
+	event := DisconnectEvent{Type: EventDriverDisconnected, DriverID: "d1", UserID: "u1", Time: "2024-05-01 08:30:00"}
+	wm.publishDisconnects([]DisconnectEvent{event})
+
+	if !reflect.DeepEqual(listener.events, []DisconnectEvent{event}) {
+		t.Errorf("listener got %+v", listener.events)
+	}
+	if len(admin.send) != 1 {
+		t.Fatalf("admin got %d messages, want 1", len(admin.send))
+	}
+	var got DisconnectEvent
+	if err := json.Unmarshal(<-admin.send, &got); err != nil || got != event {
+		t.Errorf("admin got %+v (%v), want %+v", got, err, event)
+	}
+	if len(passenger.send) != 0 {
+		t.Error("passenger received a disconnect event")
+	}
+}
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login/log_service"
+
+	"github.com/gorilla/websocket"
+)
+
+// PassengerCounter 根据上下车人数维护车辆的实时载客量
+type PassengerCounter interface {
+	RecordPassengers(carID string, boarding, alighting int) (occupancy int, err error)
+}
+
+// CapacityError 上车后将超过车辆载客量时返回的错误
+type CapacityError struct {
+	CarID     string // 车牌号
+	Occupancy int    // 当前载客量
+	Capacity  int    // 车辆载客量
+	Requested int    // 本次申请上车的人数
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("车辆 %s 载客 %d/%d，无法再上车 %d 人", e.CarID, e.Occupancy, e.Capacity, e.Requested)
+}
+
+// BoardingRejected 上车人数超过载客量时回复给发送方的消息
+type BoardingRejected struct {
+	Type      string `json:"type"` // 固定为 "boarding_rejected"
+	CarID     string `json:"car_id" desc:"车牌号"`
+	Requested int    `json:"requested" desc:"申请上车的人数"`
+	Occupancy int    `json:"occupancy" desc:"当前载客量"`
+	Capacity  int    `json:"capacity" desc:"车辆载客量"`
+	Available int    `json:"available" desc:"剩余座位"`
+}
+
+// countPassengers 处理 boardingMessage / alightingMessage：更新载客量，成功时返回 true 并由调用方转发给车辆
+// 上车超过载客量时拒绝本次上车并回复发送方
+func (wm *WebSocketManager) countPassengers(conn *websocket.Conn, carID string, boarding, alighting int) bool {
+	if wm.PassengerCounter == nil {
+		return true
+	}
+
+	occupancy, err := wm.PassengerCounter.RecordPassengers(carID, boarding, alighting)
+	var capacityErr *CapacityError
+	if errors.As(err, &capacityErr) {
+		log_service.WebSocketLogger.Printf("拒绝上车：%v\n", capacityErr)
+		rejected, _ := json.Marshal(BoardingRejected{
+			Type:      "boarding_rejected",
+			CarID:     capacityErr.CarID,
+			Requested: capacityErr.Requested,
+			Occupancy: capacityErr.Occupancy,
+			Capacity:  capacityErr.Capacity,
+			Available: capacityErr.Capacity - capacityErr.Occupancy,
+		})
+		wm.send(conn, rejected)
+		return false
+	}
+	if err != nil {
+		// 记录失败不影响消息转发
+		log_service.WebSocketLogger.Printf("更新车辆 %s 载客量失败：%v\n", carID, err)
+		return true
+	}
+
+	log_service.WebSocketLogger.Printf("车辆 %s 上车 %d 人，下车 %d 人，当前载客 %d 人\n", carID, boarding, alighting, occupancy)
+	return true
+}
@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"login/config"
+	"login/db"
+	"login/log_service"
+	"sync"
+	"time"
+)
+
+// 过期离线消息的清理间隔，清理在每秒一次的重发检查中进行
+const offlinePurgeInterval = time.Minute
+
+// offlineQueue 发给未连接的驾驶员或车辆的消息，保存在 offline_message_table 中（表结构见 migrations/005_offline_message_table.sql）
+// 驾驶员或车辆通过 connections / car_conn 重新绑定时按发送顺序补发，超过 offline_ttl_seconds 的消息不再补发
+// 同一 ID 的补发与新消息通过该 ID 的锁保证不会交错，不同 ID 的发送互不等待
+type offlineQueue struct {
+	mu       sync.Mutex // 保护 locks 与 purgedAt
+	locks    map[string]*recipientLock
+	purgedAt time.Time
+}
+
+// recipientLock 一个接收者的锁，没有调用方持有或等待时从 offlineQueue.locks 中移除
+type recipientLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock 锁定一个接收者，返回解锁函数；SendMessageByID 与绑定后的补发都在持有该锁时进行
+func (q *offlineQueue) lock(ID string) func() {
+	q.mu.Lock()
+	if q.locks == nil {
+		q.locks = make(map[string]*recipientLock)
+	}
+	l, exists := q.locks[ID]
+	if !exists {
+		l = &recipientLock{}
+		q.locks[ID] = l
+	}
+	l.refs++
+	q.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		q.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(q.locks, ID)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// offlineMessage 一条待补发的离线消息
+type offlineMessage struct {
+	id      int64
+	message []byte
+}
+
+// save 保存一条离线消息，每个接收者只保留最近的 offline_queue_size 条，调用方需持有该接收者的锁
+func (q *offlineQueue) save(ID string, message []byte, now time.Time) {
+	cfg := wsConfig()
+
+	_, err := db.ExecuteSQL(config.RoleDriver,
+		"INSERT INTO offline_message_table (recipient_id, message, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		ID, string(message), now.Format("2006-01-02 15:04:05"),
+		now.Add(time.Duration(cfg.OfflineTTLSeconds)*time.Second).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log_service.WebSocketLogger.Printf("保存发给 %s 的离线消息失败，消息被丢弃：%v\n", ID, err)
+		return
+	}
+	log_service.WebSocketLogger.Printf("%s 当前未连接，消息已离线保存\n", ID)
+
+	// 超出数量上限的最早的消息被丢弃，保证补发时不会塞满发送队列
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT message_id FROM offline_message_table WHERE recipient_id = ? ORDER BY message_id DESC LIMIT 1 OFFSET ?",
+		ID, cfg.OfflineQueueSize)
+	if err != nil {
+		return
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return
+	}
+	var oldest int64
+	if rows.Next() {
+		rows.Scan(&oldest)
+	}
+	rows.Close()
+	if oldest > 0 {
+		log_service.WebSocketLogger.Printf("%s 的离线消息超过 %d 条，丢弃最早的消息\n", ID, cfg.OfflineQueueSize)
+		q.remove(ID, oldest)
+	}
+}
+
+// load 读取某个接收者未过期的离线消息，按保存顺序排列
+func (q *offlineQueue) load(ID string, now time.Time) ([]offlineMessage, error) {
+
+	result, err := db.ExecuteSQL(config.RoleDriver,
+		"SELECT message_id, message FROM offline_message_table WHERE recipient_id = ? AND expires_at >= ? ORDER BY message_id LIMIT ?",
+		ID, now.Format("2006-01-02 15:04:05"), wsConfig().OfflineQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	rows, ok := result.(*sql.Rows)
+	if !ok {
+		return nil, fmt.Errorf("数据库返回结果格式错误")
+	}
+	defer rows.Close()
+
+	var messages []offlineMessage
+	for rows.Next() {
+		var m offlineMessage
+		var message string
+		if err := rows.Scan(&m.id, &message); err != nil {
+			return nil, err
+		}
+		m.message = []byte(message)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// remove 删除某个接收者编号不大于 upTo 的离线消息
+func (q *offlineQueue) remove(ID string, upTo int64) {
+	if _, err := db.ExecuteSQL(config.RoleDriver,
+		"DELETE FROM offline_message_table WHERE recipient_id = ? AND message_id <= ?", ID, upTo); err != nil {
+		log_service.WebSocketLogger.Printf("删除 %s 的离线消息失败：%v\n", ID, err)
+	}
+}
+
+// removeMessage 删除一条已被客户端确认的离线消息
+func (q *offlineQueue) removeMessage(messageID int64) {
+	if _, err := db.ExecuteSQL(config.RoleDriver,
+		"DELETE FROM offline_message_table WHERE message_id = ?", messageID); err != nil {
+		log_service.WebSocketLogger.Printf("删除离线消息 %d 失败：%v\n", messageID, err)
+	}
+}
+
+// purgeExpired 删除所有已过期的离线消息，距上次清理不足 offlinePurgeInterval 时跳过
+func (q *offlineQueue) purgeExpired(now time.Time) {
+	q.mu.Lock()
+	if now.Sub(q.purgedAt) < offlinePurgeInterval {
+		q.mu.Unlock()
+		return
+	}
+	q.purgedAt = now
+	q.mu.Unlock()
+
+	if _, err := db.ExecuteSQL(config.RoleDriver,
+		"DELETE FROM offline_message_table WHERE expires_at < ?", now.Format("2006-01-02 15:04:05")); err != nil {
+		log_service.WebSocketLogger.Printf("清理过期的离线消息失败：%v\n", err)
+	}
+}
+
+// flushOffline 将 ID 的离线消息按顺序可靠补发给客户端，客户端确认（ack）后才从表中删除，调用方需持有该 ID 的锁
+// 连接在确认前断开时消息留在表中，下次绑定时以相同的 msg_id 再次补发，客户端按 msg_id 去重
+func (wm *WebSocketManager) flushOffline(ID string, c *client) {
+	messages, err := wm.offline.load(ID, time.Now())
+	if err != nil {
+		log_service.WebSocketLogger.Printf("读取 %s 的离线消息失败：%v\n", ID, err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	for _, m := range messages {
+		messageID := m.id
+		msgID := messageIDOf(m.message)
+		if msgID == "" {
+			// 不是 JSON 对象的消息无法确认，放入发送队列后即删除
+			if wm.deliver(c, m.message) {
+				wm.offline.removeMessage(messageID)
+			}
+			continue
+		}
+		wm.sendReliable(c, msgID, m.message, func() { wm.offline.removeMessage(messageID) }, nil)
+	}
+	log_service.WebSocketLogger.Printf("已向 %s 补发 %d 条离线消息，客户端确认后删除\n", ID, len(messages))
+}
+
+// messageIDOf 返回 JSON 对象消息中的 msg_id，不是 JSON 对象或没有 msg_id 时返回空字符串
+func messageIDOf(message []byte) string {
+	var envelope struct {
+		MsgID string `json:"msg_id"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return ""
+	}
+	return envelope.MsgID
+}
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"login/config"
+	"testing"
+	"time"
+)
+
+func TestOfflineConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    config.WebSocketConfig
+		wantTTL   int
+		wantQueue int
+	}{
+		{"defaults", config.WebSocketConfig{}, 3600, 128},
+		{"explicit", config.WebSocketConfig{OfflineTTLSeconds: 600, OfflineQueueSize: 20}, 600, 20},
+		{"half of the send queue", config.WebSocketConfig{SendQueueSize: 10}, 3600, 5},
+		{"not larger than the send queue", config.WebSocketConfig{SendQueueSize: 10, OfflineQueueSize: 50}, 3600, 5},
+	}
+	for _, tt := range tests {
+		setWebSocketConfig(t, func(c *config.WebSocketConfig) { *c = tt.config })
+		if c := wsConfig(); c.OfflineTTLSeconds != tt.wantTTL || c.OfflineQueueSize != tt.wantQueue {
+			t.Errorf("%s: ttl %d queue %d, want %d %d", tt.name, c.OfflineTTLSeconds, c.OfflineQueueSize, tt.wantTTL, tt.wantQueue)
+		}
+	}
+}
+
+func TestMessageIDOf(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{`{"type":"vehicle_call","msg_id":"c1"}`, "c1"},
+		{`{"type":"payment_user_count"}`, ""},
+		{`[1,2]`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := messageIDOf([]byte(tt.message)); got != tt.want {
+			t.Errorf("messageIDOf(%s) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestOfflineRecipientLock(t *testing.T) {
+	q := &offlineQueue{}
+	unlock := q.lock("沪A1")
+
+	// 其他接收者不需要等待
+	other := make(chan struct{})
+	go func() {
+		q.lock("沪B2")()
+		close(other)
+	}()
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another recipient waited")
+	}
+
+	// 同一接收者等待前一个调用方解锁
+	same := make(chan struct{})
+	go func() {
+		q.lock("沪A1")()
+		close(same)
+	}()
+	select {
+	case <-same:
+		t.Fatal("second lock of the same recipient did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-same:
+	case <-time.After(time.Second):
+		t.Fatal("waiting lock was not released")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.locks) != 0 {
+		t.Errorf("locks left after release: %v", q.locks)
+	}
+}
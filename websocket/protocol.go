@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProtocolMessage 协议文档中的一种消息
+type ProtocolMessage struct {
+	Type        string   `json:"type"`                   // 消息类型
+	Description string   `json:"description,omitempty"`  // 说明
+	ClientTypes []string `json:"client_types,omitempty"` // 允许发送的客户端类型，为空表示所有已认证的客户端
+	Schema      *Schema  `json:"schema"`                 // 消息的 JSON Schema
+}
+
+// ProtocolDocument WebSocket 协议文档，前端可以据此校验收发的消息
+type ProtocolDocument struct {
+	V              int               `json:"v"`               // 协议版本
+	ClientMessages []ProtocolMessage `json:"client_messages"` // 客户端发送给服务端的消息
+	ServerMessages []ProtocolMessage `json:"server_messages"` // 服务端发送给客户端的消息
+}
+
+// Protocol 按已注册的处理函数与服务端消息生成协议文档，消息按类型排序
+func (r *HandlerRegistry) Protocol() ProtocolDocument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	doc := ProtocolDocument{V: ProtocolVersion}
+	for msgType, h := range r.handlers {
+		doc.ClientMessages = append(doc.ClientMessages, ProtocolMessage{
+			Type:        msgType,
+			Description: r.descriptions[msgType],
+			ClientTypes: h.clientTypes,
+			Schema:      h.schema,
+		})
+	}
+	for msgType, schema := range r.serverTypes {
+		doc.ServerMessages = append(doc.ServerMessages, ProtocolMessage{
+			Type:        msgType,
+			Description: r.descriptions[msgType],
+			Schema:      schema,
+		})
+	}
+	sort.Slice(doc.ClientMessages, func(i, j int) bool { return doc.ClientMessages[i].Type < doc.ClientMessages[j].Type })
+	sort.Slice(doc.ServerMessages, func(i, j int) bool { return doc.ServerMessages[i].Type < doc.ServerMessages[j].Type })
+	return doc
+}
+
+// Markdown 生成协议文档的 Markdown 版本，每种消息列出字段、类型与约束
+func (doc ProtocolDocument) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# WebSocket 协议（v%d）\n\n", doc.V)
+	b.WriteString("> 本文件由 `go run . -export-ws-schema websocket` 生成，请勿手动修改。完整的 JSON Schema 见 `protocol.json`，服务运行时也可以通过 `GET /ws/schema` 获取。\n\n")
+	b.WriteString("- 每条消息都是 JSON 对象，`type` 为消息类型，`v` 为协议版本（省略时按 1 处理，服务端不支持的版本返回 `unsupported_version` 错误）。\n")
+	b.WriteString("- 未列出的字段会被忽略；值为 `null` 的字段视为未提供。\n")
+	b.WriteString("- 不符合 schema 的消息不会被处理，发送方收到 `code` 为 `invalid_payload` 的 `error` 消息，`details` 中逐项列出出错字段（JSON Pointer）与原因。\n\n")
+
+	b.WriteString("## 客户端发送的消息\n\n")
+	for _, m := range doc.ClientMessages {
+		writeMessage(&b, m, true)
+	}
+	b.WriteString("## 服务端发送的消息\n\n")
+	for _, m := range doc.ServerMessages {
+		writeMessage(&b, m, false)
+	}
+	return b.String()
+}
+
+// writeMessage 写出一种消息的说明与字段表
+func writeMessage(b *strings.Builder, m ProtocolMessage, fromClient bool) {
+	fmt.Fprintf(b, "### `%s`\n\n", m.Type)
+	if m.Description != "" {
+		fmt.Fprintf(b, "%s\n\n", m.Description)
+	}
+	if fromClient {
+		if len(m.ClientTypes) == 0 {
+			b.WriteString("允许发送：所有客户端\n\n")
+		} else {
+			fmt.Fprintf(b, "允许发送：%s\n\n", strings.Join(m.ClientTypes, "、"))
+		}
+	}
+	b.WriteString("| 字段 | 类型 | 必填 | 约束 | 说明 |\n|---|---|---|---|---|\n")
+	writeFields(b, m.Schema, "")
+	b.WriteString("\n")
+}
+
+// writeFields 按字段名顺序写出对象的字段，嵌套对象与数组元素的字段以 a.b、a[].b 的形式展开
+func writeFields(b *strings.Builder, s *Schema, prefix string) {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// type 与 v 排在最前
+		rank := func(n string) int {
+			switch n {
+			case "type":
+				return 0
+			case "v":
+				return 1
+			}
+			return 2
+		}
+		if rank(names[i]) != rank(names[j]) {
+			return rank(names[i]) < rank(names[j])
+		}
+		return names[i] < names[j]
+	})
+	required := make(map[string]bool)
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	for _, name := range names {
+		fs := s.Properties[name]
+		path := prefix + name
+		requiredMark := ""
+		if required[name] {
+			requiredMark = "是"
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %s | %s | %s |\n", path, typeName(fs), requiredMark, constraints(fs), fs.Description)
+
+		switch {
+		case fs.Type == "object" && len(fs.Properties) > 0:
+			writeFields(b, fs, path+".")
+		case fs.Type == "array" && fs.Items != nil && fs.Items.Type == "object" && len(fs.Items.Properties) > 0:
+			writeFields(b, fs.Items, path+"[].")
+		}
+	}
+}
+
+// typeName 字段类型的简短写法，例如 integer[]、object<string, string>
+func typeName(s *Schema) string {
+	switch s.Type {
+	case "":
+		return "any"
+	case "array":
+		if s.Items != nil {
+			return typeName(s.Items) + "[]"
+		}
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "object<string, " + typeName(s.AdditionalProperties) + ">"
+		}
+	}
+	return s.Type
+}
+
+// constraints 字段约束的文字说明
+func constraints(s *Schema) string {
+	var items []string
+	if s.Const != nil {
+		items = append(items, fmt.Sprintf("固定为 `%v`", s.Const))
+	}
+	if len(s.Enum) > 0 {
+		items = append(items, "取值 `"+strings.Join(s.Enum, "` / `")+"`")
+	}
+	if s.MinLength != nil {
+		items = append(items, fmt.Sprintf("长度 ≥ %d", *s.MinLength))
+	}
+	if s.MinItems != nil {
+		items = append(items, fmt.Sprintf("元素数 ≥ %d", *s.MinItems))
+	}
+	if s.Minimum != nil {
+		items = append(items, fmt.Sprintf("≥ %v", *s.Minimum))
+	}
+	if s.Maximum != nil {
+		items = append(items, fmt.Sprintf("≤ %v", *s.Maximum))
+	}
+	return strings.Join(items, "，")
+}
+
+// HandleSchema 返回 JSON 格式的协议文档
+func (api *WebSocketAPI) HandleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(api.manager.handlers.Protocol())
+}
+
+// ExportProtocol 将协议文档写入 dir 目录下的 protocol.json 与 protocol.markdown
+func (api *WebSocketAPI) ExportProtocol(dir string) error {
+	doc := api.manager.handlers.Protocol()
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "protocol.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "protocol.markdown"), []byte(doc.Markdown()), 0644)
+}
@@ -0,0 +1,241 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login/log_service"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// 错误回复中的错误码
+const (
+	ErrCodeInvalidMessage     = "invalid_message"     // 消息不是合法的 JSON 或缺少 type
+	ErrCodeUnsupportedVersion = "unsupported_version" // 服务端不支持消息的协议版本 v
+	ErrCodeUnknownType        = "unknown_type"        // 没有注册该消息类型的处理函数
+	ErrCodeForbidden          = "forbidden"           // 客户端类型或身份无权发送该消息
+	ErrCodeInvalidPayload     = "invalid_payload"     // 消息内容不符合 schema 或校验失败
+	ErrCodeHandlerFailed      = "handler_failed"      // 处理函数返回错误
+)
+
+// ProtocolVersion 当前的 WebSocket 协议版本，客户端消息的 v 字段省略时按该版本处理
+const ProtocolVersion = 1
+
+// ErrorReply 消息被拒绝或处理失败时回复给发送方的消息
+type ErrorReply struct {
+	Type        string            `json:"type"` // 固定为 "error"
+	V           int               `json:"v" desc:"服务端的协议版本"`
+	MessageType string            `json:"message_type" desc:"出错的消息类型"`
+	Code        string            `json:"code" jsonschema:"enum=invalid_message|unsupported_version|unknown_type|forbidden|invalid_payload|handler_failed|call_not_found|call_taken" desc:"错误码"`
+	Error       string            `json:"error" desc:"错误描述"`
+	Details     []SchemaViolation `json:"details,omitempty" desc:"消息不符合 schema 时的逐项错误"`
+}
+
+// MessageError 处理函数返回的带错误码的错误，其他错误按 handler_failed 回复
+type MessageError struct {
+	Code string
+	Err  error
+}
+
+func (e *MessageError) Error() string {
+	return e.Err.Error()
+}
+
+// Forbidden 返回 forbidden 错误，用于处理函数拒绝与连接身份不符的消息
+func Forbidden(format string, args ...interface{}) error {
+	return &MessageError{Code: ErrCodeForbidden, Err: fmt.Errorf(format, args...)}
+}
+
+// Validator 由消息内容实现，解析后自动调用
+type Validator interface {
+	Validate() error
+}
+
+// ConnContext 处理函数收到的连接上下文
+type ConnContext struct {
+	Conn     *websocket.Conn
+	Identity ClientIdentity    // 握手时由 token 确定的身份
+	Manager  *WebSocketManager // 用于发送、广播和发布消息
+	Type     string            // 消息类型
+	Raw      []byte            // 原始消息，转发时使用
+}
+
+// Reply 向发送方回复一条 JSON 消息
+func (ctx *ConnContext) Reply(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !ctx.Manager.send(ctx.Conn, data) {
+		return errors.New("客户端已断开或发送队列已满")
+	}
+	return nil
+}
+
+// ReplyError 向发送方回复错误消息
+func (ctx *ConnContext) ReplyError(code string, err error) {
+	log_service.WebSocketLogger.Printf("拒绝用户 %s（%s）的消息 %s：%s %v\n", ctx.Identity.UserID, ctx.Identity.ClientType, ctx.Type, code, err)
+	reply := ErrorReply{Type: "error", V: ProtocolVersion, MessageType: ctx.Type, Code: code, Error: err.Error()}
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		reply.Details = schemaErr.Violations
+	}
+	if err := ctx.Reply(reply); err != nil {
+		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+	}
+}
+
+// messageHandler 注册的处理函数，decode 负责按 schema 校验并解析消息内容
+type messageHandler struct {
+	clientTypes []string
+	schema      *Schema
+	decode      func(raw []byte) (interface{}, error)
+	handle      func(ctx *ConnContext, payload interface{}) error
+}
+
+// HandlerRegistry 消息类型到处理函数的注册表，同时记录服务端发送的消息类型，用于生成协议文档
+type HandlerRegistry struct {
+	mu           sync.RWMutex
+	handlers     map[string]messageHandler
+	serverTypes  map[string]*Schema // 服务端发送的消息类型及其 Schema
+	descriptions map[string]string  // 消息类型的说明
+}
+
+// NewHandlerRegistry 创建空的注册表
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers:     make(map[string]messageHandler),
+		serverTypes:  make(map[string]*Schema),
+		descriptions: make(map[string]string),
+	}
+}
+
+// RegisterHandler 为消息类型注册处理函数，消息先按 T 生成的 schema 校验，再解析为 T，T 实现 Validator 时再校验
+// clientTypes 为空时所有已认证的连接都可以发送，否则只允许列出的客户端类型；重复注册时覆盖原处理函数
+func RegisterHandler[T any](r *HandlerRegistry, msgType string, clientTypes []string, handle func(ctx *ConnContext, payload *T) error) {
+	schema := messageSchema(msgType, reflect.TypeOf((*T)(nil)).Elem(), true)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[msgType] = messageHandler{
+		clientTypes: clientTypes,
+		schema:      schema,
+		decode: func(raw []byte) (interface{}, error) {
+			var document interface{}
+			if err := json.Unmarshal(raw, &document); err != nil {
+				return nil, err
+			}
+			if violations := schema.Validate(document); len(violations) > 0 {
+				return nil, &SchemaError{Violations: violations}
+			}
+			payload := new(T)
+			if err := json.Unmarshal(raw, payload); err != nil {
+				return nil, err
+			}
+			if v, ok := interface{}(payload).(Validator); ok {
+				if err := v.Validate(); err != nil {
+					return nil, err
+				}
+			}
+			return payload, nil
+		},
+		handle: func(ctx *ConnContext, payload interface{}) error {
+			return handle(ctx, payload.(*T))
+		},
+	}
+}
+
+// RegisterServerMessage 登记服务端发送给客户端的消息类型，消息内容为 T，只用于生成协议文档
+func RegisterServerMessage[T any](r *HandlerRegistry, msgType string) {
+	schema := messageSchema(msgType, reflect.TypeOf((*T)(nil)).Elem(), false)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serverTypes[msgType] = schema
+}
+
+// Describe 设置消息类型在协议文档中的说明
+func (r *HandlerRegistry) Describe(msgType, description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.descriptions[msgType] = description
+}
+
+// Types 返回已注册的消息类型
+func (r *HandlerRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for msgType := range r.handlers {
+		types = append(types, msgType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// lookup 查找消息类型的处理函数
+func (r *HandlerRegistry) lookup(msgType string) (messageHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[msgType]
+	return h, ok
+}
+
+// Dispatch 解析一条消息并交给对应的处理函数，出错时向发送方回复 ErrorReply
+func (r *HandlerRegistry) Dispatch(ctx *ConnContext) {
+	var envelope struct {
+		Type string      `json:"type"`
+		V    interface{} `json:"v"`
+	}
+	if err := json.Unmarshal(ctx.Raw, &envelope); err != nil || envelope.Type == "" {
+		if err == nil {
+			err = errors.New("缺少 type 字段")
+		}
+		ctx.ReplyError(ErrCodeInvalidMessage, err)
+		return
+	}
+	ctx.Type = envelope.Type
+	// 省略 v 的旧版客户端按当前版本处理，v 的类型错误由 schema 校验报告
+	if v, ok := envelope.V.(float64); ok && v != ProtocolVersion {
+		ctx.ReplyError(ErrCodeUnsupportedVersion, fmt.Errorf("不支持协议版本 %v，服务端版本为 %d", v, ProtocolVersion))
+		return
+	}
+
+	h, ok := r.lookup(envelope.Type)
+	if !ok {
+		ctx.ReplyError(ErrCodeUnknownType, fmt.Errorf("未知消息类型：%s", envelope.Type))
+		return
+	}
+	if !clientTypeAllowed(h.clientTypes, ctx.Identity.ClientType) {
+		ctx.ReplyError(ErrCodeForbidden, fmt.Errorf("%s 客户端无权发送 %s", ctx.Identity.ClientType, envelope.Type))
+		return
+	}
+	payload, err := h.decode(ctx.Raw)
+	if err != nil {
+		ctx.ReplyError(ErrCodeInvalidPayload, err)
+		return
+	}
+	if err := h.handle(ctx, payload); err != nil {
+		var msgErr *MessageError
+		if errors.As(err, &msgErr) {
+			ctx.ReplyError(msgErr.Code, msgErr.Err)
+		} else {
+			ctx.ReplyError(ErrCodeHandlerFailed, err)
+		}
+	}
+}
+
+// clientTypeAllowed 判断客户端类型是否在允许列表中，列表为空表示不限制
+func clientTypeAllowed(allowed []string, clientType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, t := range allowed {
+		if t == clientType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"login/config"
+	"reflect"
+	"testing"
+)
+
+type registryTestPayload struct {
+	CarID string `json:"car_id" jsonschema:"required,minLength=1"`
+	Count int    `json:"count" jsonschema:"minimum=0"`
+}
+
+// Validate 在 schema 之外的业务校验
+func (p *registryTestPayload) Validate() error {
+	if p.CarID == "invalid" {
+		return errors.New("车牌号无效")
+	}
+	return nil
+}
+
+func TestDispatchErrorCodes(t *testing.T) {
+	r := NewHandlerRegistry()
+	var handled []string
+	RegisterHandler(r, "drive", []string{ClientTypeDriver}, func(ctx *ConnContext, p *registryTestPayload) error {
+		switch p.CarID {
+		case "other":
+			return Forbidden("不能代替其他车辆发送：%s", p.CarID)
+		case "broken":
+			return errors.New("处理失败")
+		}
+		handled = append(handled, p.CarID)
+		return nil
+	})
+	RegisterHandler(r, "ping", nil, func(ctx *ConnContext, p *struct{}) error {
+		handled = append(handled, "ping")
+		return nil
+	})
+
+	tests := []struct {
+		name       string
+		clientType string
+		message    string
+		wantCode   string // 为空表示不应回复错误
+		wantType   string
+		details    []SchemaViolation
+	}{
+		{name: "handled", clientType: ClientTypeDriver, message: `{"type":"drive","car_id":"沪A1","count":1}`},
+		{name: "version 1 accepted", clientType: ClientTypeDriver, message: `{"type":"drive","v":1,"car_id":"沪A1"}`},
+		{name: "any client type", clientType: ClientTypePassenger, message: `{"type":"ping"}`},
+		{name: "invalid json", clientType: ClientTypeDriver, message: `{"type":`, wantCode: ErrCodeInvalidMessage},
+		{name: "missing type", clientType: ClientTypeDriver, message: `{"car_id":"沪A1"}`, wantCode: ErrCodeInvalidMessage},
+		{name: "unsupported version", clientType: ClientTypeDriver, message: `{"type":"drive","v":2,"car_id":"沪A1"}`,
+			wantCode: ErrCodeUnsupportedVersion, wantType: "drive"},
+		{name: "unknown type", clientType: ClientTypeDriver, message: `{"type":"fly"}`,
+			wantCode: ErrCodeUnknownType, wantType: "fly"},
+		{name: "client type not allowed", clientType: ClientTypePassenger, message: `{"type":"drive","car_id":"沪A1"}`,
+			wantCode: ErrCodeForbidden, wantType: "drive"},
+		{name: "schema violations", clientType: ClientTypeDriver, message: `{"type":"drive","count":-1}`,
+			wantCode: ErrCodeInvalidPayload, wantType: "drive",
+			details: []SchemaViolation{{"/car_id", "缺少必填字段"}, {"/count", "不能小于 0"}}},
+		{name: "version with wrong type", clientType: ClientTypeDriver, message: `{"type":"drive","v":"1","car_id":"沪A1"}`,
+			wantCode: ErrCodeInvalidPayload, wantType: "drive",
+			details: []SchemaViolation{{"/v", "应为数字"}}},
+		{name: "validator", clientType: ClientTypeDriver, message: `{"type":"drive","car_id":"invalid"}`,
+			wantCode: ErrCodeInvalidPayload, wantType: "drive"},
+		{name: "handler forbids", clientType: ClientTypeDriver, message: `{"type":"drive","car_id":"other"}`,
+			wantCode: ErrCodeForbidden, wantType: "drive"},
+		{name: "handler fails", clientType: ClientTypeDriver, message: `{"type":"drive","car_id":"broken"}`,
+			wantCode: ErrCodeHandlerFailed, wantType: "drive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm := NewWebSocketManager()
+			identity := ClientIdentity{UserID: "u", Role: config.RoleDriver, ClientType: tt.clientType}
+			c := registerIdle(t, wm, identity)
+			handled = nil
+
+			r.Dispatch(&ConnContext{Conn: c.conn, Identity: identity, Manager: wm, Raw: []byte(tt.message)})
+
+			if tt.wantCode == "" {
+				if len(c.send) != 0 {
+					t.Fatalf("unexpected reply %s", <-c.send)
+				}
+				if len(handled) != 1 {
+					t.Errorf("handler called %d times, want 1", len(handled))
+				}
+				return
+			}
+			if len(handled) != 0 {
+				t.Errorf("handler called for a rejected message")
+			}
+			if len(c.send) != 1 {
+				t.Fatalf("got %d replies, want 1", len(c.send))
+			}
+			var reply ErrorReply
+			if err := json.Unmarshal(<-c.send, &reply); err != nil {
+				t.Fatalf("bad reply: %v", err)
+			}
+			if reply.Type != "error" || reply.V != ProtocolVersion || reply.Code != tt.wantCode || reply.MessageType != tt.wantType {
+				t.Errorf("reply = %+v, want code %s for %q", reply, tt.wantCode, tt.wantType)
+			}
+			if reply.Error == "" {
+				t.Error("reply has no error description")
+			}
+			if tt.details != nil && !reflect.DeepEqual(reply.Details, tt.details) {
+				t.Errorf("details = %v, want %v", reply.Details, tt.details)
+			}
+		})
+	}
+}
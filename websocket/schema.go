@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema JSON Schema（draft-07）的子集，由消息结构体生成，用于校验客户端消息和生成协议文档
+//
+// 消息结构体的字段通过 jsonschema 标签声明约束，多个约束以逗号分隔：
+//
+//	required      字段必须出现且不为 null
+//	minLength=N   字符串最小长度
+//	minimum=N     数值下限（含）
+//	maximum=N     数值上限（含）
+//	minItems=N    数组最少元素数
+//	enum=a|b|c    字符串只能取列出的值
+//
+// desc 标签为字段说明，写入生成的文档
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// SchemaViolation 消息不符合 Schema 的一处错误
+type SchemaViolation struct {
+	Path  string `json:"path" desc:"出错字段的 JSON Pointer，例如 /routes/0/id"`
+	Error string `json:"error" desc:"错误描述"`
+}
+
+// SchemaError 消息不符合 Schema，Violations 随错误回复发给客户端
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Path+" "+v.Error)
+	}
+	return "消息不符合 schema：" + strings.Join(parts, "；")
+}
+
+// messageSchema 生成消息类型的 Schema：消息内容结构体的字段，加上固定的 type
+// 客户端消息还可以带协议版本 v；服务端消息只有结构体中声明了 v 时才有该字段
+func messageSchema(msgType string, payload reflect.Type, fromClient bool) *Schema {
+	s := schemaFor(payload)
+	if s.Type != "object" {
+		// 消息内容不是结构体时只校验 type 与 v
+		s = &Schema{Type: "object"}
+	}
+	if s.Properties == nil {
+		s.Properties = make(map[string]*Schema)
+	}
+	minVersion := 1.0
+	s.Properties["type"] = &Schema{Type: "string", Const: msgType, Description: "消息类型"}
+	if _, declared := s.Properties["v"]; fromClient || declared {
+		s.Properties["v"] = &Schema{Type: "integer", Minimum: &minVersion, Description: "协议版本，客户端省略时按 1 处理"}
+	}
+	s.Required = append([]string{"type"}, s.Required...)
+	s.Schema = "http://json-schema.org/draft-07/schema#"
+	s.Title = msgType
+	return s
+}
+
+// schemaFor 按 Go 类型生成 Schema
+func schemaFor(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		addFields(s, t)
+		return s
+	}
+	// interface{} 等类型不限制
+	return &Schema{}
+}
+
+// addFields 将结构体的导出字段加入 Schema，匿名嵌入的结构体字段展开到同一层
+func addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				addFields(s, field.Type)
+				continue
+			}
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addFields(s, field.Type)
+			continue
+		}
+
+		fs := schemaFor(field.Type)
+		fs.Description = field.Tag.Get("desc")
+		if applyConstraints(fs, field.Tag.Get("jsonschema")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// applyConstraints 按 jsonschema 标签设置约束，返回字段是否必填
+// 标签写错属于编程错误，直接 panic，注册时即可发现
+func applyConstraints(s *Schema, tag string) bool {
+	required := false
+	for _, item := range strings.Split(tag, ",") {
+		if item == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, "=")
+		switch key {
+		case "required":
+			required = true
+		case "enum":
+			s.Enum = strings.Split(value, "|")
+		case "minLength", "minItems":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic(fmt.Sprintf("jsonschema 标签 %q 无效：%v", item, err))
+			}
+			if key == "minLength" {
+				s.MinLength = &n
+			} else {
+				s.MinItems = &n
+			}
+		case "minimum", "maximum":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				panic(fmt.Sprintf("jsonschema 标签 %q 无效：%v", item, err))
+			}
+			if key == "minimum" {
+				s.Minimum = &f
+			} else {
+				s.Maximum = &f
+			}
+		default:
+			panic(fmt.Sprintf("未知的 jsonschema 约束：%s", item))
+		}
+	}
+	return required
+}
+
+// Validate 校验由 json.Unmarshal 解析为 interface{} 的消息，返回所有不符合之处
+// 未在 Schema 中声明的字段不做限制；值为 null 的字段视为未提供
+func (s *Schema) Validate(value interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+	s.validate(value, "", &violations)
+	return violations
+}
+
+func (s *Schema) validate(value interface{}, path string, violations *[]SchemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*violations = append(*violations, SchemaViolation{Path: p, Error: fmt.Sprintf(format, args...)})
+	}
+	if value == nil {
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("应为对象")
+			return
+		}
+		for _, name := range s.Required {
+			if object[name] == nil {
+				*violations = append(*violations, SchemaViolation{Path: path + "/" + name, Error: "缺少必填字段"})
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if fs, ok := s.Properties[name]; ok {
+				fs.validate(object[name], path+"/"+name, violations)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(object[name], path+"/"+name, violations)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			fail("应为数组")
+			return
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			fail("至少需要 %d 个元素", *s.MinItems)
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				s.Items.validate(item, path+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("应为字符串")
+			return
+		}
+		if s.Const != nil && str != s.Const {
+			fail("应为 %v", s.Const)
+		}
+		if s.MinLength != nil && len([]rune(str)) < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("不能为空")
+			} else {
+				fail("长度至少为 %d", *s.MinLength)
+			}
+		}
+		if len(s.Enum) > 0 {
+			found := false
+			for _, e := range s.Enum {
+				found = found || e == str
+			}
+			if !found {
+				fail("只能为 %s 之一", strings.Join(s.Enum, "、"))
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			fail("应为数字")
+			return
+		}
+		if s.Type == "integer" && number != math.Trunc(number) {
+			fail("应为整数")
+			return
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			fail("不能小于 %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			fail("不能大于 %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("应为布尔值")
+		}
+	}
+}
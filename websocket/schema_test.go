@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type schemaTestItem struct {
+	ID int `json:"id" jsonschema:"required"`
+}
+
+type schemaTestMessage struct {
+	CarID  string           `json:"car_id" jsonschema:"required,minLength=1"`
+	Status string           `json:"status" jsonschema:"enum=pending|delivered"`
+	Count  int              `json:"count" jsonschema:"minimum=0"`
+	Lat    float64          `json:"lat" jsonschema:"minimum=-90,maximum=90"`
+	Items  []schemaTestItem `json:"items" jsonschema:"minItems=1"`
+	Flag   bool             `json:"flag"`
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := messageSchema("test", reflect.TypeOf(schemaTestMessage{}), true)
+
+	tests := []struct {
+		name    string
+		message string
+		want    []SchemaViolation
+	}{
+		{"valid", `{"type":"test","v":1,"car_id":"沪A1","status":"pending","count":2,"lat":31.2,"items":[{"id":1}],"flag":true}`, nil},
+		{"only required fields", `{"type":"test","car_id":"沪A1"}`, nil},
+		{"null counts as absent", `{"type":"test","car_id":null,"count":null}`,
+			[]SchemaViolation{{"/car_id", "缺少必填字段"}}},
+		{"missing type and car_id", `{}`,
+			[]SchemaViolation{{"/type", "缺少必填字段"}, {"/car_id", "缺少必填字段"}}},
+		{"wrong type const", `{"type":"other","car_id":"沪A1"}`,
+			[]SchemaViolation{{"/type", "应为 test"}}},
+		{"empty string", `{"type":"test","car_id":""}`,
+			[]SchemaViolation{{"/car_id", "不能为空"}}},
+		{"string expected", `{"type":"test","car_id":42}`,
+			[]SchemaViolation{{"/car_id", "应为字符串"}}},
+		{"enum", `{"type":"test","car_id":"沪A1","status":"lost"}`,
+			[]SchemaViolation{{"/status", "只能为 pending、delivered 之一"}}},
+		{"integer expected", `{"type":"test","car_id":"沪A1","count":1.5}`,
+			[]SchemaViolation{{"/count", "应为整数"}}},
+		{"number expected", `{"type":"test","car_id":"沪A1","count":"2"}`,
+			[]SchemaViolation{{"/count", "应为数字"}}},
+		{"bounds", `{"type":"test","car_id":"沪A1","count":-1,"lat":91}`,
+			[]SchemaViolation{{"/count", "不能小于 0"}, {"/lat", "不能大于 90"}}},
+		{"version", `{"type":"test","car_id":"沪A1","v":0}`,
+			[]SchemaViolation{{"/v", "不能小于 1"}}},
+		{"min items", `{"type":"test","car_id":"沪A1","items":[]}`,
+			[]SchemaViolation{{"/items", "至少需要 1 个元素"}}},
+		{"nested path", `{"type":"test","car_id":"沪A1","items":[{"id":1},{}]}`,
+			[]SchemaViolation{{"/items/1/id", "缺少必填字段"}}},
+		{"boolean expected", `{"type":"test","car_id":"沪A1","flag":"yes"}`,
+			[]SchemaViolation{{"/flag", "应为布尔值"}}},
+		{"object expected", `[1]`,
+			[]SchemaViolation{{"/", "应为对象"}}},
+		{"unknown fields are ignored", `{"type":"test","car_id":"沪A1","extra":[1,2]}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.message), &value); err != nil {
+				t.Fatalf("bad test message: %v", err)
+			}
+			if got := schema.Validate(value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%s) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaRejectsUnknownConstraint(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown jsonschema constraint did not panic")
+		}
+	}()
+	schemaFor(reflect.TypeOf(struct {
+		A string `jsonschema:"maxLength=3"`
+	}{}))
+}
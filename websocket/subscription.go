@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"login/log_service"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// GPSSubscription 客户端对驾驶员位置的订阅条件
+// Routes 与 Cars 都为空时表示订阅全部驾驶员，否则满足任一条件即推送
+type GPSSubscription struct {
+	Routes map[int]bool
+	Cars   map[string]bool
+
+	mu   sync.Mutex
+	sent map[string]bool // 已推送给该订阅且尚未通知移除的驾驶员 ID，由 mu 保护
+}
+
+// WithSent 在持有订阅的锁时调用 fn，fn 可读写已推送给该订阅的驾驶员 ID 集合
+// 快照与增量都通过它记录推送过的驾驶员，驾驶员离开订阅范围时据此通知客户端移除
+func (s *GPSSubscription) WithSent(fn func(sent map[string]bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sent == nil {
+		s.sent = make(map[string]bool)
+	}
+	fn(s.sent)
+}
+
+// Matches 判断某个驾驶员是否在订阅范围内
+func (s *GPSSubscription) Matches(routeID int, carID string) bool {
+	if len(s.Routes) == 0 && len(s.Cars) == 0 {
+		return true
+	}
+	return s.Routes[routeID] || s.Cars[carID]
+}
+
+// DriverSnapshotProvider 在客户端订阅时提供订阅范围内所有驾驶员的完整快照
+type DriverSnapshotProvider interface {
+	DriverSnapshot(sub *GPSSubscription) []byte
+}
+
+// subscribeGPS 处理 subscribe_gps 消息：记录订阅条件并立即发送一次完整快照
+func (wm *WebSocketManager) subscribeGPS(conn *websocket.Conn, routeIDs []int, carIDs []string) {
+	sub := &GPSSubscription{
+		Routes: make(map[int]bool),
+		Cars:   make(map[string]bool),
+	}
+	for _, routeID := range routeIDs {
+		sub.Routes[routeID] = true
+	}
+	for _, carID := range carIDs {
+		sub.Cars[carID] = true
+	}
+
+	wm.mu.Lock()
+	wm.subscriptions[conn] = sub
+	wm.mu.Unlock()
+	log_service.WebSocketLogger.Printf("客户端订阅驾驶员位置，线路：%v，车辆：%v\n", routeIDs, carIDs)
+
+	if wm.SnapshotProvider == nil {
+		return
+	}
+	if snapshot := wm.SnapshotProvider.DriverSnapshot(sub); snapshot != nil {
+		wm.send(conn, snapshot)
+	}
+}
+
+// unsubscribeGPS 处理 unsubscribe_gps 消息：客户端恢复接收完整的位置广播
+func (wm *WebSocketManager) unsubscribeGPS(conn *websocket.Conn) {
+	wm.mu.Lock()
+	delete(wm.subscriptions, conn)
+	wm.mu.Unlock()
+}
+
+// BroadcastGPS 广播驾驶员位置：未订阅的客户端收到 legacy 完整数组（为 nil 时不发送），
+// 已订阅的客户端收到 build 针对其订阅条件生成的增量消息（返回 nil 时不发送）
+func (wm *WebSocketManager) BroadcastGPS(legacy []byte, build func(sub *GPSSubscription) []byte) {
+	wm.mu.Lock()
+	subscriptions := make(map[*websocket.Conn]*GPSSubscription, len(wm.subscriptions))
+	for conn, sub := range wm.subscriptions {
+		subscriptions[conn] = sub
+	}
+	wm.mu.Unlock()
+
+	for _, c := range wm.snapshotClients() {
+		message := legacy
+		if sub, subscribed := subscriptions[c.conn]; subscribed {
+			message = build(sub)
+		}
+		if message == nil {
+			continue
+		}
+		wm.deliver(c, message)
+	}
+}
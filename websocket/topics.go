@@ -0,0 +1,203 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login/log_service"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// 主题前缀，主题名为 "前缀:编号"，例如 route:101、car:粤A12345、site:5、admin:alerts
+const (
+	TopicPrefixRoute = "route"
+	TopicPrefixCar   = "car"
+	TopicPrefixSite  = "site"
+	TopicPrefixAdmin = "admin" // 仅管理员客户端可以订阅
+)
+
+// TopicAdminAlerts 管理员告警主题
+const TopicAdminAlerts = "admin:alerts"
+
+// RouteTopic 返回线路主题名
+func RouteTopic(routeID int) string {
+	return fmt.Sprintf("%s:%d", TopicPrefixRoute, routeID)
+}
+
+// CarTopic 返回车辆主题名
+func CarTopic(carID string) string {
+	return TopicPrefixCar + ":" + carID
+}
+
+// SiteTopic 返回站点主题名
+func SiteTopic(siteID int) string {
+	return fmt.Sprintf("%s:%d", TopicPrefixSite, siteID)
+}
+
+// TopicSubscriptions 回复 subscribe / unsubscribe 消息，列出连接当前订阅的全部主题
+type TopicSubscriptions struct {
+	Type     string            `json:"type"` // 固定为 "subscriptions"
+	Topics   []string          `json:"topics" desc:"当前订阅的主题"`
+	Rejected map[string]string `json:"rejected,omitempty" desc:"本次被拒绝的主题及原因"`
+}
+
+// validateTopic 检查主题名格式以及连接是否有权订阅
+func validateTopic(identity ClientIdentity, topic string) error {
+	prefix, key, found := strings.Cut(topic, ":")
+	if !found || key == "" {
+		return errors.New("主题格式应为 前缀:编号")
+	}
+	switch prefix {
+	case TopicPrefixRoute, TopicPrefixSite:
+		if _, err := strconv.Atoi(key); err != nil {
+			return errors.New("线路和站点编号必须为整数")
+		}
+	case TopicPrefixCar:
+	case TopicPrefixAdmin:
+		if identity.ClientType != ClientTypeAdmin {
+			return errors.New("仅管理员可以订阅 admin 主题")
+		}
+	default:
+		return errors.New("未知的主题前缀 " + prefix)
+	}
+	return nil
+}
+
+// subscribeTopics 处理 subscribe 消息，将连接加入列出的主题
+func (wm *WebSocketManager) subscribeTopics(conn *websocket.Conn, identity ClientIdentity, topics []string) {
+	rejected := make(map[string]string)
+
+	wm.mu.Lock()
+	for _, topic := range topics {
+		if err := validateTopic(identity, topic); err != nil {
+			rejected[topic] = err.Error()
+			continue
+		}
+		if wm.topics[topic] == nil {
+			wm.topics[topic] = make(map[*websocket.Conn]bool)
+		}
+		wm.topics[topic][conn] = true
+		if wm.connTopics[conn] == nil {
+			wm.connTopics[conn] = make(map[string]bool)
+		}
+		wm.connTopics[conn][topic] = true
+	}
+	wm.mu.Unlock()
+
+	log_service.WebSocketLogger.Printf("用户 %s 订阅主题：%v，拒绝：%v\n", identity.UserID, topics, rejected)
+	wm.replySubscriptions(conn, rejected)
+}
+
+// unsubscribeTopics 处理 unsubscribe 消息，topics 为空时退订全部主题
+func (wm *WebSocketManager) unsubscribeTopics(conn *websocket.Conn, topics []string) {
+	if len(topics) == 0 {
+		wm.removeTopics(conn)
+	} else {
+		wm.mu.Lock()
+		for _, topic := range topics {
+			wm.leaveTopic(conn, topic)
+		}
+		wm.mu.Unlock()
+	}
+	wm.replySubscriptions(conn, nil)
+}
+
+// leaveTopic 将连接移出主题，调用方需持有 mu
+func (wm *WebSocketManager) leaveTopic(conn *websocket.Conn, topic string) {
+	if subscribers, exists := wm.topics[topic]; exists {
+		delete(subscribers, conn)
+		if len(subscribers) == 0 {
+			delete(wm.topics, topic)
+		}
+	}
+	if topics, exists := wm.connTopics[conn]; exists {
+		delete(topics, topic)
+		if len(topics) == 0 {
+			delete(wm.connTopics, conn)
+		}
+	}
+}
+
+// removeTopics 将连接移出它订阅的所有主题（退订全部或连接注销时调用）
+func (wm *WebSocketManager) removeTopics(conn *websocket.Conn) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for topic := range wm.connTopics[conn] {
+		wm.leaveTopic(conn, topic)
+	}
+}
+
+// replySubscriptions 回复连接当前订阅的全部主题
+func (wm *WebSocketManager) replySubscriptions(conn *websocket.Conn, rejected map[string]string) {
+	wm.mu.Lock()
+	topics := make([]string, 0, len(wm.connTopics[conn]))
+	for topic := range wm.connTopics[conn] {
+		topics = append(topics, topic)
+	}
+	wm.mu.Unlock()
+	sort.Strings(topics)
+
+	reply, err := json.Marshal(TopicSubscriptions{Type: "subscriptions", Topics: topics, Rejected: rejected})
+	if err != nil {
+		return
+	}
+	wm.send(conn, reply)
+}
+
+// Publish 将消息放入订阅了 topic 的所有连接的发送队列，返回成功入队的连接数
+// JSON 对象消息会加上 topic 字段，客户端据此区分主题消息与同类型的广播消息
+func (wm *WebSocketManager) Publish(topic string, payload []byte) int {
+	subscribers, _ := wm.topicClients(topic, "")
+	return wm.publishTo(subscribers, topic, payload)
+}
+
+// PublishOrSend 将消息发布到 topic，并按 SendMessageToClients 的方式发送给未订阅该主题的 clientType 客户端
+// 用于原先按客户端类型广播的消息：订阅了主题的客户端只收到一份带 topic 字段的消息，未订阅的客户端行为不变
+func (wm *WebSocketManager) PublishOrSend(topic string, payload []byte, clientType string) int {
+	subscribers, others := wm.topicClients(topic, clientType)
+	for _, c := range others {
+		wm.deliver(c, payload)
+	}
+	return wm.publishTo(subscribers, topic, payload)
+}
+
+// topicClients 返回订阅了 topic 的客户端，以及未订阅 topic 的 clientType 客户端（clientType 为空时不返回后者）
+func (wm *WebSocketManager) topicClients(topic, clientType string) (subscribers, others []*client) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for conn := range wm.topics[topic] {
+		if c, ok := wm.clients[conn]; ok {
+			subscribers = append(subscribers, c)
+		}
+	}
+	if clientType == "" {
+		return subscribers, nil
+	}
+	for conn, c := range wm.clients {
+		if c.identity.ClientType == clientType && !wm.topics[topic][conn] {
+			others = append(others, c)
+		}
+	}
+	return subscribers, others
+}
+
+// publishTo 将加上 topic 字段的消息放入订阅者的发送队列，返回成功入队的连接数
+func (wm *WebSocketManager) publishTo(subscribers []*client, topic string, payload []byte) int {
+	if len(subscribers) == 0 {
+		return 0
+	}
+	if tagged, err := withFields(payload, map[string]interface{}{"topic": topic}); err == nil {
+		payload = tagged
+	}
+	delivered := 0
+	for _, c := range subscribers {
+		if wm.deliver(c, payload) {
+			delivered++
+		}
+	}
+	return delivered
+}
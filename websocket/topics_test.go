@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTopic(t *testing.T) {
+	admin := ClientIdentity{UserID: "a", ClientType: ClientTypeAdmin}
+	passenger := ClientIdentity{UserID: "p", ClientType: ClientTypePassenger}
+	tests := []struct {
+		identity ClientIdentity
+		topic    string
+		wantErr  bool
+	}{
+		{passenger, RouteTopic(101), false},
+		{passenger, CarTopic("粤A12345"), false},
+		{passenger, SiteTopic(5), false},
+		{admin, TopicAdminAlerts, false},
+		{passenger, TopicAdminAlerts, true},
+		{passenger, "route:north", true},
+		{passenger, "site:", true},
+		{passenger, "route", true},
+		{passenger, "weather:today", true},
+	}
+	for _, tt := range tests {
+		if err := validateTopic(tt.identity, tt.topic); (err != nil) != tt.wantErr {
+			t.Errorf("validateTopic(%s, %q) = %v, want error %v", tt.identity.ClientType, tt.topic, err, tt.wantErr)
+		}
+	}
+}
+
+// takeSubscriptions 取出连接收到的 subscriptions 回复
+func takeSubscriptions(t *testing.T, c *client) TopicSubscriptions {
+	t.Helper()
+	if len(c.send) != 1 {
+		t.Fatalf("got %d replies, want 1", len(c.send))
+	}
+	var reply TopicSubscriptions
+	if err := json.Unmarshal(<-c.send, &reply); err != nil || reply.Type != "subscriptions" {
+		t.Fatalf("bad subscriptions reply %+v: %v", reply, err)
+	}
+	return reply
+}
+
+func TestSubscribeAndUnsubscribeTopics(t *testing.T) {
+	wm := NewWebSocketManager()
+	identity := ClientIdentity{UserID: "p", ClientType: ClientTypePassenger}
+	c := registerIdle(t, wm, identity)
+
+	wm.subscribeTopics(c.conn, identity, []string{RouteTopic(2), RouteTopic(1), TopicAdminAlerts, SiteTopic(5)})
+	reply := takeSubscriptions(t, c)
+	if !reflect.DeepEqual(reply.Topics, []string{"route:1", "route:2", "site:5"}) || len(reply.Rejected) != 1 || reply.Rejected[TopicAdminAlerts] == "" {
+		t.Fatalf("subscribe reply = %+v", reply)
+	}
+
+	wm.unsubscribeTopics(c.conn, []string{RouteTopic(2), RouteTopic(3)})
+	if reply := takeSubscriptions(t, c); !reflect.DeepEqual(reply.Topics, []string{"route:1", "site:5"}) {
+		t.Errorf("topics after unsubscribe = %v", reply.Topics)
+	}
+	if _, exists := wm.topics[RouteTopic(2)]; exists {
+		t.Error("empty topic was not removed")
+	}
+
+	wm.unsubscribeTopics(c.conn, nil)
+	if reply := takeSubscriptions(t, c); len(reply.Topics) != 0 {
+		t.Errorf("topics after unsubscribing all = %v", reply.Topics)
+	}
+	if len(wm.topics) != 0 || len(wm.connTopics) != 0 {
+		t.Errorf("topic state left behind: %v %v", wm.topics, wm.connTopics)
+	}
+}
+
+func TestPublishOrSend(t *testing.T) {
+	wm := NewWebSocketManager()
+	adminIdentity := ClientIdentity{UserID: "a1", ClientType: ClientTypeAdmin}
+	subscribed := registerIdle(t, wm, adminIdentity)
+	unsubscribed := registerIdle(t, wm, ClientIdentity{UserID: "a2", ClientType: ClientTypeAdmin})
+	passengerIdentity := ClientIdentity{UserID: "p", ClientType: ClientTypePassenger}
+	passenger := registerIdle(t, wm, passengerIdentity)
+	bystander := registerIdle(t, wm, ClientIdentity{UserID: "d", ClientType: ClientTypeDriver})
+
+	for _, c := range []*client{subscribed, passenger} {
+		wm.subscribeTopics(c.conn, c.identity, []string{RouteTopic(1)})
+		takeSubscriptions(t, c)
+	}
+
+	type received struct {
+		Type  string `json:"type"`
+		Topic string `json:"topic"`
+	}
+	receive := func(c *client) []received {
+		var messages []received
+		for len(c.send) > 0 {
+			var m received
+			if err := json.Unmarshal(<-c.send, &m); err != nil {
+				t.Fatalf("bad message: %v", err)
+			}
+			messages = append(messages, m)
+		}
+		return messages
+	}
+
+	if n := wm.Publish(RouteTopic(1), []byte(`{"type":"eta"}`)); n != 2 {
+		t.Errorf("Publish delivered to %d connections, want 2", n)
+	}
+	if n := wm.PublishOrSend(RouteTopic(1), []byte(`{"type":"headway"}`), ClientTypeAdmin); n != 2 {
+		t.Errorf("PublishOrSend reported %d subscribers, want 2", n)
+	}
+
+	tagged := []received{{"eta", "route:1"}, {"headway", "route:1"}}
+	if got := receive(subscribed); !reflect.DeepEqual(got, tagged) {
+		t.Errorf("subscribed admin got %+v, want %+v", got, tagged)
+	}
+	if got := receive(passenger); !reflect.DeepEqual(got, tagged) {
+		t.Errorf("subscribed passenger got %+v, want %+v", got, tagged)
+	}
+	// 未订阅的管理员仍按原来的广播收到一份不带 topic 的消息
+	if got := receive(unsubscribed); !reflect.DeepEqual(got, []received{{Type: "headway"}}) {
+		t.Errorf("unsubscribed admin got %+v", got)
+	}
+	if got := receive(bystander); len(got) != 0 {
+		t.Errorf("driver got %+v", got)
+	}
+
+	wm.removeTopics(passenger.conn)
+	if n := wm.Publish(RouteTopic(1), []byte(`not json`)); n != 1 {
+		t.Errorf("Publish after removing a subscriber delivered to %d connections, want 1", n)
+	}
+	if raw := <-subscribed.send; string(raw) != "not json" {
+		t.Errorf("non-object payload = %s, want it unchanged", raw)
+	}
+}
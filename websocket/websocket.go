@@ -1,8 +1,10 @@
 package websocket
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"login/config"
@@ -12,6 +14,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -20,28 +24,50 @@ type DriverLocationUpdater interface {
 	UpdateDriverLocation(driverID string, latitude, longitude float64, car_id string) error
 }
 
+// ReplayStreamer 按倍速回放历史轨迹，每一帧通过 send 发送给请求的客户端，ctx 取消时停止回放
+type ReplayStreamer interface {
+	StreamReplay(ctx context.Context, driverID, carID, startTime, endTime string, speed float64, send func([]byte) error) error
+}
+
 // WebSocketManager 管理WebSocket连接，支持不同类型的客户端
 type WebSocketManager struct {
-	Clients     map[*websocket.Conn]string // 存储连接池及其对应的客户端类型（"driver", "passenger", "admin"）
-	Broadcast   chan []byte                // 用于广播消息
-	Register    chan *websocket.Conn       // 注册连接
-	Unregister  chan *websocket.Conn       // 注销连接
-	Updater     DriverLocationUpdater      // 引入接口
-	connections map[string]*websocket.Conn // 保存ID到WebSocket连接的映射
+	clients     map[*websocket.Conn]*client // 已注册的连接及其身份与发送队列，由 mu 保护
+	Broadcast   chan []byte                 // 用于广播消息
+	Updater     DriverLocationUpdater       // 引入接口
+	connections map[string]*websocket.Conn  // 保存ID到WebSocket连接的映射，由 mu 保护
 	// car_conn    map[string]*websocket.Conn
-	mu sync.Mutex // 用于同步访问connections
+	mu sync.Mutex // 用于同步访问 clients、connections 以及订阅信息
+
+	SnapshotProvider    DriverSnapshotProvider               // 订阅时提供驾驶员快照
+	Replayer            ReplayStreamer                       // 历史轨迹回放
+	PassengerCounter    PassengerCounter                     // 上下车人数与实时载客量
+	handlers            *HandlerRegistry                     // 消息类型到处理函数的注册表
+	subscriptions       map[*websocket.Conn]*GPSSubscription // 客户端的驾驶员位置订阅，由 mu 保护
+	disconnectListeners []DisconnectListener                 // 连接断开事件的监听者，由 mu 保护
+	deliveries          *deliveryTracker                     // 等待客户端确认的消息
+	calls               *callRegistry                        // 最近的乘客呼叫
+	offline             *offlineQueue                        // 发给未连接的驾驶员或车辆的离线消息
+	topics              map[string]map[*websocket.Conn]bool  // 主题 -> 订阅的连接，由 mu 保护
+	connTopics          map[*websocket.Conn]map[string]bool  // 连接 -> 订阅的主题，由 mu 保护
 }
 
 // NewWebSocketManager 创建WebSocketManager实例
 func NewWebSocketManager() *WebSocketManager {
-	return &WebSocketManager{
-		Clients:     make(map[*websocket.Conn]string),
+	wm := &WebSocketManager{
+		clients:     make(map[*websocket.Conn]*client),
 		Broadcast:   make(chan []byte),
-		Register:    make(chan *websocket.Conn),
-		Unregister:  make(chan *websocket.Conn),
 		connections: make(map[string]*websocket.Conn),
 		// car_conn:    make(map[string]*websocket.Conn),
+		subscriptions: make(map[*websocket.Conn]*GPSSubscription),
+		topics:        make(map[string]map[*websocket.Conn]bool),
+		connTopics:    make(map[*websocket.Conn]map[string]bool),
+		handlers:      NewHandlerRegistry(),
+		deliveries:    newDeliveryTracker(),
+		calls:         newCallRegistry(),
+		offline:       &offlineQueue{},
 	}
+	registerBuiltinHandlers(wm.handlers)
+	return wm
 }
 
 // 客户端类型常量
@@ -51,19 +77,22 @@ const (
 	ClientTypeAdmin     = "admin"
 )
 
-// HandleWebSocketConnection 处理每个WebSocket连接
-func (wm *WebSocketManager) HandleWebSocketConnection(conn *websocket.Conn, clientType string) {
-	// 注册连接并指定客户端类型
-	wm.Register <- conn
-	log_service.WebSocketLogger.Printf("新连接建立，客户端类型：%s\n", clientType)
+// HandleWebSocketConnection 处理每个WebSocket连接，identity 为握手时由 token 确定的身份
+func (wm *WebSocketManager) HandleWebSocketConnection(conn *websocket.Conn, identity ClientIdentity) {
+	clientType := identity.ClientType
+	// 注册连接并启动该连接唯一的写协程
+	c := wm.addClient(conn, identity)
+	log_service.WebSocketLogger.Printf("新连接建立，用户 %s，客户端类型：%s\n", identity.UserID, clientType)
 	defer func() {
-		wm.Unregister <- conn
-		conn.Close()
-		log_service.WebSocketLogger.Printf("连接关闭，客户端类型：%s\n", clientType)
+		wm.removeClient(conn)
+		log_service.WebSocketLogger.Printf("连接关闭，用户 %s，客户端类型：%s\n", identity.UserID, clientType)
 	}()
 
-	wm.Clients[conn] = clientType
+	wm.loadSites(c)
+	wm.loadRoutes(c)
 
+	// 超过 pong_timeout_seconds 未收到 pong 或任何消息、或消息超过 max_message_bytes 时读取失败并断开
+	c.prepareRead()
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -74,51 +103,101 @@ func (wm *WebSocketManager) HandleWebSocketConnection(conn *websocket.Conn, clie
 			}
 			break
 		}
+		c.extendReadDeadline()
 
-		var msg WebSocketMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log_service.WebSocketLogger.Printf("消息解析失败，错误：%v\n", err)
-			continue
+		// 按消息类型交给注册的处理函数，新增消息类型通过 RegisterHandler 注册，无需修改此循环
+		wm.handlers.Dispatch(&ConnContext{Conn: conn, Identity: identity, Manager: wm, Raw: message})
+	}
+}
+
+// addClient 注册连接并启动写协程
+func (wm *WebSocketManager) addClient(conn *websocket.Conn, identity ClientIdentity) *client {
+	c := newClient(conn, identity)
+	wm.mu.Lock()
+	wm.clients[conn] = c
+	wm.mu.Unlock()
+	go c.writePump()
+	return c
+}
+
+// removeClient 注销连接：移出客户端列表、ID 绑定和所有订阅，取消进行中的回放，停止写协程并关闭连接
+// 连接上绑定的驾驶员编号或车牌号产生 driver_disconnected / car_disconnected 事件
+func (wm *WebSocketManager) removeClient(conn *websocket.Conn) {
+	var events []DisconnectEvent
+	wm.mu.Lock()
+	c, exists := wm.clients[conn]
+	if exists {
+		events = wm.unbindAll(c, time.Now())
+		if c.replay != nil {
+			c.replay.cancel()
+			c.replay = nil
 		}
+	}
+	delete(wm.clients, conn)
+	wm.mu.Unlock()
+
+	wm.unsubscribeGPS(conn)
+	wm.removeTopics(conn)
+	if exists {
+		c.close()
+	} else {
+		conn.Close()
+	}
+	wm.publishDisconnects(events)
+}
 
-		switch msg.Type {
-		case "connections":
-			wm.connections[msg.DriverID] = conn
-		case "car_conn":
-			// wm.car_conn[msg.CarID] = conn
-			wm.connections[msg.CarID] = conn
-		case "call_accept":
-			wm.SendMessageToClients(message, "")
-		case "driver_gps":
-			// log_service.WebSocketLogger.Printf("收到驾驶员 GPS 信息：%v\n", msg)
-			if wm.Updater != nil {
-				err := wm.Updater.UpdateDriverLocation(msg.DriverID, msg.Location.Latitude, msg.Location.Longitude, msg.CarID)
-				if err != nil {
-					log_service.WebSocketLogger.Printf("更新驾驶员位置失败：%v\n", err)
-				}
+// startReplay 处理 replay 消息，在独立协程中回放，不阻塞消息读取
+// 每个连接同时只进行一个回放：新的回放取消正在进行的回放，连接注销时回放随之取消
+func (wm *WebSocketManager) startReplay(conn *websocket.Conn, msg ReplayRequest) {
+	if wm.Replayer == nil {
+		return
+	}
+	c, ok := wm.clientFor(conn)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &replayJob{cancel: cancel}
+	wm.mu.Lock()
+	if c.replay != nil {
+		c.replay.cancel()
+	}
+	c.replay = job
+	wm.mu.Unlock()
+
+	go func() {
+		defer func() {
+			wm.mu.Lock()
+			if c.replay == job {
+				c.replay = nil
 			}
-		case "vehicle_call":
-			wm.SendMessageToClients(message, "")
-		case "payment_user_count":
-			wm.SendMessageByID(msg.CarID, message)
-		case "boardingMessage":
-			wm.SendMessageByID(msg.CarID, message)
-		case "alightingMessage":
-			wm.SendMessageByID(msg.CarID, message)
-		case "update_sites":
-			updateSites(msg)
-		case "update_routes":
-			updateRoutes(msg)
-		case "delete_route":
-			deleteRoute(msg)
-		default:
-			log_service.WebSocketLogger.Printf("未知消息类型：%s\n", msg.Type)
+			wm.mu.Unlock()
+			cancel()
+		}()
+		err := wm.Replayer.StreamReplay(ctx, msg.DriverID, msg.CarID, msg.StartTime, msg.EndTime, msg.Speed, func(frame []byte) error {
+			if !wm.deliver(c, frame) {
+				return errors.New("客户端已断开")
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log_service.WebSocketLogger.Printf("轨迹回放失败：%v\n", err)
+			errorMessage, _ := json.Marshal(map[string]string{"type": "replay_error", "error": err.Error()})
+			wm.deliver(c, errorMessage)
 		}
-	}
+	}()
+}
+
+// geodataVersion 线路或站点每次被修改时加一，缓存线路与站点的模块据此判断是否需要重新加载
+var geodataVersion atomic.Uint64
+
+// GeodataVersion 返回线路与站点的修改版本号
+func GeodataVersion() uint64 {
+	return geodataVersion.Load()
 }
 
-func deleteRoute(message WebSocketMessage) error {
-	routeID := message.Routes[0].ID // 从消息中获取 route_id
+func deleteRoute(routeID int) error {
+	defer geodataVersion.Add(1)
 
 	// 1. 修改文件后缀名
 	// 构造文件路径 (假设路径为 ./assets/route{route_id}.json)
@@ -151,70 +230,57 @@ func deleteRoute(message WebSocketMessage) error {
 	return nil
 }
 
-func updateRoutes(message WebSocketMessage) error {
+func updateRoutes(routes []Route) error {
+	for _, route := range routes {
+		if err := SaveRoute(route); err != nil {
+			log_service.WebSocketLogger.Printf("failed to save route %d: %v", route.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// SaveRoute 将路线写入 assets/route{id}.json，并在 route_table 中标记为使用中
+// 文件格式为 [{"path": [[lng, lat], ...]}]，与 QueryRoutes 读取的格式一致
+func SaveRoute(route Route) error {
+	defer geodataVersion.Add(1)
 	// 保存路径的目标目录
 	targetDir := "./assets"
 	// 确保目录存在
-	err := os.MkdirAll(targetDir, 0755)
-	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to create target directory: %v", err)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %v", err)
 	}
 
-	for _, route := range message.Routes {
-		// 更新或插入到数据库
-		_, err := db.ExecuteSQL(config.RoleDriver,
-			"INSERT INTO route_table (route_id, route_include, route_isusing) VALUES (?, '1-3', ?)ON DUPLICATE KEY UPDATE route_isusing = VALUES(route_isusing);",
-			route.ID, 1)
-		if err != nil {
-			log_service.WebSocketLogger.Printf("failed to upsert route %d: %v", route.ID, err)
-		}
-
-		// 构造文件路径
-		filePath := filepath.Join(targetDir, fmt.Sprintf("route%d.json", route.ID))
-
-		// 创建或清空文件
-		file, err := os.Create(filePath)
-		if err != nil {
-			log_service.WebSocketLogger.Printf("failed to create or open file %s: %v", filePath, err)
-		}
-		defer file.Close()
-
-		// 只保存 `path` 数据
-		pathData := map[string]interface{}{
-			"path": route.Path,
-		}
-
-		// 在写入 JSON 前加上 `[`
-		_, err = file.WriteString("[")
-		if err != nil {
-			log_service.WebSocketLogger.Printf("failed to write opening bracket to file %s: %v", filePath, err)
-		}
-
-		// 将数据写入文件
-		encoder := json.NewEncoder(file)
-		encoder.SetIndent("", "  ") // 格式化为易读 JSON
-		if err := encoder.Encode(pathData); err != nil {
-			log_service.WebSocketLogger.Printf("failed to write JSON to file %s: %v", filePath, err)
-		}
-
-		// 在写入 JSON 后加上 `]`
-		_, err = file.WriteString("]")
-		if err != nil {
-			log_service.WebSocketLogger.Printf("failed to write closing bracket to file %s: %v", filePath, err)
-		}
+	// 更新或插入到数据库
+	_, err := db.ExecuteSQL(config.RoleDriver,
+		"INSERT INTO route_table (route_id, route_include, route_isusing) VALUES (?, '1-3', ?)ON DUPLICATE KEY UPDATE route_isusing = VALUES(route_isusing);",
+		route.ID, 1)
+	if err != nil {
+		log_service.WebSocketLogger.Printf("failed to upsert route %d: %v", route.ID, err)
+	}
 
-		log_service.WebSocketLogger.Printf("Route %d has been updated in %s\n", route.ID, filePath)
+	// 只保存 `path` 数据
+	data, err := json.MarshalIndent([]map[string]interface{}{{"path": route.Path}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode route %d: %v", route.ID, err)
+	}
+	filePath := filepath.Join(targetDir, fmt.Sprintf("route%d.json", route.ID))
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", filePath, err)
 	}
 
+	log_service.WebSocketLogger.Printf("Route %d has been updated in %s\n", route.ID, filePath)
 	return nil
 }
 
-func updateSites(message WebSocketMessage) error {
-	for _, site := range message.Sites {
-		// 更新或插入數據
-		_, err := db.ExecuteSQL(config.RoleDriver, "INSERT INTO site_table (site_id, site_name, site_position, site_passenger, is_used, site_note) VALUES (?, ?, POINT(?, ?), ?, ?, ?) ON DUPLICATE KEY UPDATE site_name = VALUES(site_name), site_position = VALUES(site_position), site_passenger = VALUES(site_passenger), is_used = VALUES(is_used), site_note = VALUES(site_note)", site.ID, site.Name, site.Location.Latitude, site.Location.Longitude, site.SitePassenger, site.IsUsed, site.Note)
+// SaveSites 写入或更新站点
+// 与 QuerySites 一致，site_position 按 POINT(经度, 纬度) 保存
+func SaveSites(sites []Site) error {
+	defer geodataVersion.Add(1)
+	for _, site := range sites {
+		_, err := db.ExecuteSQL(config.RoleDriver, "INSERT INTO site_table (site_id, site_name, site_position, site_passenger, is_used, site_note) VALUES (?, ?, POINT(?, ?), ?, ?, ?) ON DUPLICATE KEY UPDATE site_name = VALUES(site_name), site_position = VALUES(site_position), site_passenger = VALUES(site_passenger), is_used = VALUES(is_used), site_note = VALUES(site_note)", site.ID, site.Name, site.Location.Longitude, site.Location.Latitude, site.SitePassenger, site.IsUsed, site.Note)
 		if err != nil {
-			log_service.WebSocketLogger.Printf("failed to upsert site: %v", err)
+			return fmt.Errorf("failed to upsert site %d: %v", site.ID, err)
 		}
 	}
 
@@ -223,70 +289,83 @@ func updateSites(message WebSocketMessage) error {
 
 // SendMessageToClients 向所有客户端或特定类型的客户端发送消息
 func (wm *WebSocketManager) SendMessageToClients(message []byte, clientType string) {
-	for conn, cType := range wm.Clients {
+	for _, c := range wm.snapshotClients() {
 		// 如果指定了客户端类型，则仅发送给匹配的类型
-		if clientType == "" || cType == clientType {
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log_service.WebSocketLogger.Printf("向客户端发送消息失败，错误：%v\n", err)
-				conn.Close()
-				delete(wm.Clients, conn)
-				log_service.WebSocketLogger.Printf("客户端连接移除，类型：%s\n", cType)
-			}
+		if clientType == "" || c.identity.ClientType == clientType {
+			wm.deliver(c, message)
 		}
 	}
 }
 
 // SendMessageByID 通过ID找到对应的WebSocket连接并发送消息
+// JSON 对象消息带上 msg_id 可靠发送：ID 当前未连接，或连接在客户端确认前断开（例如半开连接直到 pong 超时才被发现）时，
+// 消息保存为离线消息，在该 ID 重新绑定时按顺序补发
 func (manager *WebSocketManager) SendMessageByID(ID string, message []byte) {
+	if tagged, err := withFields(message, map[string]interface{}{"msg_id": newMessageID()}); err == nil {
+		message = tagged
+	}
+
+	unlock := manager.offline.lock(ID)
+	defer unlock()
+	manager.sendByID(ID, message)
+}
+
+// SendTransientByID 将时效性强的消息（例如调度建议）发给绑定了 ID 的连接，返回是否放入了发送队列
+// 不要求确认也不重发，ID 未连接时直接丢弃而不保存为离线消息，避免重新连接后收到过时的内容
+func (manager *WebSocketManager) SendTransientByID(ID string, message []byte) bool {
 	manager.mu.Lock()
-	defer manager.mu.Unlock()
+	c, ok := manager.clients[manager.connections[ID]]
+	manager.mu.Unlock()
+	return ok && manager.deliver(c, message)
+}
 
+// sendByID 将消息发给绑定了 ID 的连接，未连接时保存为离线消息，调用方需持有该 ID 的锁
+func (manager *WebSocketManager) sendByID(ID string, message []byte) {
+	manager.mu.Lock()
 	conn, exists := manager.connections[ID]
-	if !exists {
-		log_service.WebSocketLogger.Printf("ID %s not found", ID)
+	c, ok := manager.clients[conn]
+	manager.mu.Unlock()
+	if !exists || !ok || c.isClosed() {
+		manager.offline.save(ID, message, time.Now())
 		return
 	}
 
-	// messageBytes, err := json.Marshal(message)
-	// if err != nil {
-	// 	log_service.WebSocketLogger.Printf("failed to marshal message: %v", err)
-	// 	return
-	// }
-
-	err := conn.WriteMessage(websocket.TextMessage, message)
-	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+	msgID := messageIDOf(message)
+	if msgID == "" {
+		// 不是 JSON 对象的消息无法确认，放入发送队列即视为送达
+		if !manager.deliver(c, message) {
+			log_service.WebSocketLogger.Printf("failed to send message to %s", ID)
+			manager.offline.save(ID, message, time.Now())
+		}
 		return
 	}
+	manager.sendReliable(c, msgID, message, nil, func() {
+		if !c.isClosed() {
+			return // 重试用尽但连接仍在，客户端已收到消息只是没有确认
+		}
+		// 连接已断开：ID 已被新连接绑定时发给新连接，否则保存为离线消息
+		unlock := manager.offline.lock(ID)
+		defer unlock()
+		manager.sendByID(ID, message)
+	})
 }
 
-// Start 启动WebSocket服务器，监听注册、注销和广播消息
+// Start 启动WebSocket服务器，监听广播消息
+// 连接的注册与注销在各自的连接协程中同步完成，写入由每个连接的写协程负责
 func (wm *WebSocketManager) Start() {
 	log_service.WebSocketLogger.Println("WebSocket 服务器已启动")
-	for {
-		select {
-		case conn := <-wm.Register:
-			// 默认注册为"passenger"类型
-			wm.Clients[conn] = ClientTypePassenger
-			log_service.WebSocketLogger.Println("新客户端已注册，类型：passenger")
-			loadSites(conn)
-			loadRoutes(conn)
-		case conn := <-wm.Unregister:
-			delete(wm.Clients, conn)
-			log_service.WebSocketLogger.Println("客户端已注销")
-
-		case message := <-wm.Broadcast:
-			log_service.WebSocketLogger.Printf("广播消息：%s\n", string(message))
-			wm.SendMessageToClients(message, "") // 发送给所有客户端
-		}
+	wm.startRetryLoop()
+	for message := range wm.Broadcast {
+		log_service.WebSocketLogger.Printf("广播消息：%s\n", string(message))
+		wm.SendMessageToClients(message, "") // 发送给所有客户端
 	}
 }
 
-func loadSites(conn *websocket.Conn) {
+// QuerySites 从 site_table 中读取全部站点信息
+func QuerySites() ([]Site, error) {
 	result, err := db.ExecuteSQL(config.RoleDriver, "SELECT site_id, site_name, ST_X(site_position) AS longitude, ST_Y(site_position) AS latitude, site_passenger, is_used, site_note  FROM site_table;")
 	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
-		return
+		return nil, err
 	}
 	rows := result.(*sql.Rows)
 	defer rows.Close()
@@ -296,37 +375,24 @@ func loadSites(conn *websocket.Conn) {
 		var site Site
 		var location Location
 		if err := rows.Scan(&site.ID, &site.Name, &location.Longitude, &location.Latitude, &site.SitePassenger, &site.IsUsed, &site.Note); err != nil {
-			log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+			log_service.WebSocketLogger.Printf("failed to scan site: %v", err)
 		}
 		// 将 Location 赋值到 Site 中
 		site.Location = location
 		sites = append(sites, site)
 	}
-	var WSM WebSocketMessage
-	WSM.Type = "site"
-	WSM.Sites = sites
-	message, err := json.Marshal(WSM)
-	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
-		return
-	}
-	err = conn.WriteMessage(websocket.TextMessage, message)
-	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
-		return
-	}
-
+	return sites, nil
 }
 
-func loadRoutes(conn *websocket.Conn) {
+// QueryRoutes 读取 assets 目录下所有 route{id}.json 路线文件
+func QueryRoutes() ([]Route, error) {
 	// 定义存放 JSON 文件的目录
 	dir := "./assets"
 
 	// 匹配以 route 开头的 JSON 文件
 	matches, err := filepath.Glob(filepath.Join(dir, "route*.json"))
 	if err != nil {
-		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
-		return
+		return nil, err
 	}
 	// 正则表达式匹配 "route" 后的数字
 	regex := regexp.MustCompile(`route(\d+)\.json`)
@@ -339,7 +405,7 @@ func loadRoutes(conn *websocket.Conn) {
 			// 转换为整数
 			_, err := fmt.Sscanf(submatches[1], "%d", &routeNumber)
 			if err != nil {
-				log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+				log_service.WebSocketLogger.Printf("failed to parse route number: %v", err)
 			}
 		}
 		// 读取文件内容
@@ -352,7 +418,7 @@ func loadRoutes(conn *websocket.Conn) {
 		// 解析 JSON 文件内容
 		var routes []Route
 		err = json.Unmarshal(data, &routes)
-		if err != nil {
+		if err != nil || len(routes) == 0 {
 
 			continue
 		}
@@ -361,17 +427,35 @@ func loadRoutes(conn *websocket.Conn) {
 		// 将解析的路由信息添加到 allRoutes
 		allRoutes = append(allRoutes, routes...)
 	}
-	var WSM WebSocketMessage
-	WSM.Type = "route"
-	WSM.Routes = allRoutes
-	message, err := json.Marshal(WSM)
+	return allRoutes, nil
+}
+
+// loadSites 连接建立时发送全部站点
+func (wm *WebSocketManager) loadSites(c *client) {
+	sites, err := QuerySites()
+	if err != nil {
+		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+		return
+	}
+	message, err := json.Marshal(SiteMessage{Type: "site", Sites: sites})
+	if err != nil {
+		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
+		return
+	}
+	wm.deliver(c, message)
+}
+
+// loadRoutes 连接建立时发送全部线路
+func (wm *WebSocketManager) loadRoutes(c *client) {
+	allRoutes, err := QueryRoutes()
 	if err != nil {
 		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
 		return
 	}
-	err = conn.WriteMessage(websocket.TextMessage, message)
+	message, err := json.Marshal(RouteMessage{Type: "route", Routes: allRoutes})
 	if err != nil {
 		log_service.WebSocketLogger.Printf("failed to send message: %v", err)
 		return
 	}
+	wm.deliver(c, message)
 }
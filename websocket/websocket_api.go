@@ -18,10 +18,8 @@ func NewWebSocketAPI() *WebSocketAPI {
 	return &WebSocketAPI{
 		manager: NewWebSocketManager(),
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				// 允许所有跨域请求，实际应用中可根据需求限制
-				return true
-			},
+			// 按 websocket.allowed_origins 校验跨域请求
+			CheckOrigin: checkOrigin,
 		},
 	}
 }
@@ -31,8 +29,41 @@ func (api *WebSocketAPI) SetUpdater(updater DriverLocationUpdater) {
 	api.manager.Updater = updater
 }
 
+// SetSnapshotProvider 设置订阅驾驶员位置时的快照提供者
+func (api *WebSocketAPI) SetSnapshotProvider(provider DriverSnapshotProvider) {
+	api.manager.SnapshotProvider = provider
+}
+
+// SetReplayer 设置历史轨迹回放的实现
+func (api *WebSocketAPI) SetReplayer(replayer ReplayStreamer) {
+	api.manager.Replayer = replayer
+}
+
+// SetPassengerCounter 设置上下车人数的记录实现
+func (api *WebSocketAPI) SetPassengerCounter(counter PassengerCounter) {
+	api.manager.PassengerCounter = counter
+}
+
+// Handlers 返回消息处理函数的注册表，其他包可以通过 RegisterHandler 注册新的消息类型
+func (api *WebSocketAPI) Handlers() *HandlerRegistry {
+	return api.manager.handlers
+}
+
+// AddDisconnectListener 添加驾驶员或车辆连接断开事件的监听者
+func (api *WebSocketAPI) AddDisconnectListener(listener DisconnectListener) {
+	api.manager.AddDisconnectListener(listener)
+}
+
 // HandleWebSocket 处理 WebSocket 请求
 func (api *WebSocketAPI) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// 升级前验证 token，客户端类型与绑定身份均由 token 的角色和用户编号决定
+	identity, err := authenticate(r)
+	if err != nil {
+		log.Println("WebSocket authentication failed:", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	// 升级 HTTP 连接为 WebSocket 连接
 	conn, err := api.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -41,13 +72,12 @@ func (api *WebSocketAPI) HandleWebSocket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 默认将新连接标记为乘客类型，可以根据业务需求调整
-	api.HandleConnection(conn, ClientTypePassenger)
+	api.HandleConnection(conn, identity)
 }
 
-// HandleConnection 处理 WebSocket 连接并指定客户端类型
-func (api *WebSocketAPI) HandleConnection(conn *websocket.Conn, clientType string) {
-	api.manager.HandleWebSocketConnection(conn, clientType)
+// HandleConnection 处理已认证的 WebSocket 连接
+func (api *WebSocketAPI) HandleConnection(conn *websocket.Conn, identity ClientIdentity) {
+	api.manager.HandleWebSocketConnection(conn, identity)
 }
 
 // SendMessage 向所有客户端或特定类型的客户端发送消息
@@ -55,6 +85,31 @@ func (api *WebSocketAPI) SendMessage(message []byte, clientType string) {
 	api.manager.SendMessageToClients(message, clientType)
 }
 
+// SendMessageByID 向通过 connections / car_conn 绑定了指定 ID 的连接发送消息
+func (api *WebSocketAPI) SendMessageByID(ID string, message []byte) {
+	api.manager.SendMessageByID(ID, message)
+}
+
+// SendTransientByID 向绑定了指定 ID 的连接发送时效性强的消息，ID 未连接时丢弃，不保存为离线消息
+func (api *WebSocketAPI) SendTransientByID(ID string, message []byte) bool {
+	return api.manager.SendTransientByID(ID, message)
+}
+
+// Publish 将消息发送给订阅了 topic 的所有客户端，返回送达的客户端数
+func (api *WebSocketAPI) Publish(topic string, payload []byte) int {
+	return api.manager.Publish(topic, payload)
+}
+
+// PublishOrSend 将消息发布到 topic，未订阅该主题的 clientType 客户端照常收到，返回送达的订阅者数
+func (api *WebSocketAPI) PublishOrSend(topic string, payload []byte, clientType string) int {
+	return api.manager.PublishOrSend(topic, payload, clientType)
+}
+
+// BroadcastGPS 按客户端的订阅条件广播驾驶员位置
+func (api *WebSocketAPI) BroadcastGPS(legacy []byte, build func(sub *GPSSubscription) []byte) {
+	api.manager.BroadcastGPS(legacy, build)
+}
+
 // Start 启动 WebSocket 服务器并开始监听注册、注销和广播消息
 func (api *WebSocketAPI) Start() {
 	go api.manager.Start()
@@ -64,14 +119,11 @@ func (api *WebSocketAPI) Start() {
 func (api *WebSocketAPI) RegisterRoutes(mux *http.ServeMux) {
 	// 将 WebSocket 的路径 "/ws" 注册为路由
 	mux.HandleFunc("/ws", api.HandleWebSocket)
+	// 协议文档：各消息类型的 JSON Schema
+	mux.HandleFunc("/ws/schema", api.HandleSchema)
 }
 
-// RegisterClient 注册一个 WebSocket 连接
-func (api *WebSocketAPI) RegisterClient(conn *websocket.Conn) {
-	api.manager.Register <- conn
-}
-
-// UnregisterClient 注销一个 WebSocket 连接
+// UnregisterClient 注销一个 WebSocket 连接并断开
 func (api *WebSocketAPI) UnregisterClient(conn *websocket.Conn) {
-	api.manager.Unregister <- conn
+	api.manager.removeClient(conn)
 }
@@ -0,0 +1,309 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"login/config"
+	"login/log_service"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMain(m *testing.M) {
+	// 测试不写 application.log
+	log_service.WebSocketLogger = log.New(io.Discard, "", 0)
+	log_service.GPSLogger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// testConnPair 建立一条真实的 WebSocket 连接，返回服务端与客户端两端，测试结束时关闭
+func testConnPair(t *testing.T) (server, remote *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server = <-accepted
+	t.Cleanup(func() {
+		remote.Close()
+		server.Close()
+	})
+	return server, remote
+}
+
+// registerIdle 注册一个不启动写协程的客户端，发往它的消息留在 send 队列中，便于直接检查
+func registerIdle(t *testing.T, wm *WebSocketManager, identity ClientIdentity) *client {
+	t.Helper()
+	server, _ := testConnPair(t)
+	c := newClient(server, identity)
+	wm.mu.Lock()
+	wm.clients[server] = c
+	wm.mu.Unlock()
+	return c
+}
+
+// bindForTest 不经过 bind 直接绑定 ID，避免补发离线消息时访问数据库
+func bindForTest(wm *WebSocketManager, ID, kind string, c *client) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.connections[ID] = c.conn
+	c.bound[ID] = kind
+}
+
+// drain 持续读取并丢弃远端收到的消息，直到连接关闭
+func drain(remote *websocket.Conn) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := remote.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// readN 在 timeout 内从远端读取 n 条消息
+func readN(t *testing.T, remote *websocket.Conn, n int, timeout time.Duration) [][]byte {
+	t.Helper()
+	remote.SetReadDeadline(time.Now().Add(timeout))
+	messages := make([][]byte, 0, n)
+	for len(messages) < n {
+		_, data, err := remote.ReadMessage()
+		if err != nil {
+			t.Fatalf("read after %d of %d messages: %v", len(messages), n, err)
+		}
+		messages = append(messages, data)
+	}
+	return messages
+}
+
+// setWebSocketConfig 临时修改 WebSocket 配置，测试结束时恢复
+func setWebSocketConfig(t *testing.T, change func(c *config.WebSocketConfig)) {
+	t.Helper()
+	saved := config.AppConfig.WebSocket
+	change(&config.AppConfig.WebSocket)
+	t.Cleanup(func() { config.AppConfig.WebSocket = saved })
+}
+
+func TestConcurrentSendsWithClientChurn(t *testing.T) {
+	wm := NewWebSocketManager()
+
+	// 固定的接收者：每种发送各 40 次，总数小于发送队列长度，不会因队列满被断开（否则按 ID 发送会转存到数据库）
+	const rounds = 40
+	passenger := ClientIdentity{UserID: "p", Role: config.RolePassenger, ClientType: ClientTypePassenger}
+	var receivers []*client
+	var remotes []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		server, remote := testConnPair(t)
+		c := wm.addClient(server, passenger)
+		bindForTest(wm, "car-"+string(rune('a'+i)), bindCar, c)
+		receivers = append(receivers, c)
+		remotes = append(remotes, remote)
+	}
+	for _, c := range receivers {
+		wm.subscribeTopics(c.conn, passenger, []string{"route:1"})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			wm.SendMessageToClients([]byte(`{"type":"broadcast"}`), ClientTypePassenger)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			for j := range receivers {
+				wm.SendMessageByID("car-"+string(rune('a'+j)), []byte(`{"type":"by_id"}`))
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			wm.Publish("route:1", []byte(`{"type":"topic"}`))
+		}
+	}()
+	go func() {
+		// 同时不断有客户端连接、订阅、绑定并断开
+		defer wg.Done()
+		admin := ClientIdentity{UserID: "admin", Role: config.RoleAdmin, ClientType: ClientTypeAdmin}
+		for i := 0; i < 20; i++ {
+			server, remote := testConnPair(t)
+			done := drain(remote)
+			c := wm.addClient(server, admin)
+			wm.subscribeTopics(server, admin, []string{"route:1", "admin:alerts"})
+			bindForTest(wm, "churn", bindDriver, c)
+			wm.removeClient(server)
+			<-done
+		}
+	}()
+	wg.Wait()
+
+	for i, c := range receivers {
+		if c.isClosed() {
+			t.Fatalf("receiver %d was disconnected", i)
+		}
+		// 订阅回复 1 条，广播、按 ID 发送、主题发布各 rounds 条
+		readN(t, remotes[i], 1+3*rounds, 5*time.Second)
+		wm.removeClient(c.conn)
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if len(wm.clients) != 0 || len(wm.connections) != 0 || len(wm.topics) != 0 || len(wm.connTopics) != 0 {
+		t.Errorf("manager still holds state after all clients left: clients=%d connections=%d topics=%d connTopics=%d",
+			len(wm.clients), len(wm.connections), len(wm.topics), len(wm.connTopics))
+	}
+}
+
+func TestSlowConsumerIsDropped(t *testing.T) {
+	setWebSocketConfig(t, func(c *config.WebSocketConfig) { c.SendQueueSize = 4 })
+	wm := NewWebSocketManager()
+	identity := ClientIdentity{UserID: "p", Role: config.RolePassenger, ClientType: ClientTypePassenger}
+
+	slow := registerIdle(t, wm, identity) // 没有写协程，队列不会被取走
+	server, remote := testConnPair(t)
+	fast := wm.addClient(server, identity)
+
+	for i := 0; i < 4; i++ {
+		if !wm.deliver(slow, []byte(`{"type":"x"}`)) {
+			t.Fatalf("deliver %d failed before the queue was full", i)
+		}
+	}
+	if slow.isClosed() {
+		t.Fatal("slow client closed before its queue overflowed")
+	}
+
+	// 队列已满：这次广播断开慢速客户端，其他客户端照常收到
+	wm.SendMessageToClients([]byte(`{"type":"x"}`), "")
+	if !slow.isClosed() {
+		t.Fatal("slow client was not closed when its queue overflowed")
+	}
+	if wm.deliver(slow, []byte(`{"type":"x"}`)) {
+		t.Error("deliver to a closed client reported success")
+	}
+	if fast.isClosed() {
+		t.Fatal("fast client was closed")
+	}
+
+	readN(t, remote, 1, 5*time.Second)
+	wm.removeClient(server)
+}
+
+func TestWritePumpIsTheOnlyWriter(t *testing.T) {
+	// ping 间隔 1 秒，让 ping 与消息交替写出
+	setWebSocketConfig(t, func(c *config.WebSocketConfig) {
+		c.PongTimeoutSeconds = 2
+		c.PingIntervalSeconds = 1
+	})
+	wm := NewWebSocketManager()
+	server, remote := testConnPair(t)
+	c := wm.addClient(server, ClientIdentity{UserID: "d", Role: config.RoleDriver, ClientType: ClientTypeDriver})
+	bindForTest(wm, "d", bindDriver, c)
+
+	pings := 0
+	remote.SetPingHandler(func(data string) error {
+		pings++
+		return remote.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// 8 个协程同时通过不同的途径发送，写入都交给 writePump；并发写同一连接会被 -race 检测到
+	const senders, perSender = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				message, _ := json.Marshal(map[string]int{"sender": i, "seq": j})
+				switch j % 3 {
+				case 0:
+					wm.send(server, message)
+				case 1:
+					wm.SendMessageToClients(message, ClientTypeDriver)
+				default:
+					wm.SendMessageByID("d", message)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 每个发送者的消息完整且按发送顺序到达
+	next := make(map[int]int)
+	for _, data := range readN(t, remote, senders*perSender, 5*time.Second) {
+		var message struct {
+			Sender int `json:"sender"`
+			Seq    int `json:"seq"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("corrupted frame %q: %v", data, err)
+		}
+		if message.Seq != next[message.Sender] {
+			t.Fatalf("sender %d: got seq %d, want %d", message.Sender, message.Seq, next[message.Sender])
+		}
+		next[message.Sender]++
+	}
+
+	// ping 由同一个写协程发出：读到超时为止，期间应至少收到一个 ping，且没有多余的消息
+	remote.SetReadDeadline(time.Now().Add(1500 * time.Millisecond))
+	if _, data, err := remote.ReadMessage(); err == nil {
+		t.Fatalf("unexpected extra message %q", data)
+	}
+	if pings == 0 {
+		t.Error("no ping received")
+	}
+	if c.isClosed() {
+		t.Error("client closed during concurrent sends")
+	}
+	wm.removeClient(server)
+}
+
+func TestSendTransientByID(t *testing.T) {
+	wm := NewWebSocketManager()
+	identity := ClientIdentity{UserID: "d", Role: config.RoleDriver, ClientType: ClientTypeDriver}
+	c := registerIdle(t, wm, identity)
+	bindForTest(wm, "d", bindDriver, c)
+
+	if !wm.SendTransientByID("d", []byte(`{"type":"headway_action"}`)) {
+		t.Fatal("transient message to a bound driver was not queued")
+	}
+	if got := string(<-c.send); got != `{"type":"headway_action"}` {
+		t.Errorf("message = %s, want it unchanged without msg_id", got)
+	}
+	// 未连接的 ID 直接丢弃：若转存离线消息会访问数据库
+	if wm.SendTransientByID("absent", []byte(`{"type":"headway_action"}`)) {
+		t.Error("transient message to an absent driver reported as queued")
+	}
+	wm.deliveries.mu.Lock()
+	pending := len(wm.deliveries.pending)
+	wm.deliveries.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("transient message is waiting for an ack")
+	}
+}